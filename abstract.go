@@ -0,0 +1,19 @@
+package crossrefindexer
+
+import (
+	"regexp"
+
+	"github.com/karatekaneen/crossrefindexer/textnorm"
+)
+
+// leadingHeading matches a title like <jats:title>Abstract</jats:title> that publishers put first, possibly inside
+// a section, which doesn't add anything to the abstract. Only titles are matched, so that text starting with the
+// same word is kept.
+var leadingHeading = regexp.MustCompile(
+	`(?i)^\s*((?:<(?:[\w-]+:)?sec\b[^>]*>\s*)*)<(?:[\w-]+:)?title\b[^>]*>\s*(?:abstract|summary)\s*[.:]?\s*</(?:[\w-]+:)?title>`,
+)
+
+// cleanAbstract turns the JATS XML of an abstract into plain text
+func cleanAbstract(abstract string) string {
+	return textnorm.Clean(leadingHeading.ReplaceAllString(abstract, "$1"))
+}
@@ -0,0 +1,88 @@
+package crossrefindexer
+
+import (
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+func Test_cleanAbstract(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{
+			name:  "plain text",
+			input: "Light is quantized.",
+			want:  "Light is quantized.",
+		},
+		{
+			name:  "paragraphs",
+			input: "<jats:p>First paragraph.</jats:p><jats:p>Second paragraph.</jats:p>",
+			want:  "First paragraph. Second paragraph.",
+		},
+		{
+			name:  "leading heading is dropped",
+			input: "<jats:title>Abstract</jats:title><jats:p>The text.</jats:p>",
+			want:  "The text.",
+		},
+		{
+			name:  "leading heading in a section is dropped",
+			input: "<jats:sec><jats:title>Summary:</jats:title><jats:p>The text.</jats:p></jats:sec>",
+			want:  "The text.",
+		},
+		{
+			name:  "text starting with a heading word is kept",
+			input: "<jats:p>Summary statistics of the data.</jats:p>",
+			want:  "Summary statistics of the data.",
+		},
+		{
+			name:  "plain text starting with a heading word is kept",
+			input: "Abstract algebra is studied.",
+			want:  "Abstract algebra is studied.",
+		},
+		{
+			name:  "longer leading title is kept",
+			input: "<jats:title>Summary of findings</jats:title><jats:p>The text.</jats:p>",
+			want:  "Summary of findings The text.",
+		},
+		{
+			name:  "section headings are kept",
+			input: "<jats:sec><jats:title>Background</jats:title><jats:p>Why.</jats:p></jats:sec><jats:sec><jats:title>Methods</jats:title><jats:p>How.</jats:p></jats:sec>",
+			want:  "Background Why. Methods How.",
+		},
+		{
+			name:  "inline tags don't split words",
+			input: "<jats:p>H<jats:sub>2</jats:sub>O and <jats:italic>E. coli</jats:italic></jats:p>",
+			want:  "H2O and E. coli",
+		},
+		{
+			name:  "entities are decoded",
+			input: "<jats:p>x &lt; y &amp;&#160;z&nbsp;&#x00E9;</jats:p>",
+			want:  "x < y & z é",
+		},
+		{
+			name:  "whitespace is collapsed",
+			input: "<jats:p>\n  Some\t\ttext\n\n  here  </jats:p>",
+			want:  "Some text here",
+		},
+		{
+			name:  "tags without namespace and with attributes",
+			input: `<p id="p1">One</p><sec sec-type="x"><p>Two</p></sec>`,
+			want:  "One Two",
+		},
+		{
+			name:  "word starting with heading is kept",
+			input: "<jats:p>Abstraction is key.</jats:p>",
+			want:  "Abstraction is key.",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			is := is.New(t)
+			is.Equal(cleanAbstract(tt.input), tt.want)
+		})
+	}
+}
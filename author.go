@@ -0,0 +1,85 @@
+package crossrefindexer
+
+import (
+	"regexp"
+	"strings"
+)
+
+// PublicationAuthor is the simplified form of an Author
+type PublicationAuthor struct {
+	Given              string                   `json:"given,omitempty"`
+	Family             string                   `json:"family,omitempty"`
+	Suffix             string                   `json:"suffix,omitempty"`
+	Name               string                   `json:"name,omitempty"` // Organizations only have a name
+	Sequence           string                   `json:"sequence,omitempty"`
+	ORCID              string                   `json:"orcid,omitempty"` // Without the URL, like 0000-0002-1825-0097
+	AuthenticatedORCID bool                     `json:"authenticated_orcid,omitempty"`
+	Affiliation        []PublicationAffiliation `json:"affiliation,omitempty"`
+}
+
+// PublicationAffiliation is an affiliation with the identifiers of the organization
+type PublicationAffiliation struct {
+	Name string                     `json:"name,omitempty"`
+	IDs  []PublicationAffiliationID `json:"ids,omitempty"`
+}
+
+type PublicationAffiliationID struct {
+	ID   string `json:"id"`
+	Type string `json:"type"` // Lowercase, like ror or isni
+}
+
+// orcidPattern is four groups of four digits where the last one is a checksum that can be X
+var orcidPattern = regexp.MustCompile(`^\d{4}-\d{4}-\d{4}-\d{3}[\dX]$`)
+
+// NormalizeORCID returns the bare ORCID iD without the orcid.org URL, or an empty string if it is not valid
+func NormalizeORCID(orcid string) string {
+	orcid = strings.ToUpper(strings.TrimSpace(orcid))
+	for _, prefix := range []string{"HTTPS://", "HTTP://", "ORCID.ORG/", "WWW.ORCID.ORG/"} {
+		orcid = strings.TrimPrefix(orcid, prefix)
+	}
+
+	if !orcidPattern.MatchString(orcid) {
+		return ""
+	}
+	return orcid
+}
+
+func publicationAuthors(authors []Author) []PublicationAuthor {
+	if len(authors) == 0 {
+		return nil
+	}
+
+	simplified := make([]PublicationAuthor, 0, len(authors))
+	for _, auth := range authors {
+		author := PublicationAuthor{
+			Given:    stringFromPointer(auth.Given),
+			Family:   stringFromPointer(auth.Family),
+			Suffix:   stringFromPointer(auth.Suffix),
+			Name:     stringFromPointer(auth.Name),
+			Sequence: stringFromPointer(auth.Sequence),
+			ORCID:    NormalizeORCID(stringFromPointer(auth.ORCID)),
+		}
+		// Authenticated only means something if there is an ORCID to go with it
+		author.AuthenticatedORCID = author.ORCID != "" && auth.AuthenticatedORCID
+
+		if auth.Affiliation != nil {
+			for _, affiliation := range *auth.Affiliation {
+				author.Affiliation = append(author.Affiliation, publicationAffiliation(affiliation))
+			}
+		}
+
+		simplified = append(simplified, author)
+	}
+	return simplified
+}
+
+func publicationAffiliation(affiliation Affiliation) PublicationAffiliation {
+	simplified := PublicationAffiliation{Name: affiliation.Name}
+	for _, id := range affiliation.ID {
+		simplified.IDs = append(simplified.IDs, PublicationAffiliationID{
+			ID:   id.ID,
+			Type: strings.ToLower(id.IDType),
+		})
+	}
+	return simplified
+}
@@ -0,0 +1,30 @@
+package crossrefindexer
+
+import (
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+func Test_NormalizeORCID(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{name: "bare", input: "0000-0002-1825-0097", want: "0000-0002-1825-0097"},
+		{name: "http URL", input: "http://orcid.org/0000-0002-1825-0097", want: "0000-0002-1825-0097"},
+		{name: "https URL with www", input: "https://www.orcid.org/0000-0002-1825-0097", want: "0000-0002-1825-0097"},
+		{name: "lowercase checksum", input: "0000-0002-1694-233x", want: "0000-0002-1694-233X"},
+		{name: "too short", input: "0000-0002-1825", want: ""},
+		{name: "not an ORCID", input: "https://example.com/me", want: ""},
+		{name: "empty", input: "", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			is := is.New(t)
+			is.Equal(NormalizeORCID(tt.input), tt.want)
+		})
+	}
+}
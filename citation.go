@@ -0,0 +1,52 @@
+package crossrefindexer
+
+// Citation is an edge in the citation graph from a publication to a work it references
+type Citation struct {
+	CitingDOI     string `json:"citing_doi"`
+	CitedDOI      string `json:"cited_doi"`
+	DOIAssertedBy string `json:"doi_asserted_by,omitempty"` // Who matched the reference to the DOI, crossref or publisher
+	Key           string `json:"key,omitempty"`             // The key of the reference in the citing publication
+	Unstructured  string `json:"unstructured,omitempty"`    // The reference as written in the citing publication
+
+	// IndexedAt is the IndexedAt of the citing publication, used as version in the same way
+	IndexedAt int64 `json:"-"`
+}
+
+// ID identifies the edge. DOIs can't contain whitespace so the space keeps them apart.
+func (c Citation) ID() string {
+	return c.CitingDOI + " " + c.CitedDOI
+}
+
+// ToCitations returns an edge for every reference with a valid DOI.
+// A work referenced more than once only gets the first edge.
+func ToCitations(pub *Crossref) []Citation {
+	if pub.Reference == nil || len(*pub.Reference) == 0 {
+		return nil
+	}
+
+	citing, err := NormalizeDOI(pub.Doi)
+	if err != nil {
+		return nil
+	}
+
+	seen := map[string]bool{}
+	citations := []Citation{}
+	for _, ref := range *pub.Reference {
+		cited, err := NormalizeDOI(ref.Doi)
+		if err != nil || seen[cited] {
+			continue
+		}
+		seen[cited] = true
+
+		citations = append(citations, Citation{
+			CitingDOI:     citing,
+			CitedDOI:      cited,
+			DOIAssertedBy: ref.DoiAssertedBy,
+			Key:           ref.Key,
+			Unstructured:  stringFromPointer(ref.Unstructured),
+			IndexedAt:     pub.Indexed.Timestamp,
+		})
+	}
+
+	return citations
+}
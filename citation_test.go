@@ -0,0 +1,81 @@
+package crossrefindexer
+
+import (
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+func Test_ToCitations(t *testing.T) {
+	unstructured := "A. Einstein, Ann. Phys. 17, 891 (1905)"
+
+	tests := []struct {
+		name       string
+		references *[]Reference
+		want       []Citation
+	}{
+		{
+			name:       "no references",
+			references: nil,
+			want:       nil,
+		},
+		{
+			name: "references with DOIs",
+			references: &[]Reference{
+				{Key: "ref1", Doi: "10.1002/ANDP.19053221004", DoiAssertedBy: "crossref", Unstructured: &unstructured},
+				{Key: "ref2", Doi: "https://doi.org/10.1000/abc", DoiAssertedBy: "publisher"},
+			},
+			want: []Citation{
+				{
+					CitingDOI:     "10.1000/abc",
+					CitedDOI:      "10.1002/andp.19053221004",
+					DOIAssertedBy: "crossref",
+					Key:           "ref1",
+					Unstructured:  unstructured,
+					IndexedAt:     1648814400000,
+				},
+				{
+					CitingDOI:     "10.1000/abc",
+					CitedDOI:      "10.1000/abc",
+					DOIAssertedBy: "publisher",
+					Key:           "ref2",
+					IndexedAt:     1648814400000,
+				},
+			},
+		},
+		{
+			name: "references without or with invalid DOIs are left out",
+			references: &[]Reference{
+				{Key: "ref1", Unstructured: &unstructured},
+				{Key: "ref2", Doi: "not a doi"},
+			},
+			want: []Citation{},
+		},
+		{
+			name: "same work referenced twice",
+			references: &[]Reference{
+				{Key: "ref1", Doi: "10.1000/xyz"},
+				{Key: "ref2", Doi: "10.1000/XYZ"},
+			},
+			want: []Citation{
+				{CitingDOI: "10.1000/abc", CitedDOI: "10.1000/xyz", Key: "ref1", IndexedAt: 1648814400000},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			is := is.New(t)
+
+			pub := generateCrossref(func(cr *Crossref) { cr.Reference = tt.references })
+			is.Equal(ToCitations(pub), tt.want)
+		})
+	}
+}
+
+func Test_CitationID(t *testing.T) {
+	is := is.New(t)
+
+	c := Citation{CitingDOI: "10.1000/a", CitedDOI: "10.1000/b"}
+	is.Equal(c.ID(), "10.1000/a 10.1000/b")
+}
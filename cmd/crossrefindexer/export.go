@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/karatekaneen/crossrefindexer"
+	"github.com/karatekaneen/crossrefindexer/config"
+	"github.com/karatekaneen/crossrefindexer/export"
+	"go.uber.org/zap"
+	"golang.org/x/sync/errgroup"
+)
+
+func runExport(ctx context.Context, cfg config.ExportCmd, logger *zap.SugaredLogger) {
+	logger = withInput(logger, cfg.Input)
+
+	inputs, err := crossrefindexer.Load(
+		logger,
+		cfg.File,
+		cfg.Dir,
+		cfg.Format,
+		cfg.Compression,
+		os.Stdin,
+	)
+	if err != nil {
+		logger.Fatalln(err)
+	}
+
+	logger.Infof("Found %d files to process", len(inputs))
+
+	encoder, err := openEncoder(cfg.To, cfg.Output, cfg.Parquet)
+	if err != nil {
+		logger.Fatal(err)
+	}
+
+	filter := export.Filter{
+		Types:         cfg.Types,
+		Prefixes:      cfg.Prefixes,
+		ISSNs:         cfg.ISSNs,
+		Members:       cfg.Members,
+		FromYear:      cfg.FromYear,
+		ToYear:        cfg.ToYear,
+		SkipRetracted: cfg.SkipRetracted,
+	}
+
+	publications := make(chan crossrefindexer.Crossref)
+
+	group := new(errgroup.Group)
+	group.Go(func() error {
+		return parseInputs(ctx, logger, inputs, cfg.Workers, publications)
+	})
+
+	processed, exported := 0, 0
+	for pub := range publications {
+		pub := pub
+		processed++
+
+		simplified := export.Simplify(&pub)
+		if !filter.Match(simplified) {
+			continue
+		}
+		if err := encoder.Encode(simplified); err != nil {
+			logger.Fatalf("Could not export %s: %v", simplified.DOI, err)
+		}
+		exported++
+	}
+
+	if err := group.Wait(); err != nil {
+		logger.Fatalf("Something failed: %v", err)
+	}
+
+	if err := encoder.Close(); err != nil {
+		logger.Fatalf("Could not finish export: %v", err)
+	}
+	logger.Infow("Export done", "processed", processed, "exported", exported, "to", cfg.To)
+}
+
+// encodeAll makes a sink that encodes everything it gets and closes the encoder when done
+func encodeAll(encoder export.Encoder) func(context.Context, chan crossrefindexer.SimplifiedPublication) error {
+	return func(ctx context.Context, data chan crossrefindexer.SimplifiedPublication) error {
+		for pub := range data {
+			if err := encoder.Encode(pub); err != nil {
+				return fmt.Errorf("could not export %s: %w", pub.DOI, err)
+			}
+		}
+		return encoder.Close()
+	}
+}
+
+// openEncoder creates the encoder of the format. It writes to the output file, or to stdout if there is none.
+// Parquet is written to the output directory instead.
+func openEncoder(to, output string, parquet config.Parquet) (export.Encoder, error) {
+	if to == export.FormatParquet {
+		if output == "" {
+			return nil, errors.New("an output directory is required for parquet")
+		}
+		return export.NewParquetEncoder(export.ParquetConfig{
+			Dir:          output,
+			Profile:      parquet.Profile,
+			Compression:  parquet.ParquetCompression,
+			RowGroupSize: parquet.ParquetRowGroup,
+			MaxFileBytes: parquet.ParquetFileBytes,
+		})
+	}
+
+	out := os.Stdout
+	if output != "" {
+		file, err := os.Create(output)
+		if err != nil {
+			return nil, fmt.Errorf("could not create output file: %w", err)
+		}
+		out = file
+	}
+
+	buffered := bufio.NewWriter(out)
+	encoder, err := export.NewEncoder(to, buffered)
+	if err != nil {
+		if out != os.Stdout {
+			out.Close()
+		}
+		return nil, err
+	}
+	return &fileEncoder{Encoder: encoder, buffered: buffered, file: out}, nil
+}
+
+// fileEncoder flushes and closes the file it writes to when it is closed
+type fileEncoder struct {
+	export.Encoder
+	buffered *bufio.Writer
+	file     *os.File
+}
+
+func (e *fileEncoder) Close() error {
+	if err := e.Encoder.Close(); err != nil {
+		return err
+	}
+	if err := e.buffered.Flush(); err != nil {
+		return err
+	}
+	if e.file == os.Stdout {
+		return nil
+	}
+	return e.file.Close()
+}
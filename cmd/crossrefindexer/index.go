@@ -0,0 +1,423 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/dustin/go-humanize"
+	"github.com/karatekaneen/crossrefindexer"
+	"github.com/karatekaneen/crossrefindexer/config"
+	"github.com/karatekaneen/crossrefindexer/dedup"
+	"github.com/karatekaneen/crossrefindexer/elastic"
+	"github.com/karatekaneen/crossrefindexer/export"
+	"github.com/karatekaneen/crossrefindexer/fanout"
+	"github.com/karatekaneen/crossrefindexer/sqlite"
+	"github.com/karatekaneen/crossrefindexer/verify"
+	"go.uber.org/zap"
+	"golang.org/x/sync/errgroup"
+)
+
+func runIndex(ctx context.Context, cfg config.IndexCmd, logger *zap.SugaredLogger) {
+	logger = withInput(logger, cfg.Input)
+
+	// LoadData. Can be file (json/gzip), dir or stdin
+	// If file: get format & compression then read data
+	// If dir: walk files, extract format, infer compression and then read as file
+	inputs, err := crossrefindexer.Load(
+		logger,
+		cfg.File,
+		cfg.Dir,
+		cfg.Format,
+		cfg.Compression,
+		os.Stdin,
+	)
+	if err != nil {
+		logger.Fatalln(err)
+	}
+
+	logger.Infof("Found %d files to process", len(inputs))
+
+	p := newPipeline(ctx, cfg.Indexing, logger)
+	defer p.close()
+
+	if _, err := p.index(ctx, inputs); err != nil {
+		logger.Fatalf("Indexing failed: %v", err)
+	}
+
+	if p.verifier != nil {
+		// The index can only be expected to contain exactly what was processed if it was empty before
+		result, err := p.verifier.Verify(ctx, p.store, cfg.Elastic.IndexName, cfg.RemoveIndex)
+		logger.Infow("Verified index",
+			"processed", result.Processed,
+			"unique", result.Unique,
+			"indexed", result.Indexed,
+			"sampled", result.Sampled,
+			"skipped", result.Skipped,
+			"mismatches", len(result.Mismatches),
+		)
+		if err != nil {
+			logger.Fatalf("Verification of index failed: %v", err)
+		}
+	}
+}
+
+// pipeline writes the publications to all the sinks. The sinks are opened once and can be written to in several passes.
+type pipeline struct {
+	cfg    config.Indexing
+	logger *zap.SugaredLogger
+	sinks  []fanout.Sink
+
+	verifier   *verify.Verifier
+	store      verify.Store // What the verifier compares with
+	bulkWriter *elastic.BulkFileWriter
+	dedup      *dedup.Deduplicator // Shared by all passes so that stale repeats in later inputs are dropped too
+	closers    []func()            // Closes the sinks when done
+
+	citationCount int // Only updated by the first sink with citations
+}
+
+// newPipeline opens all the sinks. Every sink transforms the publications the way it needs them.
+// The Elasticsearch index is the one verified if there is one, otherwise the SQLite database.
+func newPipeline(ctx context.Context, cfg config.Indexing, logger *zap.SugaredLogger) *pipeline {
+	p := &pipeline{cfg: cfg, logger: logger}
+	if cfg.Verify {
+		p.verifier = verify.New(cfg.VerifySamples)
+	}
+	if cfg.Dedup {
+		p.dedup = dedup.New(cfg.DedupCapacity, 0.01)
+		logger.Debugf("De-duplication uses %s for %d DOIs", humanize.Bytes(uint64(p.dedup.FilterBytes())), cfg.DedupCapacity)
+	}
+
+	counted := false
+	toCitations := func() func(*crossrefindexer.Crossref) []crossrefindexer.Citation {
+		count := !counted
+		counted = true
+		return func(pub *crossrefindexer.Crossref) []crossrefindexer.Citation {
+			citations := crossrefindexer.ToCitations(pub)
+			if count {
+				p.citationCount += len(citations)
+			}
+			return citations
+		}
+	}
+
+	if cfg.HasSink(config.SinkElastic) {
+		es := prepareElastic(ctx, cfg, logger)
+		p.store = es
+		p.sinks = append(p.sinks, newSink(config.SinkElastic, cfg.ElasticSink, fanout.Map(
+			simplify(p.verifier, transformOptions(cfg, cfg.Profile)...),
+			es.IndexPublications,
+		)))
+
+		if cfg.Citations {
+			p.sinks = append(p.sinks, newSink("citations", cfg.ElasticSink, fanout.Map(toCitations(), es.IndexCitations)))
+		}
+	}
+
+	// The same documents as for Elasticsearch, written to files to be sent later
+	if cfg.HasSink(config.SinkBulk) {
+		bulkWriter := openBulkFiles(cfg, logger)
+		p.bulkWriter = bulkWriter
+		p.sinks = append(p.sinks, newSink(config.SinkBulk, cfg.Bulk.SinkOptions, fanout.Map(
+			simplify(nil, transformOptions(cfg, cfg.Profile)...),
+			func(ctx context.Context, data chan crossrefindexer.SimplifiedPublication) error {
+				return bulkWriter.WritePublications(ctx, cfg.Elastic.IndexName, data)
+			},
+		)))
+
+		if cfg.Citations {
+			p.sinks = append(p.sinks, newSink("bulk-citations", cfg.Bulk.SinkOptions, fanout.Map(
+				toCitations(),
+				func(ctx context.Context, data chan crossrefindexer.Citation) error {
+					return bulkWriter.WriteCitations(ctx, cfg.Elastic.CitationsIndexName, data)
+				},
+			)))
+		}
+	}
+
+	if cfg.HasSink(config.SinkSQLite) {
+		db := openSQLite(cfg, logger)
+		p.closers = append(p.closers, func() { db.Close() })
+
+		sqliteVerifier := p.verifier
+		if p.store == nil {
+			p.store = db
+		} else {
+			sqliteVerifier = nil
+		}
+		p.sinks = append(p.sinks, newSink(config.SinkSQLite, cfg.SQLiteSink, fanout.Map(
+			simplify(sqliteVerifier, transformOptions(cfg, cfg.SQLiteProfile)...),
+			db.IndexPublications,
+		)))
+	}
+
+	if cfg.HasSink(config.SinkExport) {
+		encoder, err := openEncoder(cfg.Export.To, cfg.Export.Output, cfg.Export.Parquet)
+		if err != nil {
+			logger.Fatal(err)
+		}
+		p.sinks = append(p.sinks, newSink(config.SinkExport, cfg.Export.SinkOptions, fanout.Map(
+			func(pub *crossrefindexer.Crossref) []crossrefindexer.SimplifiedPublication {
+				return []crossrefindexer.SimplifiedPublication{export.Simplify(pub)}
+			},
+			encodeAll(encoder),
+		)))
+	}
+
+	return p
+}
+
+func (p *pipeline) close() {
+	for _, closeSink := range p.closers {
+		closeSink()
+	}
+}
+
+// passResult is what was indexed in a single pass
+type passResult struct {
+	count     int // Publications passed on to the sinks
+	invalid   int // Publications without a valid DOI
+	citations int
+}
+
+// index reads all the inputs in one pass and writes them to all the sinks
+func (p *pipeline) index(ctx context.Context, inputs []crossrefindexer.DataContainer) (passResult, error) {
+	logger := p.logger
+	result := passResult{}
+	citationsBefore := p.citationCount
+
+	publications := make(chan crossrefindexer.Crossref)
+	sinkGroup := fanout.Start(ctx, logger, p.sinks...)
+
+	// Reading is stopped as soon as the sinks fail, since there is nowhere to write what is read
+	readCtx, stopReading := context.WithCancel(ctx)
+	defer stopReading()
+
+	group := new(errgroup.Group)
+	group.Go(func() error {
+		return parseInputs(readCtx, logger, inputs, p.cfg.Elastic.NumWorkers, publications)
+	})
+
+	droppedBefore := 0
+	if p.dedup != nil {
+		droppedBefore = p.dedup.Dropped
+	}
+
+	// Pass on every publication that should be indexed to all the sinks
+	var sendErr error
+	for pub := range publications {
+		pub := pub
+		if sendErr != nil {
+			continue // Drain what was read before reading stopped
+		}
+
+		// Publications without a valid DOI can't be identified, so they are left out
+		doi, err := crossrefindexer.NormalizeDOI(pub.Doi)
+		if err != nil {
+			result.invalid++
+			logger.Warnw("Skipping publication", "err", err)
+			continue
+		}
+
+		if p.dedup != nil && !p.dedup.Keep(doi, pub.Indexed.Timestamp) {
+			continue
+		}
+
+		result.count++
+		if sendErr = sinkGroup.Send(ctx, &pub); sendErr != nil {
+			stopReading()
+		}
+	}
+
+	// Let the sinks finish what has been read even if reading failed, and write what is buffered for the bulk files
+	closeErr := sinkGroup.Close()
+	if sendErr == nil {
+		sendErr = closeErr
+	}
+	if p.bulkWriter != nil {
+		if err := p.bulkWriter.Close(); err != nil && sendErr == nil {
+			sendErr = fmt.Errorf("could not write bulk files: %w", err)
+		}
+	}
+	readErr := group.Wait()
+	if sendErr != nil {
+		return result, sendErr
+	}
+	if readErr != nil {
+		return result, fmt.Errorf("reading failed: %w", readErr)
+	}
+
+	result.citations = p.citationCount - citationsBefore
+	logger.Infof("Indexed %d publications from %d files successfully", result.count, len(inputs))
+	if p.cfg.Citations {
+		logger.Infof("Indexed %d citations", result.citations)
+	}
+	if result.invalid > 0 {
+		logger.Warnf("Skipped %d publications with invalid DOIs", result.invalid)
+	}
+	if p.dedup != nil {
+		logger.Infof(
+			"Dropped %d stale repeats older than an already read version. %d DOIs have occurred more than once",
+			p.dedup.Dropped-droppedBefore,
+			p.dedup.Repeated(),
+		)
+	}
+	return result, nil
+}
+
+// newSink creates a sink with the options from the command line
+func newSink(
+	name string,
+	options config.SinkOptions,
+	write func(context.Context, chan *crossrefindexer.Crossref) error,
+) fanout.Sink {
+	return fanout.Sink{Name: name, Buffer: options.Buffer, Policy: fanout.Policy(options.OnError), Write: write}
+}
+
+// transformOptions are how the publications are transformed for a sink with the profile
+func transformOptions(cfg config.Indexing, profile string) []crossrefindexer.TransformOption {
+	options := []crossrefindexer.TransformOption{}
+	if profile == "extended" {
+		options = append(options, crossrefindexer.WithExtended())
+	}
+	if cfg.FoldDiacritics {
+		options = append(options, crossrefindexer.WithFolding())
+	}
+	if cfg.Abstracts {
+		options = append(options, crossrefindexer.WithAbstract())
+	}
+	return options
+}
+
+// simplify transforms the publications for a sink and adds them to the verifier if there is one
+func simplify(
+	verifier *verify.Verifier,
+	options ...crossrefindexer.TransformOption,
+) func(*crossrefindexer.Crossref) []crossrefindexer.SimplifiedPublication {
+	return func(pub *crossrefindexer.Crossref) []crossrefindexer.SimplifiedPublication {
+		simplified := crossrefindexer.ToSimplifiedPublication(pub, options...)
+		if verifier != nil {
+			verifier.Add(simplified)
+		}
+		return []crossrefindexer.SimplifiedPublication{simplified}
+	}
+}
+
+// prepareElastic connects to the cluster, checks that it is ready and creates the indices
+func prepareElastic(
+	ctx context.Context,
+	cfg config.Indexing,
+	logger *zap.SugaredLogger,
+) *elastic.Indexer {
+	es, err := elastic.New(ctx, cfg.Elastic, logger)
+	if err != nil {
+		logger.Fatal(err)
+	}
+
+	createIndices(ctx, es, indexSettings(cfg), cfg.RemoveIndex, cfg.SkipPreflight, logger)
+	return es
+}
+
+// indexSettings are the indices to write to together with their settings
+func indexSettings(cfg config.Indexing) map[string]elastic.IndexSettings {
+	// The mapping must match how the publications are transformed
+	settingsModifiers := []func(*elastic.IndexSettings){}
+	if cfg.Profile == "extended" {
+		settingsModifiers = append(settingsModifiers, elastic.WithExtended())
+	}
+	if cfg.Abstracts {
+		settingsModifiers = append(settingsModifiers, elastic.WithAbstract(cfg.AbstractAnalyzer))
+	}
+
+	indices := map[string]elastic.IndexSettings{cfg.Elastic.IndexName: elastic.DefaultSettings(settingsModifiers...)}
+	if cfg.Citations {
+		indices[cfg.Elastic.CitationsIndexName] = elastic.CitationSettings()
+	}
+	return indices
+}
+
+// createIndices checks that the cluster is ready and creates the indices, after removing them
+// if the user has requested it
+func createIndices(
+	ctx context.Context,
+	es *elastic.Indexer,
+	indices map[string]elastic.IndexSettings,
+	removeIndex bool,
+	skipPreflight bool,
+	logger *zap.SugaredLogger,
+) {
+	indexNames := make([]string, 0, len(indices))
+	for indexName := range indices {
+		indexNames = append(indexNames, indexName)
+	}
+	sort.Strings(indexNames)
+
+	// Make sure the cluster is ready before doing anything with it
+	if !skipPreflight {
+		privileges := []string{"create_index", "index"}
+		if removeIndex {
+			privileges = append(privileges, "delete_index")
+		}
+
+		if err := es.Preflight(ctx, indexNames, privileges...); err != nil {
+			logger.Fatalf("Cluster is not ready for indexing: %v", err)
+		}
+		logger.Info("Pre-flight checks passed")
+	}
+
+	for _, indexName := range indexNames {
+		// Remove the index before starting if the user has requested it.
+		if removeIndex {
+			if err := es.DeleteIndex(ctx, indexName); err != nil {
+				logger.Fatalf("Could not delete index: %s: %v", indexName, err)
+			}
+			logger.Infof("Existing index %q removed", indexName)
+		}
+
+		// Make sure the index is created
+		if err := es.CreateIndex(ctx, indexName, indices[indexName]); err != nil {
+			logger.Fatalf("Could not create index: %s: %v", indexName, err)
+		}
+		logger.Infof("Existing index %q has been created or already exists", indexName)
+	}
+}
+
+// openSQLite opens the database to write to, after removing it if the user has requested it
+func openSQLite(cfg config.Indexing, logger *zap.SugaredLogger) *sqlite.Store {
+	if cfg.RemoveIndex {
+		if err := sqlite.Remove(cfg.SQLite.Path); err != nil {
+			logger.Fatalf("Could not remove database: %s: %v", cfg.SQLite.Path, err)
+		}
+		logger.Infof("Existing database %q removed", cfg.SQLite.Path)
+	}
+
+	db, err := sqlite.Open(cfg.SQLite, logger)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	return db
+}
+
+// openBulkFiles starts writing _bulk files together with the settings of the indices, after removing
+// the files of an earlier run if the user has requested it
+func openBulkFiles(cfg config.Indexing, logger *zap.SugaredLogger) *elastic.BulkFileWriter {
+	if cfg.RemoveIndex {
+		if err := elastic.RemoveBulkFiles(cfg.Bulk.Dir); err != nil {
+			logger.Fatalf("Could not remove bulk files: %s: %v", cfg.Bulk.Dir, err)
+		}
+		logger.Infof("Existing bulk files in %q removed", cfg.Bulk.Dir)
+	}
+
+	writer, err := elastic.NewBulkFileWriter(cfg.Bulk.Dir, cfg.Elastic.FlushBytes, logger)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	for indexName, settings := range indexSettings(cfg) {
+		if err := writer.WriteSettings(indexName, settings); err != nil {
+			logger.Fatalf("Could not write settings of %s: %v", indexName, err)
+		}
+	}
+	return writer
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/karatekaneen/crossrefindexer/config"
+	"github.com/karatekaneen/crossrefindexer/elastic"
+	"github.com/karatekaneen/crossrefindexer/lookup"
+	"github.com/karatekaneen/crossrefindexer/server"
+	"github.com/karatekaneen/crossrefindexer/sqlite"
+	"go.uber.org/zap"
+)
+
+func runLookup(ctx context.Context, cfg config.LookupCmd, logger *zap.SugaredLogger) {
+	finder, closeFinder := newFinder(ctx, cfg.Elastic, cfg.SQLitePath, logger)
+	defer closeFinder()
+
+	query := lookup.Query{
+		DOI:         cfg.DOI,
+		Biblio:      cfg.Citation,
+		Title:       cfg.Title,
+		FirstAuthor: cfg.FirstAuthor,
+		ORCID:       cfg.ORCID,
+		Journal:     cfg.Journal,
+		Volume:      cfg.Volume,
+		FirstPage:   cfg.FirstPage,
+		Year:        cfg.Year,
+	}
+
+	candidates, err := finder.Find(ctx, query, cfg.Size)
+	if err != nil {
+		logger.Fatalf("Lookup failed: %v", err)
+	}
+
+	if cfg.Output == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(candidates)
+	} else {
+		err = writeCandidates(candidates)
+	}
+	if err != nil {
+		logger.Fatalf("Could not write candidates: %v", err)
+	}
+}
+
+// newFinder looks up in the SQLite database if there is a path to it and in Elasticsearch otherwise.
+// The returned function closes the database.
+func newFinder(ctx context.Context, cfg elastic.Config, sqlitePath string, logger *zap.SugaredLogger) (server.Finder, func()) {
+	if sqlitePath != "" {
+		db, err := sqlite.Open(sqlite.Config{Path: sqlitePath}, logger)
+		if err != nil {
+			logger.Fatal(err)
+		}
+		return db, func() { db.Close() }
+	}
+
+	es, err := elastic.New(ctx, cfg, logger)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	return lookup.New(es, cfg.IndexName), func() {}
+}
+
+func writeCandidates(candidates []lookup.Candidate) error {
+	if len(candidates) == 0 {
+		fmt.Println("No candidates found")
+		return nil
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "#\tScore\tValid\tRetracted\tDOI\tYear\tFirst author\tTitle")
+	for i, c := range candidates {
+		pub := c.Publication
+		fmt.Fprintf(tw, "%d\t%.2f\t%t\t%t\t%s\t%d\t%s\t%s\n",
+			i+1, c.Score, c.Valid, pub.IsRetracted, pub.DOI, pub.Year, pub.FirstAuthor, strings.Join(pub.Title, " "),
+		)
+	}
+	return tw.Flush()
+}
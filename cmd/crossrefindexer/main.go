@@ -3,11 +3,9 @@ package main
 import (
 	"context"
 	"log"
-	"os"
 
 	"github.com/karatekaneen/crossrefindexer"
 	"github.com/karatekaneen/crossrefindexer/config"
-	"github.com/karatekaneen/crossrefindexer/elastic"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 	"golang.org/x/sync/errgroup"
@@ -45,101 +43,69 @@ func main() {
 	if err != nil {
 		log.Fatal(err)
 	}
-	logger := l.Sugar().With(
-		"file", cfg.File,
-		"dir", cfg.Dir,
-		"format", cfg.Format,
-		"compression", cfg.Compression,
-	)
+	logger := l.Sugar().With("command", cfg.Command)
 	logger.Debugln("Config loaded successfully")
 
-	es, err := elastic.New(cfg.Elastic, logger)
-	if err != nil {
-		log.Fatal(err)
+	switch cfg.Command {
+	case config.CommandIndex:
+		runIndex(ctx, cfg.Index, logger)
+	case config.CommandStats:
+		runStats(ctx, cfg.Stats, logger)
+	case config.CommandLookup:
+		runLookup(ctx, cfg.Lookup, logger)
+	case config.CommandServe:
+		runServe(ctx, cfg.Serve, logger)
+	case config.CommandExport:
+		runExport(ctx, cfg.Export, logger)
+	case config.CommandReplayBulk:
+		runReplayBulk(ctx, cfg.ReplayBulk, logger)
+	case config.CommandWatch:
+		runWatch(ctx, cfg.Watch, logger)
+	default:
+		logger.Fatalf("Unknown command %q", cfg.Command)
 	}
+}
 
-	publications := make(chan crossrefindexer.Crossref)
-	dataToIndex := make(chan crossrefindexer.SimplifiedPublication)
-
-	// LoadData. Can be file (json/gzip), dir or stdin
-	// If file: get format & compression then read data
-	// If dir: walk files, extract format, infer compression and then read as file
-	inputs, err := crossrefindexer.Load(
-		logger,
-		cfg.File,
-		cfg.Dir,
-		cfg.Format,
-		cfg.Compression,
-		os.Stdin,
+// withInput adds the input configuration to the logger
+func withInput(logger *zap.SugaredLogger, input config.Input) *zap.SugaredLogger {
+	return logger.With(
+		"file", input.File,
+		"dir", input.Dir,
+		"format", input.Format,
+		"compression", input.Compression,
 	)
-	if err != nil {
-		logger.Fatalln(err)
-	}
-
-	logger.Infof("Found %d files to process", len(inputs))
-
-	// Remove the index before starting if the user has requested it.
-	if cfg.RemoveIndex {
-		if err := es.DeleteIndex(ctx, cfg.Elastic.IndexName); err != nil {
-			logger.Fatalf("Could not delete index: %s: %w", cfg.Elastic.IndexName, err)
-		}
-		logger.Infof("Existing index %q removed", cfg.Elastic.IndexName)
-	}
+}
 
-	// Make sure the index is created
-	if err := es.CreateIndex(ctx, cfg.Elastic.IndexName, elastic.DefaultSettings()); err != nil {
-		logger.Fatalf("Could not create index: %s: %w", cfg.Elastic.IndexName, err)
-	}
-	logger.Infof("Existing index %q has been created or already exists", cfg.Elastic.IndexName)
-
-	group := new(errgroup.Group)               // Create an errgroup to manage goroutines
-	indexGroup := new(errgroup.Group)          // A group to hold the indexing
-	readGroup := new(errgroup.Group)           // A group to read the files
-	readGroup.SetLimit(cfg.Elastic.NumWorkers) // Limit the number of files to read concurrently
-
-	// Initialize the indexing
-	group.Go(func() error {
-		indexGroup.Go(func() error {
-			return es.IndexPublications(ctx, dataToIndex)
-		})
-		return indexGroup.Wait()
-	})
-
-	group.Go(func() error {
-		defer close(publications)
-
-		for index, container := range inputs {
-			container := container // Because Go is wonky
-
-			// Log progress
-			logger.Debugw("Parsing file",
-				"index", index,
-				"numberOfItems", len(inputs),
-				"path", container.Path,
-			)
-
-			// Process the file
-			readGroup.Go(func() error { return crossrefindexer.ParseData(container, publications) })
+// parseInputs reads all the inputs, at most `workers` at the time, and sends the parsed
+// publications on the `publications` channel. The channel is closed when all inputs are read.
+func parseInputs(
+	ctx context.Context,
+	logger *zap.SugaredLogger,
+	inputs []crossrefindexer.DataContainer,
+	workers int,
+	publications chan crossrefindexer.Crossref,
+) error {
+	defer close(publications)
+
+	readGroup := new(errgroup.Group) // A group to read the files
+	readGroup.SetLimit(workers)      // Limit the number of files to read concurrently
+
+	for index, container := range inputs {
+		container := container // Because Go is wonky
+		if ctx.Err() != nil {
+			break // Nobody wants the rest
 		}
 
-		return readGroup.Wait()
-	})
-
-	// Convert the data and pipe it to the indexing channel
-	count := 0
-	for {
-		pub, open := <-publications
-		if !open {
-			close(dataToIndex)
-			break
-		}
-		count++
-		dataToIndex <- crossrefindexer.ToSimplifiedPublication(&pub)
-	}
+		// Log progress
+		logger.Debugw("Parsing file",
+			"index", index,
+			"numberOfItems", len(inputs),
+			"path", container.Path,
+		)
 
-	if err := group.Wait(); err != nil {
-		logger.Fatalf("Something failed: %w", err)
+		// Process the file
+		readGroup.Go(func() error { return crossrefindexer.ParseData(ctx, container, publications) })
 	}
 
-	logger.Infof("Indexed %d publications from %d files successfully", count, len(inputs))
+	return readGroup.Wait()
 }
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"context"
+
+	"github.com/karatekaneen/crossrefindexer/config"
+	"github.com/karatekaneen/crossrefindexer/elastic"
+	"go.uber.org/zap"
+)
+
+// runReplayBulk sends the _bulk files written by the bulk sink to the cluster, after creating
+// the indices with the settings stored next to them
+func runReplayBulk(ctx context.Context, cfg config.ReplayBulkCmd, logger *zap.SugaredLogger) {
+	logger = logger.With("dir", cfg.Dir)
+
+	files, err := elastic.BulkFiles(cfg.Dir)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	if len(files) == 0 {
+		logger.Fatalf("No bulk files found in %s", cfg.Dir)
+	}
+
+	indices, err := elastic.BulkSettings(cfg.Dir)
+	if err != nil {
+		logger.Fatal(err)
+	}
+
+	es, err := elastic.New(ctx, cfg.Elastic, logger)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	createIndices(ctx, es, indices, cfg.RemoveIndex, cfg.SkipPreflight, logger)
+
+	logger.Infof("Found %d bulk files to replay", len(files))
+	if err := es.ReplayBulk(ctx, files); err != nil {
+		logger.Fatalf("Replaying bulk files failed: %v", err)
+	}
+}
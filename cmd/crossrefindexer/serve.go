@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/karatekaneen/crossrefindexer/config"
+	"github.com/karatekaneen/crossrefindexer/server"
+	"go.uber.org/zap"
+)
+
+// shutdownTimeout is how long to wait for ongoing requests when stopping
+const shutdownTimeout = 10 * time.Second
+
+func runServe(ctx context.Context, cfg config.ServeCmd, logger *zap.SugaredLogger) {
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	finder, closeFinder := newFinder(ctx, cfg.Elastic, cfg.SQLitePath, logger)
+	defer closeFinder()
+
+	srv := &http.Server{
+		Addr:              cfg.Addr,
+		Handler:           server.New(finder, logger).Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		<-ctx.Done()
+		logger.Info("Shutting down")
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			logger.Errorw("Shutdown failed", "err", err)
+		}
+	}()
+
+	if cfg.SQLitePath != "" {
+		logger.Infof("Serving lookups from database %q on %s", cfg.SQLitePath, cfg.Addr)
+	} else {
+		logger.Infof("Serving lookups from index %q on %s", cfg.Elastic.IndexName, cfg.Addr)
+	}
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		logger.Fatalf("Server failed: %v", err)
+	}
+}
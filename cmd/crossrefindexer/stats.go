@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"os"
+
+	"github.com/karatekaneen/crossrefindexer"
+	"github.com/karatekaneen/crossrefindexer/config"
+	"github.com/karatekaneen/crossrefindexer/stats"
+	"go.uber.org/zap"
+	"golang.org/x/sync/errgroup"
+)
+
+func runStats(ctx context.Context, cfg config.StatsCmd, logger *zap.SugaredLogger) {
+	logger = withInput(logger, cfg.Input)
+
+	inputs, err := crossrefindexer.Load(
+		logger,
+		cfg.File,
+		cfg.Dir,
+		cfg.Format,
+		cfg.Compression,
+		os.Stdin,
+	)
+	if err != nil {
+		logger.Fatalln(err)
+	}
+
+	logger.Infof("Found %d files to process", len(inputs))
+
+	publications := make(chan crossrefindexer.Crossref)
+
+	group := new(errgroup.Group)
+	group.Go(func() error {
+		return parseInputs(ctx, logger, inputs, cfg.Workers, publications)
+	})
+
+	collector := stats.New(cfg.Capacity)
+	for pub := range publications {
+		pub := pub
+		collector.Add(&pub)
+	}
+
+	if err := group.Wait(); err != nil {
+		logger.Fatalf("Something failed: %v", err)
+	}
+
+	report := collector.Report(cfg.Top)
+	if cfg.Output == "json" {
+		err = report.WriteJSON(os.Stdout)
+	} else {
+		err = report.WriteTable(os.Stdout)
+	}
+	if err != nil {
+		logger.Fatalf("Could not write statistics: %v", err)
+	}
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/karatekaneen/crossrefindexer"
+	"github.com/karatekaneen/crossrefindexer/config"
+	"github.com/karatekaneen/crossrefindexer/watch"
+	"go.uber.org/zap"
+)
+
+// runWatch indexes every new file in the directory once, until it is stopped
+func runWatch(ctx context.Context, cfg config.WatchCmd, logger *zap.SugaredLogger) {
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	logger = logger.With("dir", cfg.Dir)
+
+	watcher, err := watch.New(cfg.Dir, cfg.Watch, logger)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	logger.Infof("%d files have already been processed", len(watcher.Processed()))
+
+	// The sinks are opened once and written to in a pass for every file
+	p := newPipeline(ctx, cfg.Indexing, logger)
+	defer p.close()
+
+	err = watcher.Run(ctx, func(ctx context.Context, path string) error {
+		inputs, err := crossrefindexer.Load(logger, path, "", cfg.Format, cfg.Compression, nil)
+		if err != nil {
+			return err
+		}
+		_, err = p.index(ctx, inputs)
+		return err
+	})
+	if err != nil {
+		logger.Fatalf("Watching failed: %v", err)
+	}
+	logger.Info("Stopped watching")
+}
@@ -2,27 +2,176 @@ package config
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/alecthomas/kong"
 	"github.com/karatekaneen/crossrefindexer"
 	"github.com/karatekaneen/crossrefindexer/elastic"
+	"github.com/karatekaneen/crossrefindexer/sqlite"
+	"github.com/karatekaneen/crossrefindexer/watch"
 )
 
-const description = `Small CLI application to uncompress and index Crossref metadata. 
+const description = `Small CLI application to uncompress and index Crossref metadata.
 It can read from file, directories and stdin.
 It supports both compressed (gzip only at the time of writing) and raw JSON/NDJSON.`
 
+// Names of the available commands as returned by Config.Command
+const (
+	CommandIndex      = "index"
+	CommandStats      = "stats"
+	CommandLookup     = "lookup"
+	CommandServe      = "serve"
+	CommandExport     = "export"
+	CommandReplayBulk = "replay-bulk"
+	CommandWatch      = "watch"
+)
+
+// Where the index command can write the publications
+const (
+	SinkElastic = "elastic"
+	SinkSQLite  = "sqlite"
+	SinkExport  = "export"
+	SinkBulk    = "bulk"
+)
+
 type Config struct {
-	RemoveIndex bool                   `help:"Remove existing index before starting. WARNING - you will not get any confirmation prompt"                                                            default:"false"`
+	Index      IndexCmd      `help:"Index Crossref metadata into Elasticsearch. This is the default command" cmd:"" default:"withargs"`
+	Stats      StatsCmd      `help:"Print aggregated statistics about Crossref metadata"                     cmd:""`
+	Lookup     LookupCmd     `help:"Look up a reference in the index the same way as Biblio-Glutton"         cmd:""`
+	Serve      ServeCmd      `help:"Serve lookups over HTTP with the same API as Biblio-Glutton"             cmd:""`
+	Export     ExportCmd     `help:"Export Crossref metadata as CSL-JSON, BibTeX or RIS"                     cmd:""`
+	ReplayBulk ReplayBulkCmd `help:"Send _bulk files written by the bulk sink to Elasticsearch"              cmd:""`
+	Watch      WatchCmd      `help:"Index new files as they arrive in a directory until stopped"             cmd:""`
+	LogLevel   string        `help:"Log verbosity. Can be debug, info, warn, error"                          default:"info" name:"loglevel"`
+
+	Command string `kong:"-"` // The command that was selected on the command line
+}
+
+// Input describes where to read the Crossref data from. It is shared by all commands that read data.
+type Input struct {
 	File        string                 `help:"Absolute or relative path to a single file to index. If you set to '-' it will read from stdin"                                                                         short:"f" optional:"" type:"existingfile"`
 	Dir         string                 `help:"Absolute or relative path to a directory containing files to index"                                                                                                               optional:"" type:"existingdir"`
-	Elastic     elastic.Config         `help:"Configuration for elasticsearch connection and indexing"                                                                                                                          optional:""                     embed:"" prefix:"es."`
 	Format      crossrefindexer.Format `help:"The format of the uncompressed files. Will try to detect if not provided but is required if using stdin. Can be json, ndjson or unknown"              default:"unknown"           optional:""                                           enum:"unknown,json,ndjson"`
 	Compression string                 `help:"How the data file is compressed. For files it will use the file extension if not provided. For dirs it will be ignored. Can be unknown, none or gzip" default:"unknown" short:"c"                                                       enum:"unknown,none,gzip"`
-	LogLevel    string                 `help:"Log verbosity. Can be debug, info, warn, error"                                                                                                       default:"info"                                                                                               name:"loglevel"`
 }
 
-type configValidator func(Config) error
+type IndexCmd struct {
+	Indexing `embed:""`
+	Input    `embed:""`
+}
+
+// Indexing is where and how the publications are indexed. It is shared by the commands that index.
+type Indexing struct {
+	Sinks            []string       `help:"Where to write the publications. Several sinks are written in the same pass. Can be elastic, sqlite, export or bulk" name:"sink" default:"elastic" enum:"elastic,sqlite,export,bulk"`
+	RemoveIndex      bool           `help:"Remove existing index before starting. WARNING - you will not get any confirmation prompt" default:"false"`
+	SkipPreflight    bool           `help:"Skip checking cluster health, version, disk space and privileges before starting"          default:"false"`
+	Citations        bool           `help:"Also index an edge for every reference with a DOI into the citations index"              default:"false"`
+	Profile          string         `help:"Document profile. extended adds ISSN, publisher, type, subject, URL, license and deposited and indexed times" enum:"minimal,extended" default:"minimal"`
+	FoldDiacritics   bool           `help:"Remove diacritics from titles, journals and the bibliographic string, so Körper becomes Korper" default:"false"`
+	Abstracts        bool           `help:"Index abstracts as plain text. Greatly increases the size of the index"             default:"false"`
+	AbstractAnalyzer string         `help:"Language analyzer for abstracts, like english, german or standard"                  default:"english"`
+	Verify           bool           `help:"Compare the index with what was processed when done and fail on mismatch. Uses 8 bytes of memory per publication" default:"false"`
+	VerifySamples    int            `help:"Number of random publications to compare with the stored documents when verifying"       default:"100"`
+	Dedup            bool           `help:"Drop stale repeats, which are publications older than an already read version of the DOI. Only Elasticsearch and SQLite keep just the newest version, export and bulk get every version" default:"false" negatable:""`
+	DedupCapacity    int            `help:"Number of unique DOIs to size the de-duplication for. More uses extra memory"            default:"150000000"`
+	Elastic          elastic.Config `help:"Configuration for elasticsearch connection and indexing"                                  optional:"" embed:"" prefix:"es."`
+	ElasticSink      SinkOptions    `help:"How publications are passed to Elasticsearch"                                              embed:"" prefix:"es."`
+	SQLite           sqlite.Config  `help:"Configuration for the SQLite database"                                                     optional:"" embed:"" prefix:"sqlite."`
+	SQLiteSink       SinkOptions    `help:"How publications are passed to SQLite"                                                     embed:"" prefix:"sqlite."`
+	SQLiteProfile    string         `help:"Document profile of the SQLite database. Can be minimal or extended"                      name:"sqlite.profile" default:"minimal" enum:"minimal,extended"`
+	Export           ExportSink     `help:"Configuration for exporting to a file in the same pass"                                    embed:"" prefix:"export."`
+	Bulk             BulkSink       `help:"Configuration for writing _bulk request files to send to Elasticsearch later"              embed:"" prefix:"bulk."`
+}
+
+// SinkOptions are how the publications are passed to a sink when writing to several in the same pass
+type SinkOptions struct {
+	Buffer  int    `help:"Number of publications to queue for the sink. A full queue holds back the other sinks" default:"1000"`
+	OnError string `help:"What to do if the sink fails. fail stops the pass, continue keeps writing to the other sinks" default:"fail" enum:"fail,continue"`
+}
+
+// Parquet is how Parquet files are written
+type Parquet struct {
+	Profile            string `help:"Columns to write to parquet. extended adds ISSN, publisher, type, subject, URL, license and abstract" default:"minimal" enum:"minimal,extended"`
+	ParquetCompression string `help:"Compression of the parquet columns. Can be none, snappy, gzip or zstd"       default:"zstd"     enum:"none,snappy,gzip,zstd"`
+	ParquetRowGroup    int    `help:"Number of rows in each parquet row group"                                    default:"100000"`
+	ParquetFileBytes   int64  `help:"Start a new parquet file when the current one is larger than this"          default:"536870912"`
+}
+
+// ExportSink is a file export written while indexing
+type ExportSink struct {
+	To          string `help:"Format to export to. Can be csl-json, bibtex, ris or parquet"                 default:"csl-json" enum:"csl-json,bibtex,ris,parquet"`
+	Output      string `help:"File to write to, or directory for parquet. Writes to stdout if not set"     optional:"" type:"path"`
+	Parquet     `embed:""`
+	SinkOptions `embed:""`
+}
+
+// BulkSink writes the Elasticsearch documents to _bulk request files of --es.flushbytes each
+type BulkSink struct {
+	Dir         string `help:"Directory to write the _bulk request files to"                                  optional:"" type:"path"`
+	SinkOptions `embed:""`
+}
+
+type StatsCmd struct {
+	Input    `embed:""`
+	Workers  int    `help:"Number of files to read concurrently"                                    default:"4"`
+	Top      int    `help:"Number of entries to show for publishers and members"                  default:"20"`
+	Capacity int    `help:"Number of publishers and members to track. Higher is more accurate"    default:"1000"`
+	Output   string `help:"How to print the statistics. Can be table or json"                     default:"table" short:"o" enum:"table,json"`
+}
+
+type LookupCmd struct {
+	Citation    string         `help:"Raw citation string to look up"                                                  arg:"" optional:""`
+	DOI         string         `help:"DOI of the publication"                                                          name:"doi"`
+	Title       string         `help:"Title of the article"`
+	FirstAuthor string         `help:"Last name of the first author"                                                   name:"author"`
+	ORCID       string         `help:"ORCID iD of one of the authors"                                                  name:"orcid"`
+	Journal     string         `help:"Title of the journal"`
+	Volume      string         `help:"Volume of the journal"`
+	FirstPage   string         `help:"First page of the article"                                                      name:"first-page"`
+	Year        int            `help:"Publication year"`
+	Size        int            `help:"Number of candidates to show"                                                   default:"5" short:"n"`
+	Output      string         `help:"How to print the candidates. Can be table or json"                              default:"table" short:"o" enum:"table,json"`
+	SQLitePath  string         `help:"Look up in this SQLite database instead of Elasticsearch"                        name:"sqlite.path" optional:"" type:"existingfile"`
+	Elastic     elastic.Config `help:"Configuration for elasticsearch connection"                                     optional:"" embed:"" prefix:"es."`
+}
+
+type ServeCmd struct {
+	Addr       string         `help:"Address to listen on"                                                          default:":8080"`
+	SQLitePath string         `help:"Serve lookups from this SQLite database instead of Elasticsearch"               name:"sqlite.path" optional:"" type:"existingfile"`
+	Elastic    elastic.Config `help:"Configuration for elasticsearch connection"                                   optional:"" embed:"" prefix:"es."`
+}
+
+type ExportCmd struct {
+	Input         `embed:""`
+	To            string   `help:"Format to export to. Can be csl-json, bibtex, ris or parquet"                 default:"csl-json" enum:"csl-json,bibtex,ris,parquet"`
+	Output        string   `help:"File to write to, or directory for parquet. Writes to stdout if not set"     short:"o" optional:"" type:"path"`
+	Workers       int      `help:"Number of files to read concurrently"                                        default:"4"`
+	Types         []string `help:"Only export these Crossref types, like journal-article"                      name:"type"`
+	Prefixes      []string `help:"Only export DOIs with these prefixes, like 10.1002"                          name:"prefix"`
+	ISSNs         []string `help:"Only export publications with one of these ISSNs"                            name:"issn"`
+	Members       []string `help:"Only export publications of these Crossref members"                         name:"member"`
+	FromYear      int      `help:"Only export publications from this year or later"`
+	ToYear        int      `help:"Only export publications from this year or earlier"`
+	SkipRetracted bool     `help:"Leave out publications that have been retracted, withdrawn or removed"       default:"false"`
+	Parquet       `embed:""`
+}
+
+type ReplayBulkCmd struct {
+	Dir           string         `help:"Directory with the files written by the bulk sink"                                     arg:"" type:"existingdir"`
+	RemoveIndex   bool           `help:"Remove existing indices before starting. WARNING - you will not get any confirmation prompt" default:"false"`
+	SkipPreflight bool           `help:"Skip checking cluster health, version, disk space and privileges before starting"      default:"false"`
+	Elastic       elastic.Config `help:"Configuration for elasticsearch connection and indexing"                               optional:"" embed:"" prefix:"es."`
+}
+
+type WatchCmd struct {
+	Dir         string                 `help:"Directory to watch for new files"                                                 arg:"" type:"existingdir"`
+	Format      crossrefindexer.Format `help:"The format of the uncompressed files. Will try to detect if not provided. Can be json, ndjson or unknown" default:"unknown" enum:"unknown,json,ndjson"`
+	Compression string                 `help:"How the files are compressed. Uses the file extension if not provided. Can be unknown, none or gzip"      default:"unknown" enum:"unknown,none,gzip" short:"c"`
+	Watch       watch.Config           `help:"How to watch the directory"                                                        embed:"" prefix:"watch."`
+	Indexing    `embed:""`
+}
+
+type configValidator func(Input) error
 
 func Load() *Config {
 	c := Config{}
@@ -40,10 +189,39 @@ func Load() *Config {
 		ctx.Fatalf("config validation failed: %v", err)
 	}
 
-	for _, validator := range []configValidator{hasPath, hasFormat, hasCompression} {
-		if err := validator(c); err != nil {
-			//nolint:errcheck
-			ctx.PrintUsage(false)
+	c.Command, _, _ = strings.Cut(ctx.Command(), " ")
+
+	// Only validate the input for the commands that read data
+	var input *Input
+	switch c.Command {
+	case CommandIndex:
+		input = &c.Index.Input
+	case CommandStats:
+		input = &c.Stats.Input
+	case CommandExport:
+		input = &c.Export.Input
+	}
+
+	if input != nil {
+		for _, validator := range []configValidator{hasPath, hasFormat, hasCompression} {
+			if err := validator(*input); err != nil {
+				//nolint:errcheck
+				ctx.PrintUsage(false)
+				ctx.Fatalf("config validation failed: %v", err)
+			}
+		}
+	}
+
+	switch c.Command {
+	case CommandIndex:
+		if err := validSinks(c.Index.Indexing); err != nil {
+			ctx.Fatalf("config validation failed: %v", err)
+		}
+	case CommandWatch:
+		if err := validSinks(c.Watch.Indexing); err != nil {
+			ctx.Fatalf("config validation failed: %v", err)
+		}
+		if err := watchable(c.Watch.Indexing); err != nil {
 			ctx.Fatalf("config validation failed: %v", err)
 		}
 	}
@@ -51,21 +229,59 @@ func Load() *Config {
 	return &c
 }
 
-func hasPath(c Config) error {
+// validSinks checks that every sink has what it needs
+func validSinks(c Indexing) error {
+	switch {
+	case c.HasSink(SinkSQLite) && c.SQLite.Path == "":
+		return fmt.Errorf("sqlite.path must be provided when writing to sqlite")
+	case c.HasSink(SinkBulk) && c.Bulk.Dir == "":
+		return fmt.Errorf("bulk.dir must be provided when writing to bulk")
+	case c.Citations && !c.HasSink(SinkElastic) && !c.HasSink(SinkBulk):
+		return fmt.Errorf("citations can only be indexed into Elasticsearch")
+	case c.Verify && !c.HasSink(SinkElastic) && !c.HasSink(SinkSQLite):
+		return fmt.Errorf("verify needs an elastic or sqlite sink")
+	}
+	return nil
+}
+
+// watchable checks that the indexing can be done once for every file
+func watchable(c Indexing) error {
+	switch {
+	case c.HasSink(SinkExport):
+		return fmt.Errorf("export writes a single file and can't be used when watching")
+	case c.Verify:
+		return fmt.Errorf("verify can't be used when watching")
+	case c.RemoveIndex:
+		return fmt.Errorf("remove-index can't be used when watching")
+	}
+	return nil
+}
+
+// HasSink tells if the publications should be written to the sink
+func (c Indexing) HasSink(sink string) bool {
+	for _, s := range c.Sinks {
+		if s == sink {
+			return true
+		}
+	}
+	return false
+}
+
+func hasPath(c Input) error {
 	if c.Dir == "" && c.File == "" {
 		return fmt.Errorf("Either dir or file must be provided")
 	}
 	return nil
 }
 
-func hasFormat(c Config) error {
+func hasFormat(c Input) error {
 	if c.Format == "unknown" && c.File == "-" {
 		return fmt.Errorf("Format must be specified when reading from stdin")
 	}
 	return nil
 }
 
-func hasCompression(c Config) error {
+func hasCompression(c Input) error {
 	if c.Compression == "unknown" && c.File == "-" {
 		return fmt.Errorf("Compression must be specified when reading from stdin")
 	}
@@ -2,6 +2,7 @@ package crossrefindexer
 
 import (
 	"compress/gzip"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -36,7 +37,8 @@ func (d *DataContainer) Valid() error {
 
 // readJsonData consumes the reader of uncompressed data.
 // Supports both regular json and newline delimited json (ndjson)
-func readJsonData(r io.Reader, ch chan Crossref, format Format) error {
+// Stops with the error of the context if it is cancelled.
+func readJsonData(ctx context.Context, r io.Reader, ch chan Crossref, format Format) error {
 	d := json.NewDecoder(r)
 
 	// The json format is quite nested so we need to skip
@@ -62,14 +64,19 @@ func readJsonData(r io.Reader, ch chan Crossref, format Format) error {
 			return errors.Wrapf(err, "failed on parsing element %d", elementIndex)
 		}
 
-		ch <- publication
+		select {
+		case ch <- publication:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
 		elementIndex++
 	}
 	return nil
 }
 
 // ParseData reads the data described in the container and passes it via the out channel
-func ParseData(container DataContainer, out chan Crossref) error {
+// until everything is read or the context is cancelled
+func ParseData(ctx context.Context, container DataContainer, out chan Crossref) error {
 	// Declare the variables so that we don't shadow them
 	var (
 		rawData, data io.ReadCloser
@@ -95,7 +102,7 @@ func ParseData(container DataContainer, out chan Crossref) error {
 	}
 	defer data.Close() // Close the gzipped data as well.
 
-	if err := readJsonData(data, out, container.Format); err != nil {
+	if err := readJsonData(ctx, data, out, container.Format); err != nil {
 		return fmt.Errorf(
 			"err with parsing data of type %q and format %q: %w",
 			container.Format,
@@ -151,22 +158,29 @@ func Load(
 	}
 }
 
+// acceptedExtensions are the extensions of the files that are read from directories
+var acceptedExtensions = map[string]struct{}{
+	".gzip":   {},
+	".ndjson": {},
+	".json":   {},
+	".gz":     {},
+}
+
+// IsDataFile tells if the file has the extension of a file that is read when indexing a directory
+func IsDataFile(path string) bool {
+	_, accepted := acceptedExtensions[filepath.Ext(path)]
+	return accepted
+}
+
 func listFiles(root string) ([]string, error) {
 	files := []string{}
 
-	acceptedExtensions := map[string]struct{}{
-		".gzip":   {},
-		".ndjson": {},
-		".json":   {},
-		".gz":     {},
-	}
-
 	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
 
-		if _, accepted := acceptedExtensions[filepath.Ext(path)]; !info.IsDir() && accepted {
+		if !info.IsDir() && IsDataFile(path) {
 			files = append(files, path)
 		}
 
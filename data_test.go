@@ -1,6 +1,8 @@
 package crossrefindexer
 
 import (
+	"context"
+	"errors"
 	"io"
 	"log"
 	"strings"
@@ -273,7 +275,7 @@ func Test_ParseData(t *testing.T) {
 				}
 			}()
 
-			err := ParseData(tt.input, ch)
+			err := ParseData(context.Background(), tt.input, ch)
 			if tt.wantErr {
 				is.True(err != nil)
 				return
@@ -286,3 +288,18 @@ func Test_ParseData(t *testing.T) {
 		})
 	}
 }
+
+func Test_ParseDataCancelled(t *testing.T) {
+	is := is.New(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// Nobody reads the channel, so parsing can only stop because of the context
+	err := ParseData(ctx, DataContainer{
+		Data:        strings.NewReader(`{"DOI":"10.1000/a"}` + "\n" + `{"DOI":"10.1000/b"}` + "\n"),
+		Format:      FormatNDJSON,
+		Compression: "none",
+	}, make(chan Crossref))
+	is.True(errors.Is(err, context.Canceled))
+}
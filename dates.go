@@ -0,0 +1,81 @@
+package crossrefindexer
+
+import (
+	"fmt"
+	"time"
+)
+
+// Precision of a PartialDate
+const (
+	PrecisionYear  = "year"
+	PrecisionMonth = "month"
+	PrecisionDay   = "day"
+)
+
+// Years outside of this range are not valid ISO 8601 calendar years without an explicit sign
+const (
+	minYear = 1
+	maxYear = 9999
+)
+
+// PartialDate is an ISO 8601 date that is only as precise as what is known, like 2006, 2006-02 or 2006-02-27
+type PartialDate struct {
+	Date      string `json:"date"`
+	Precision string `json:"precision"`
+}
+
+// PublicationDates are the dates of a publication that are known
+type PublicationDates struct {
+	Issued          *PartialDate `json:"issued,omitempty"`
+	PublishedPrint  *PartialDate `json:"published_print,omitempty"`
+	PublishedOnline *PartialDate `json:"published_online,omitempty"`
+	Created         *PartialDate `json:"created,omitempty"`
+}
+
+// NormalizeDate turns the first of the Crossref date-parts into a PartialDate.
+// Month and day are left out if they are missing or out of range, and nil is returned if there is no year
+// or if it cannot be written with four digits, like the 20016 that sometimes shows up in Crossref.
+func NormalizeDate(dp [][]int) *PartialDate {
+	if len(dp) < 1 || len(dp[0]) < 1 || dp[0][0] < minYear || dp[0][0] > maxYear {
+		return nil
+	}
+
+	parts := dp[0]
+	year := parts[0]
+	if len(parts) < 2 || parts[1] < 1 || parts[1] > 12 {
+		return &PartialDate{Date: fmt.Sprintf("%04d", year), Precision: PrecisionYear}
+	}
+
+	month := parts[1]
+	if len(parts) < 3 || !validDay(year, month, parts[2]) {
+		return &PartialDate{Date: fmt.Sprintf("%04d-%02d", year, month), Precision: PrecisionMonth}
+	}
+
+	return &PartialDate{Date: fmt.Sprintf("%04d-%02d-%02d", year, month, parts[2]), Precision: PrecisionDay}
+}
+
+// validDay checks that the day exists in the month, which time.Date would otherwise silently roll over
+func validDay(year, month, day int) bool {
+	if day < 1 {
+		return false
+	}
+	return time.Date(year, time.Month(month), day, 0, 0, 0, 0, time.UTC).Day() == day
+}
+
+func publicationDates(pub *Crossref) *PublicationDates {
+	dates := PublicationDates{
+		Issued:  NormalizeDate(pub.Issued.DateParts),
+		Created: NormalizeDate(pub.Created.DateParts),
+	}
+	if pub.PublishedPrint != nil {
+		dates.PublishedPrint = NormalizeDate(pub.PublishedPrint.DateParts)
+	}
+	if pub.PublishedOnline != nil {
+		dates.PublishedOnline = NormalizeDate(pub.PublishedOnline.DateParts)
+	}
+
+	if dates == (PublicationDates{}) {
+		return nil
+	}
+	return &dates
+}
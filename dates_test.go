@@ -0,0 +1,51 @@
+package crossrefindexer
+
+import (
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+func Test_NormalizeDate(t *testing.T) {
+	tests := []struct {
+		name string
+		dp   [][]int
+		want *PartialDate
+	}{
+		{name: "full date", dp: [][]int{{2006, 2, 7}}, want: &PartialDate{Date: "2006-02-07", Precision: PrecisionDay}},
+		{name: "year and month", dp: [][]int{{2006, 2}}, want: &PartialDate{Date: "2006-02", Precision: PrecisionMonth}},
+		{name: "year", dp: [][]int{{2006}}, want: &PartialDate{Date: "2006", Precision: PrecisionYear}},
+		{name: "invalid month", dp: [][]int{{2006, 13, 1}}, want: &PartialDate{Date: "2006", Precision: PrecisionYear}},
+		{name: "invalid day", dp: [][]int{{2006, 2, 30}}, want: &PartialDate{Date: "2006-02", Precision: PrecisionMonth}},
+		{name: "leap day", dp: [][]int{{2004, 2, 29}}, want: &PartialDate{Date: "2004-02-29", Precision: PrecisionDay}},
+		{name: "null year", dp: [][]int{{0}}, want: nil},
+		{name: "five digit year", dp: [][]int{{20016, 1, 1}}, want: nil},
+		{name: "negative year", dp: [][]int{{-1}}, want: nil},
+		{name: "empty", dp: [][]int{{}}, want: nil},
+		{name: "missing", dp: nil, want: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			is := is.New(t)
+			is.Equal(NormalizeDate(tt.dp), tt.want)
+		})
+	}
+}
+
+func Test_PublishedDate(t *testing.T) {
+	is := is.New(t)
+
+	// Issued takes precedence like for the year, even if published online is more precise
+	pub := generateCrossref(func(cr *Crossref) {
+		cr.Issued = DateParts{DateParts: [][]int{{2006}}}
+		cr.PublishedOnline = &DateParts{DateParts: [][]int{{2005, 12, 1}}}
+	})
+	simplified := ToSimplifiedPublication(pub)
+	is.Equal(simplified.PublishedDate, &PartialDate{Date: "2006", Precision: PrecisionYear})
+	is.Equal(simplified.Dates.PublishedOnline, &PartialDate{Date: "2005-12-01", Precision: PrecisionDay})
+
+	pub.Issued = DateParts{}
+	is.Equal(ToSimplifiedPublication(pub).PublishedDate, &PartialDate{Date: "2005-12-01", Precision: PrecisionDay})
+	is.Equal(ToSimplifiedPublication(pub).Year, 2005)
+}
@@ -0,0 +1,58 @@
+package dedup
+
+import "math"
+
+// bloomFilter tells if a hash has probably been added before. It never forgets a hash
+// but can claim to have seen one that it hasn't, at the false positive rate it was sized for.
+type bloomFilter struct {
+	bits   []uint64
+	size   uint64 // Number of bits
+	hashes int    // Number of bits set per hash
+}
+
+// newBloomFilter sizes the filter to hold `expected` hashes at the false positive rate
+func newBloomFilter(expected int, falsePositiveRate float64) *bloomFilter {
+	if expected < 1 {
+		expected = 1
+	}
+	if falsePositiveRate <= 0 || falsePositiveRate >= 1 {
+		falsePositiveRate = 0.01
+	}
+
+	// The optimal sizes from https://en.wikipedia.org/wiki/Bloom_filter#Optimal_number_of_hash_functions
+	size := uint64(math.Ceil(-float64(expected) * math.Log(falsePositiveRate) / (math.Ln2 * math.Ln2)))
+	size = (size + 63) / 64 * 64
+	hashes := int(math.Round(float64(size) / float64(expected) * math.Ln2))
+	if hashes < 1 {
+		hashes = 1
+	}
+
+	return &bloomFilter{
+		bits:   make([]uint64, size/64),
+		size:   size,
+		hashes: hashes,
+	}
+}
+
+// testAndAdd adds the hash and returns if it was probably there already
+func (b *bloomFilter) testAndAdd(h uint64) bool {
+	// Double hashing derives all the bit positions from one hash, see Kirsch and Mitzenmacher
+	step := h>>33 | 1
+
+	present := true
+	for i := 0; i < b.hashes; i++ {
+		bit := (h + uint64(i)*step) % b.size
+		word, mask := bit/64, uint64(1)<<(bit%64)
+		if b.bits[word]&mask == 0 {
+			present = false
+			b.bits[word] |= mask
+		}
+	}
+
+	return present
+}
+
+// bytes is the memory used by the filter
+func (b *bloomFilter) bytes() int {
+	return len(b.bits) * 8
+}
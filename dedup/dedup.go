@@ -0,0 +1,70 @@
+// Package dedup drops stale repeats of a DOI, which are publications older than a version of the DOI that has
+// already been seen. It does not guarantee that only the newest version is passed on, which is left to the
+// version of the documents in the index.
+package dedup
+
+import (
+	"hash/maphash"
+)
+
+// Deduplicator remembers every DOI in a Bloom filter so that 150M DOIs fit in a couple of hundred MB.
+// The timestamps are only kept for the DOIs seen more than once, which are few.
+//
+// The first time a DOI is seen its timestamp is not stored, so when it shows up again it is not known
+// which of them is newer and both are kept. The index uses the timestamp as the document version
+// to keep the newest. Only publications that are known to be older than one already seen are dropped.
+// A false positive in the filter costs an entry in the timestamp map, never a dropped publication.
+//
+// It is not safe for concurrent use.
+type Deduplicator struct {
+	seed   maphash.Seed
+	seen   *bloomFilter
+	newest map[uint64]int64 // Newest timestamp of DOIs seen more than once
+
+	Kept    int // Publications that should be indexed
+	Dropped int // Stale repeats dropped because a newer version was seen before. Not every duplicate is counted
+}
+
+// New creates a deduplicator sized for the expected number of unique DOIs.
+// More DOIs than expected only makes it use more memory.
+func New(expected int, falsePositiveRate float64) *Deduplicator {
+	return &Deduplicator{
+		seed:   maphash.MakeSeed(),
+		seen:   newBloomFilter(expected, falsePositiveRate),
+		newest: map[uint64]int64{},
+	}
+}
+
+// Keep tells if the publication with the DOI and timestamp should be indexed.
+// The DOI should be normalized so that different spellings of it are the same.
+func (d *Deduplicator) Keep(doi string, timestamp int64) bool {
+	h := maphash.String(d.seed, doi)
+
+	if newest, ok := d.newest[h]; ok {
+		if timestamp < newest {
+			d.Dropped++
+			return false
+		}
+		d.newest[h] = timestamp
+		d.Kept++
+		return true
+	}
+
+	if d.seen.testAndAdd(h) {
+		// Probably seen before but without a timestamp, so start keeping track of it
+		d.newest[h] = timestamp
+	}
+
+	d.Kept++
+	return true
+}
+
+// Repeated is how many DOIs have been seen more than once, including false positives
+func (d *Deduplicator) Repeated() int {
+	return len(d.newest)
+}
+
+// FilterBytes is the memory used by the Bloom filter
+func (d *Deduplicator) FilterBytes() int {
+	return d.seen.bytes()
+}
@@ -0,0 +1,92 @@
+package dedup
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+func TestKeep(t *testing.T) {
+	type record struct {
+		doi       string
+		timestamp int64
+		want      bool
+	}
+
+	tests := []struct {
+		name        string
+		records     []record
+		wantDropped int
+	}{
+		{
+			name: "unique DOIs are kept",
+			records: []record{
+				{doi: "10.1000/a", timestamp: 1, want: true},
+				{doi: "10.1000/b", timestamp: 1, want: true},
+			},
+		},
+		{
+			name: "newer versions are kept",
+			records: []record{
+				{doi: "10.1000/a", timestamp: 1, want: true},
+				{doi: "10.1000/a", timestamp: 2, want: true},
+				{doi: "10.1000/a", timestamp: 3, want: true},
+			},
+		},
+		{
+			name: "older than a repeated DOI is dropped",
+			records: []record{
+				{doi: "10.1000/a", timestamp: 1, want: true},
+				{doi: "10.1000/a", timestamp: 3, want: true},
+				{doi: "10.1000/a", timestamp: 2, want: false},
+			},
+			wantDropped: 1,
+		},
+		{
+			// The timestamp of the first is not known so it is up to the index to keep the newest
+			name: "older second version is kept",
+			records: []record{
+				{doi: "10.1000/a", timestamp: 3, want: true},
+				{doi: "10.1000/a", timestamp: 1, want: true},
+			},
+		},
+		{
+			name: "same timestamp is kept",
+			records: []record{
+				{doi: "10.1000/a", timestamp: 1, want: true},
+				{doi: "10.1000/a", timestamp: 1, want: true},
+				{doi: "10.1000/a", timestamp: 1, want: true},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			is := is.New(t)
+
+			d := New(100, 0.01)
+			for _, r := range tt.records {
+				is.Equal(d.Keep(r.doi, r.timestamp), r.want) // Unexpected outcome for record
+			}
+
+			is.Equal(d.Dropped, tt.wantDropped)
+			is.Equal(d.Kept, len(tt.records)-tt.wantDropped)
+		})
+	}
+}
+
+func TestFalsePositives(t *testing.T) {
+	is := is.New(t)
+
+	const expected = 100_000
+	d := New(expected, 0.01)
+	for n := 0; n < expected; n++ {
+		is.True(d.Keep(fmt.Sprintf("10.1000/%d", n), 1)) // Unique DOIs must never be dropped
+	}
+
+	// Every repeated DOI here is a false positive of the filter
+	rate := float64(d.Repeated()) / expected
+	is.True(rate < 0.02)                       // False positive rate should be close to what it was sized for
+	is.True(d.FilterBytes() < expected*10/8+8) // About 9.6 bits per DOI at 1%
+}
@@ -0,0 +1,51 @@
+package crossrefindexer
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// ErrInvalidDOI is returned for DOIs that don't follow the syntax 10.<registrant>/<suffix>
+var ErrInvalidDOI = errors.New("invalid DOI")
+
+// doiPrefixes are the forms a DOI is commonly written in, checked in order after lowercasing
+var doiPrefixes = []string{
+	"https://doi.org/",
+	"http://doi.org/",
+	"https://dx.doi.org/",
+	"http://dx.doi.org/",
+	"doi.org/",
+	"doi:",
+}
+
+// doiSyntax is a directory indicator of 10, a registrant code that can have subdivisions and a suffix
+var doiSyntax = regexp.MustCompile(`^10\.\d{4,9}(\.\d+)*/\S+$`)
+
+// NormalizeDOI returns the canonical form of a DOI: trimmed, lowercased and without URL or "doi:" prefix.
+// DOIs are case insensitive so this is what should be used to identify a publication.
+// The normalized DOI is returned as far as it could be normalized also when it is invalid.
+func NormalizeDOI(doi string) (string, error) {
+	normalized := strings.ToLower(strings.TrimSpace(doi))
+
+	for _, prefix := range doiPrefixes {
+		if rest, found := strings.CutPrefix(normalized, prefix); found {
+			// DOIs in URLs can be percent encoded
+			if strings.Contains(prefix, "/") {
+				if unescaped, err := url.PathUnescape(rest); err == nil {
+					rest = unescaped
+				}
+			}
+			normalized = strings.TrimSpace(rest)
+			break
+		}
+	}
+
+	if !doiSyntax.MatchString(normalized) {
+		return normalized, fmt.Errorf("%w: %q", ErrInvalidDOI, doi)
+	}
+
+	return normalized, nil
+}
@@ -0,0 +1,47 @@
+package crossrefindexer
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+func Test_NormalizeDOI(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    string
+		wantErr bool
+	}{
+		{name: "already normalized", input: "10.1002/andp.19053220607", want: "10.1002/andp.19053220607"},
+		{name: "uppercase", input: "10.1002/ANDP.19053220607", want: "10.1002/andp.19053220607"},
+		{name: "surrounding whitespace", input: "  10.1000/abc\n", want: "10.1000/abc"},
+		{name: "https url", input: "https://doi.org/10.1000/ABC", want: "10.1000/abc"},
+		{name: "dx url", input: "http://dx.doi.org/10.1000/abc", want: "10.1000/abc"},
+		{name: "percent encoded url", input: "https://doi.org/10.1000/a%3Cb%3E", want: "10.1000/a<b>"},
+		{name: "doi prefix", input: "doi:10.1000/abc", want: "10.1000/abc"},
+		{name: "doi prefix with space", input: "DOI: 10.1000/abc", want: "10.1000/abc"},
+		{name: "registrant subdivision", input: "10.1000.10/abc", want: "10.1000.10/abc"},
+		{name: "suffix with slashes", input: "10.1016/S0140-6736(05)67029-6/fulltext", want: "10.1016/s0140-6736(05)67029-6/fulltext"},
+		{name: "empty", input: "", want: "", wantErr: true},
+		{name: "wrong directory", input: "11.1000/abc", want: "11.1000/abc", wantErr: true},
+		{name: "short registrant", input: "10.100/abc", want: "10.100/abc", wantErr: true},
+		{name: "missing suffix", input: "10.1000/", want: "10.1000/", wantErr: true},
+		{name: "whitespace in suffix", input: "10.1000/a b", want: "10.1000/a b", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			is := is.New(t)
+
+			got, err := NormalizeDOI(tt.input)
+			is.Equal(got, tt.want)
+			if tt.wantErr {
+				is.True(errors.Is(err, ErrInvalidDOI))
+				return
+			}
+			is.NoErr(err)
+		})
+	}
+}
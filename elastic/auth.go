@@ -0,0 +1,97 @@
+package elastic
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// newTransport creates the transport used for all requests to the cluster with the TLS settings applied
+func newTransport(cfg Config) (http.RoundTripper, error) {
+	tlsConfig := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		//nolint:gosec // It is up to the user to decide, and it is off by default
+		InsecureSkipVerify: cfg.InsecureSkipVerify,
+	}
+
+	caCert := cfg.CACert
+	if cfg.CACertFile != "" {
+		data, err := os.ReadFile(cfg.CACertFile)
+		if err != nil {
+			return nil, fmt.Errorf("could not read CA cert file: %w", err)
+		}
+		caCert = append(append(caCert, '\n'), data...)
+	}
+
+	if len(caCert) > 0 {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caCert) {
+			return nil, fmt.Errorf("could not parse CA cert")
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if cfg.ClientCertFile != "" || cfg.ClientKeyFile != "" {
+		if cfg.ClientCertFile == "" || cfg.ClientKeyFile == "" {
+			return nil, fmt.Errorf("both client cert and key must be provided for mutual TLS")
+		}
+
+		cert, err := tls.LoadX509KeyPair(cfg.ClientCertFile, cfg.ClientKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("could not load client cert: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+
+	return transport, nil
+}
+
+// cloudIDAddress decodes the Cloud ID of an Elastic Cloud deployment into the URL of Elasticsearch.
+// The ID has the format <name>:<base64 of host$elasticsearch id$kibana id>
+func cloudIDAddress(cloudID string) (string, error) {
+	_, encoded, found := strings.Cut(cloudID, ":")
+	if !found {
+		encoded = cloudID
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", fmt.Errorf("could not decode cloud id: %w", err)
+	}
+
+	parts := strings.Split(string(decoded), "$")
+	if len(parts) < 2 || parts[0] == "" || parts[1] == "" {
+		return "", fmt.Errorf("invalid cloud id %q", cloudID)
+	}
+
+	host, port, hasPort := strings.Cut(parts[0], ":")
+	address := fmt.Sprintf("https://%s.%s", parts[1], host)
+	if hasPort {
+		address += ":" + port
+	}
+
+	return address, nil
+}
+
+// authorizationHeader returns the value of the Authorization header with the same
+// precedence as the client libraries: API key, service token and lastly username and password.
+func authorizationHeader(cfg Config) string {
+	switch {
+	case cfg.APIKey != "":
+		return "APIKey " + cfg.APIKey
+	case cfg.ServiceToken != "":
+		return "Bearer " + cfg.ServiceToken
+	case cfg.Username != "" || cfg.Password != "":
+		credentials := base64.StdEncoding.EncodeToString([]byte(cfg.Username + ":" + cfg.Password))
+		return "Basic " + credentials
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,289 @@
+package elastic
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"io"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+	"go.uber.org/zap"
+)
+
+func TestCloudIDAddress(t *testing.T) {
+	encode := func(s string) string { return base64.StdEncoding.EncodeToString([]byte(s)) }
+
+	tests := []struct {
+		name    string
+		input   string
+		want    string
+		wantErr bool
+	}{
+		{
+			name:  "happy path",
+			input: "my-deployment:" + encode("eu-west-1.aws.found.io$abc123$def456"),
+			want:  "https://abc123.eu-west-1.aws.found.io",
+		},
+		{
+			name:  "with port",
+			input: "my-deployment:" + encode("eu-west-1.aws.found.io:9243$abc123$def456"),
+			want:  "https://abc123.eu-west-1.aws.found.io:9243",
+		},
+		{
+			name:  "without name",
+			input: encode("eu-west-1.aws.found.io$abc123"),
+			want:  "https://abc123.eu-west-1.aws.found.io",
+		},
+		{
+			name:    "not base64",
+			input:   "my-deployment:%%%",
+			wantErr: true,
+		},
+		{
+			name:    "missing elasticsearch id",
+			input:   "my-deployment:" + encode("eu-west-1.aws.found.io"),
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			is := is.New(t)
+
+			got, err := cloudIDAddress(tt.input)
+			if tt.wantErr {
+				is.True(err != nil)
+				return
+			}
+
+			is.NoErr(err)
+			is.Equal(got, tt.want)
+		})
+	}
+}
+
+func TestAuthentication(t *testing.T) {
+	certs := newTestCerts(t)
+
+	tests := []struct {
+		name              string
+		requireClientCert bool
+		config            func(*Config)
+		wantAuth          string
+		wantErr           bool
+	}{
+		{
+			name:              "mutual TLS with API key",
+			requireClientCert: true,
+			config: func(c *Config) {
+				c.CACertFile = certs.caFile
+				c.ClientCertFile = certs.clientCertFile
+				c.ClientKeyFile = certs.clientKeyFile
+				c.APIKey = "YXBpLWtleQ=="
+			},
+			wantAuth: "APIKey YXBpLWtleQ==",
+		},
+		{
+			name:              "missing client certificate",
+			requireClientCert: true,
+			config: func(c *Config) {
+				c.CACertFile = certs.caFile
+			},
+			wantErr: true,
+		},
+		{
+			name: "service token with CA cert content",
+			config: func(c *Config) {
+				c.CACert = certs.caPEM
+				c.ServiceToken = "service-token"
+			},
+			wantAuth: "Bearer service-token",
+		},
+		{
+			name: "basic auth",
+			config: func(c *Config) {
+				c.CACertFile = certs.caFile
+				c.Username = "elastic"
+				c.Password = "changeme"
+			},
+			wantAuth: "Basic " + base64.StdEncoding.EncodeToString([]byte("elastic:changeme")),
+		},
+		{
+			name:    "untrusted server",
+			config:  func(c *Config) {},
+			wantErr: true,
+		},
+		{
+			name: "insecure skip verify",
+			config: func(c *Config) {
+				c.InsecureSkipVerify = true
+			},
+		},
+		{
+			name: "key without cert",
+			config: func(c *Config) {
+				c.CACertFile = certs.caFile
+				c.ClientKeyFile = certs.clientKeyFile
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			is := is.New(t)
+
+			var gotAuth string
+			srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotAuth = r.Header.Get("Authorization")
+				w.Header().Set("X-Elastic-Product", "Elasticsearch")
+				w.Header().Set("Content-Type", "application/json")
+				if r.URL.Path == "/" {
+					//nolint:errcheck
+					w.Write([]byte(`{"version": {"number": "7.17.10"}}`))
+					return
+				}
+				//nolint:errcheck
+				w.Write([]byte(`{"acknowledged": true}`))
+			}))
+			srv.Config.ErrorLog = log.New(io.Discard, "", 0) // Failing handshakes are expected
+			srv.TLS = &tls.Config{Certificates: []tls.Certificate{certs.server}, MinVersion: tls.VersionTLS12}
+			if tt.requireClientCert {
+				srv.TLS.ClientAuth = tls.RequireAndVerifyClientCert
+				srv.TLS.ClientCAs = certs.pool
+			}
+			srv.StartTLS()
+			defer srv.Close()
+
+			cfg := Config{Addresses: []string{srv.URL}, DisableRetry: true}
+			tt.config(&cfg)
+
+			idx, err := New(context.Background(), cfg, zap.NewNop().Sugar())
+			if err == nil {
+				err = idx.CreateIndex(context.Background(), "crossref", DefaultSettings())
+			}
+			if tt.wantErr {
+				is.True(err != nil)
+				return
+			}
+
+			is.NoErr(err)
+			is.Equal(gotAuth, tt.wantAuth)
+		})
+	}
+}
+
+type testCerts struct {
+	pool           *x509.CertPool
+	caPEM          []byte
+	caFile         string
+	server         tls.Certificate
+	clientCertFile string
+	clientKeyFile  string
+}
+
+// newTestCerts creates a CA with a server certificate for localhost and a client certificate
+func newTestCerts(t *testing.T) testCerts {
+	t.Helper()
+	dir := t.TempDir()
+
+	caKey, caDER := newCert(t, &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}, nil, nil)
+	ca, err := x509.ParseCertificate(caDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	serverKey, serverDER := newCert(t, &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+		DNSNames:     []string{"localhost"},
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}, ca, caKey)
+
+	clientKey, clientDER := newCert(t, &x509.Certificate{
+		SerialNumber: big.NewInt(3),
+		Subject:      pkix.Name{CommonName: "crossrefindexer"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}, ca, caKey)
+
+	certs := testCerts{
+		pool:           x509.NewCertPool(),
+		caPEM:          pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDER}),
+		caFile:         filepath.Join(dir, "ca.pem"),
+		server:         tls.Certificate{Certificate: [][]byte{serverDER}, PrivateKey: serverKey},
+		clientCertFile: filepath.Join(dir, "client.pem"),
+		clientKeyFile:  filepath.Join(dir, "client.key"),
+	}
+	certs.pool.AddCert(ca)
+
+	clientKeyDER, err := x509.MarshalECPrivateKey(clientKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files := map[string][]byte{
+		certs.caFile:         certs.caPEM,
+		certs.clientCertFile: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: clientDER}),
+		certs.clientKeyFile:  pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: clientKeyDER}),
+	}
+	for path, data := range files {
+		if err := os.WriteFile(path, data, 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return certs
+}
+
+// newCert creates a key and a certificate signed by the parent, or self signed if parent is nil
+func newCert(
+	t *testing.T,
+	template, parent *x509.Certificate,
+	parentKey *ecdsa.PrivateKey,
+) (*ecdsa.PrivateKey, []byte) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return key, der
+}
@@ -0,0 +1,392 @@
+package elastic
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/cenkalti/backoff"
+	"github.com/elastic/go-elasticsearch/v7/esapi"
+	"go.uber.org/zap"
+)
+
+// errorTypeRejected is the error type of items rejected because the write queue of a node is full
+const errorTypeRejected = "es_rejected_execution_exception"
+
+// adaptiveBulkIndexer sends bulk requests like the bulk indexers of the client libraries, but lets
+// a controller decide how many requests may be in flight and how large they are. Items rejected
+// because of back-pressure from the cluster are retried instead of failed.
+type adaptiveBulkIndexer struct {
+	client     esapi.Transport
+	index      string
+	controller *controller
+	maxRetries int
+	log        *zap.SugaredLogger
+
+	mu    sync.Mutex // Protects batch
+	batch *bulkBatch
+
+	wg        sync.WaitGroup // Tracks the requests in flight
+	ticker    *time.Ticker
+	stopFlush context.CancelFunc // Stops the periodic flush
+	stopped   chan struct{}      // Closed when the periodic flush has stopped
+
+	numAdded    atomic.Uint64
+	numFlushed  atomic.Uint64
+	numFailed   atomic.Uint64
+	numIndexed  atomic.Uint64
+	numRequests atomic.Uint64
+}
+
+// bulkBatch is the items of a single bulk request together with the encoded body
+type bulkBatch struct {
+	items []BulkIndexerItem
+	lines [][]byte // The action and document of each item
+	size  int
+}
+
+func (b *bulkBatch) add(item BulkIndexerItem, line []byte) {
+	b.items = append(b.items, item)
+	b.lines = append(b.lines, line)
+	b.size += len(line)
+}
+
+func (b *bulkBatch) body() []byte {
+	return bytes.Join(b.lines, nil)
+}
+
+type bulkResponse struct {
+	Errors bool `json:"errors"`
+	Items  []map[string]struct {
+		ID     string `json:"_id"`
+		Status int    `json:"status"`
+		Error  struct {
+			Type   string `json:"type"`
+			Reason string `json:"reason"`
+		} `json:"error"`
+	} `json:"items"`
+}
+
+func newAdaptiveBulkIndexer(
+	client esapi.Transport,
+	cfg BulkIndexerConfig,
+	throttle ThrottleConfig,
+	maxRetries int,
+	log *zap.SugaredLogger,
+) *adaptiveBulkIndexer {
+	bi := &adaptiveBulkIndexer{
+		client:     client,
+		index:      cfg.Index,
+		controller: newController(throttle, cfg.NumWorkers, cfg.FlushBytes),
+		maxRetries: maxRetries,
+		log:        log,
+		batch:      &bulkBatch{},
+		stopped:    make(chan struct{}),
+	}
+
+	if cfg.FlushInterval > 0 {
+		var ctx context.Context
+		ctx, bi.stopFlush = context.WithCancel(context.Background())
+		bi.ticker = time.NewTicker(cfg.FlushInterval)
+		go bi.flushPeriodically(ctx)
+	}
+
+	return bi
+}
+
+// Add encodes the item and sends the batch when it has reached the current flush size.
+// Blocks while the maximum number of requests are in flight, unless the context is cancelled.
+func (bi *adaptiveBulkIndexer) Add(ctx context.Context, item BulkIndexerItem) error {
+	line, err := encodeBulkItem(item)
+	if err != nil {
+		return err
+	}
+	bi.numAdded.Add(1)
+
+	_, flushBytes := bi.controller.limits()
+
+	bi.mu.Lock()
+	bi.batch.add(item, line)
+	var full *bulkBatch
+	if bi.batch.size >= flushBytes {
+		full, bi.batch = bi.batch, &bulkBatch{}
+	}
+	bi.mu.Unlock()
+
+	if full != nil {
+		return bi.send(ctx, full)
+	}
+
+	return nil
+}
+
+// Close sends what is left and waits for all requests to finish
+func (bi *adaptiveBulkIndexer) Close(ctx context.Context) error {
+	if bi.ticker != nil {
+		bi.ticker.Stop()
+		bi.stopFlush()
+		<-bi.stopped
+	}
+
+	bi.mu.Lock()
+	last := bi.batch
+	bi.batch = &bulkBatch{}
+	bi.mu.Unlock()
+
+	var err error
+	if len(last.items) > 0 {
+		err = bi.send(ctx, last)
+	}
+
+	bi.wg.Wait()
+	if err != nil {
+		return err
+	}
+	return ctx.Err()
+}
+
+func (bi *adaptiveBulkIndexer) Stats() BulkIndexerStats {
+	return BulkIndexerStats{
+		NumAdded:    bi.numAdded.Load(),
+		NumFlushed:  bi.numFlushed.Load(),
+		NumFailed:   bi.numFailed.Load(),
+		NumIndexed:  bi.numIndexed.Load(),
+		NumRequests: bi.numRequests.Load(),
+	}
+}
+
+// flushPeriodically sends what has been added every flush interval until the context is cancelled
+func (bi *adaptiveBulkIndexer) flushPeriodically(ctx context.Context) {
+	defer close(bi.stopped)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-bi.ticker.C:
+			bi.mu.Lock()
+			batch := bi.batch
+			if len(batch.items) > 0 {
+				bi.batch = &bulkBatch{}
+			}
+			bi.mu.Unlock()
+
+			if len(batch.items) == 0 {
+				continue
+			}
+			if err := bi.controller.acquire(ctx); err != nil {
+				// Stopped while waiting for a worker, so leave the batch to Close
+				bi.requeue(batch)
+				return
+			}
+			// The request itself should not be cancelled when the periodic flush stops
+			bi.start(context.Background(), batch)
+		}
+	}
+}
+
+// requeue puts the items of the batch back in front of what has been added since
+func (bi *adaptiveBulkIndexer) requeue(batch *bulkBatch) {
+	bi.mu.Lock()
+	defer bi.mu.Unlock()
+
+	for n, item := range bi.batch.items {
+		batch.add(item, bi.batch.lines[n])
+	}
+	bi.batch = batch
+}
+
+// send waits for a free worker and sends the batch in the background. If the context is cancelled
+// while waiting the items are failed with the error of the context, which is also returned.
+func (bi *adaptiveBulkIndexer) send(ctx context.Context, batch *bulkBatch) error {
+	if err := bi.controller.acquire(ctx); err != nil {
+		bi.fail(ctx, batch.items, BulkItemFailure{}, err)
+		return err
+	}
+	bi.start(ctx, batch)
+	return nil
+}
+
+// start sends the batch in the background with a worker that has already been acquired
+func (bi *adaptiveBulkIndexer) start(ctx context.Context, batch *bulkBatch) {
+	bi.wg.Add(1)
+
+	go func() {
+		defer bi.wg.Done()
+		defer bi.controller.release()
+
+		bi.flush(ctx, batch)
+	}()
+}
+
+// flush sends the batch and retries the items rejected by the cluster with an exponential backoff
+func (bi *adaptiveBulkIndexer) flush(ctx context.Context, batch *bulkBatch) {
+	retryBackoff := backoff.NewExponentialBackOff()
+
+	for attempt := 0; ; attempt++ {
+		rejected, err := bi.flushOnce(ctx, batch)
+		if err != nil {
+			bi.fail(ctx, batch.items, BulkItemFailure{}, err)
+			return
+		}
+		if rejected == nil {
+			return
+		}
+
+		if attempt >= bi.maxRetries {
+			bi.fail(ctx, rejected.items, BulkItemFailure{
+				Status: http.StatusTooManyRequests,
+				Type:   errorTypeRejected,
+				Reason: fmt.Sprintf("rejected by the cluster after %d retries", attempt),
+			}, nil)
+			return
+		}
+
+		wait := retryBackoff.NextBackOff()
+		bi.log.Debugw("Cluster rejected documents, retrying",
+			"documents", len(rejected.items),
+			"attempt", attempt+1,
+			"wait", wait,
+		)
+		select {
+		case <-ctx.Done():
+			bi.fail(ctx, rejected.items, BulkItemFailure{}, ctx.Err())
+			return
+		case <-time.After(wait):
+		}
+		batch = rejected
+	}
+}
+
+// flushOnce sends a single bulk request and returns the items that should be retried
+func (bi *adaptiveBulkIndexer) flushOnce(ctx context.Context, batch *bulkBatch) (*bulkBatch, error) {
+	start := time.Now()
+	resp, err := esapi.BulkRequest{Index: bi.index, Body: bytes.NewReader(batch.body())}.Do(ctx, bi.client)
+	bi.numRequests.Add(1)
+	if err != nil {
+		return nil, fmt.Errorf("Bulk request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	latency := time.Since(start)
+
+	// The whole request was rejected
+	if resp.StatusCode == http.StatusTooManyRequests {
+		//nolint:errcheck
+		io.Copy(io.Discard, resp.Body)
+		bi.observe(latency, true)
+		return batch, nil
+	}
+
+	if resp.IsError() {
+		return nil, newElasticError(resp)
+	}
+
+	var result bulkResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("could not decode bulk response: %w", err)
+	}
+
+	var rejected *bulkBatch
+	for n, item := range batch.items {
+		if n >= len(result.Items) {
+			bi.fail(ctx, []BulkIndexerItem{item}, BulkItemFailure{}, fmt.Errorf("missing in bulk response"))
+			continue
+		}
+
+		for _, res := range result.Items[n] {
+			switch {
+			case res.Status == http.StatusTooManyRequests || res.Error.Type == errorTypeRejected:
+				if rejected == nil {
+					rejected = &bulkBatch{}
+				}
+				rejected.add(item, batch.lines[n])
+			case res.Status > 201:
+				bi.fail(ctx, []BulkIndexerItem{item}, BulkItemFailure{
+					Status: res.Status,
+					Type:   res.Error.Type,
+					Reason: res.Error.Reason,
+				}, nil)
+			default:
+				bi.numFlushed.Add(1)
+				bi.numIndexed.Add(1)
+				if item.OnSuccess != nil {
+					item.OnSuccess(ctx)
+				}
+			}
+		}
+	}
+
+	bi.observe(latency, rejected != nil)
+	return rejected, nil
+}
+
+func (bi *adaptiveBulkIndexer) observe(latency time.Duration, rejected bool) {
+	bi.controller.observe(throttleSample{latency: latency, rejected: rejected})
+
+	workers, flushBytes := bi.controller.limits()
+	bi.log.Debugw("Adjusted bulk throttling",
+		"latency", latency,
+		"rejected", rejected,
+		"workers", workers,
+		"flushbytes", flushBytes,
+	)
+}
+
+func (bi *adaptiveBulkIndexer) fail(ctx context.Context, items []BulkIndexerItem, res BulkItemFailure, err error) {
+	for _, item := range items {
+		bi.numFailed.Add(1)
+		if item.OnFailure != nil {
+			item.OnFailure(ctx, res, err)
+		}
+	}
+}
+
+// encodeBulkItem creates the action line followed by the document
+func encodeBulkItem(item BulkIndexerItem) ([]byte, error) {
+	action := item.Action
+	if action == "" {
+		action = "index"
+	}
+
+	meta := map[string]map[string]any{action: {}}
+	if item.Index != "" {
+		meta[action]["_index"] = item.Index
+	}
+	if item.DocumentID != "" {
+		meta[action]["_id"] = item.DocumentID
+
+		// Versions only make sense for a specific document
+		if item.Version != nil {
+			meta[action]["version"] = *item.Version
+		}
+		if item.VersionType != "" {
+			meta[action]["version_type"] = item.VersionType
+		}
+	}
+
+	line, err := json.Marshal(meta)
+	if err != nil {
+		return nil, fmt.Errorf("could not encode bulk action: %w", err)
+	}
+	line = append(line, '\n')
+
+	if item.Body != nil {
+		if _, err := item.Body.Seek(0, io.SeekStart); err != nil {
+			return nil, fmt.Errorf("could not rewind document: %w", err)
+		}
+		body, err := io.ReadAll(item.Body)
+		if err != nil {
+			return nil, fmt.Errorf("could not read document: %w", err)
+		}
+		line = append(line, bytes.TrimRight(body, "\n")...)
+		line = append(line, '\n')
+	}
+
+	return line, nil
+}
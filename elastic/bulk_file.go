@@ -0,0 +1,355 @@
+package elastic
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/karatekaneen/crossrefindexer"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+const (
+	bulkFilePattern     = "bulk-*.ndjson"
+	settingsFileSuffix  = ".settings.json"
+	bulkFileNameFormat  = "bulk-%06d.ndjson"
+	maxBulkFileDocument = 1 << 30 // Longest line that is read when replaying
+)
+
+// BulkFileWriter writes bulk requests to files instead of sending them, for clusters that can only be
+// reached by uploading files. Every file is a complete request body that can be posted to _bulk as it is.
+// It is safe for concurrent use so publications and citations can be written to the same files.
+type BulkFileWriter struct {
+	dir        string
+	flushBytes int
+	log        *zap.SugaredLogger
+
+	mu      sync.Mutex // Protects everything below
+	file    *os.File
+	buf     *bufio.Writer
+	size    int // Bytes written to the current file
+	files   int
+	written int
+}
+
+// NewBulkFileWriter writes to files of at most flushBytes each in dir. A single document larger than
+// that gets a file of its own. If dir already has bulk files the new ones are numbered after them.
+func NewBulkFileWriter(dir string, flushBytes int, log *zap.SugaredLogger) (*BulkFileWriter, error) {
+	if dir == "" {
+		return nil, fmt.Errorf("a directory to write the bulk files to is required")
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("could not create %s: %w", dir, err)
+	}
+
+	existing, err := BulkFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &BulkFileWriter{dir: dir, flushBytes: flushBytes, log: log}
+	if len(existing) > 0 {
+		if _, err := fmt.Sscanf(filepath.Base(existing[len(existing)-1]), bulkFileNameFormat, &w.files); err != nil {
+			return nil, fmt.Errorf("unexpected bulk file name %s: %w", existing[len(existing)-1], err)
+		}
+	}
+	return w, nil
+}
+
+// RemoveBulkFiles removes the bulk and settings files written to dir
+func RemoveBulkFiles(dir string) error {
+	files, err := BulkFiles(dir)
+	if err != nil {
+		return err
+	}
+	settings, err := filepath.Glob(filepath.Join(dir, "*"+settingsFileSuffix))
+	if err != nil {
+		return err
+	}
+
+	for _, path := range append(files, settings...) {
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// BulkFiles returns the bulk files in dir in the order they were written
+func BulkFiles(dir string) ([]string, error) {
+	files, err := filepath.Glob(filepath.Join(dir, bulkFilePattern))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// WriteSettings stores the settings of an index next to the bulk files, so the index can be created
+// with the right mapping before the files are replayed
+func (w *BulkFileWriter) WriteSettings(indexName string, settings IndexSettings) error {
+	data, err := json.MarshalIndent(settings, "", "  ")
+	if err != nil {
+		return fmt.Errorf("could not marshal settings to json: %w", err)
+	}
+	return os.WriteFile(filepath.Join(w.dir, indexName+settingsFileSuffix), data, 0o644)
+}
+
+// BulkSettings reads the index settings stored with WriteSettings in dir by index name
+func BulkSettings(dir string) (map[string]IndexSettings, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*"+settingsFileSuffix))
+	if err != nil {
+		return nil, err
+	}
+
+	indices := map[string]IndexSettings{}
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+
+		var settings IndexSettings
+		if err := json.Unmarshal(data, &settings); err != nil {
+			return nil, fmt.Errorf("could not read settings in %s: %w", path, err)
+		}
+		indices[strings.TrimSuffix(filepath.Base(path), settingsFileSuffix)] = settings
+	}
+	return indices, nil
+}
+
+// WritePublications writes all the publications sent on `data` as bulk requests to the index
+func (w *BulkFileWriter) WritePublications(
+	ctx context.Context,
+	indexName string,
+	data chan crossrefindexer.SimplifiedPublication,
+) error {
+	return writeDocuments(w, indexName, data,
+		func(pub crossrefindexer.SimplifiedPublication) (string, int64) { return pub.DOI, pub.IndexedAt },
+	)
+}
+
+// WriteCitations writes all the citation edges sent on `data` as bulk requests to the index
+func (w *BulkFileWriter) WriteCitations(ctx context.Context, indexName string, data chan crossrefindexer.Citation) error {
+	return writeDocuments(w, indexName, data,
+		func(c crossrefindexer.Citation) (string, int64) { return c.ID(), c.IndexedAt },
+	)
+}
+
+// writeDocuments writes the documents the same way as indexDocuments sends them
+func writeDocuments[T any](w *BulkFileWriter, indexName string, data chan T, identify func(T) (string, int64)) error {
+	for doc := range data {
+		id, version := identify(doc)
+		jsonData, err := json.Marshal(doc)
+		if err != nil {
+			return errors.Wrap(err, fmt.Sprintf("Cannot encode document %s", id))
+		}
+
+		err = w.Add(BulkIndexerItem{
+			Action:      "index",
+			Index:       indexName,
+			DocumentID:  id,
+			Body:        bytes.NewReader(jsonData),
+			Version:     &version,
+			VersionType: "external_gte",
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Add writes the item to the current file, or to a new one if it would get larger than the flush bytes
+func (w *BulkFileWriter) Add(item BulkIndexerItem) error {
+	line, err := encodeBulkItem(item)
+	if err != nil {
+		return err
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.file == nil || (w.size > 0 && w.size+len(line) > w.flushBytes) {
+		if err := w.next(); err != nil {
+			return err
+		}
+	}
+
+	if _, err := w.buf.Write(line); err != nil {
+		return fmt.Errorf("could not write to %s: %w", w.file.Name(), err)
+	}
+	w.size += len(line)
+	w.written++
+	return nil
+}
+
+// next closes the current file and starts a new one
+func (w *BulkFileWriter) next() error {
+	if err := w.closeFile(); err != nil {
+		return err
+	}
+
+	w.files++
+	file, err := os.Create(filepath.Join(w.dir, fmt.Sprintf(bulkFileNameFormat, w.files)))
+	if err != nil {
+		return err
+	}
+	w.file, w.buf, w.size = file, bufio.NewWriter(file), 0
+	return nil
+}
+
+func (w *BulkFileWriter) closeFile() error {
+	if w.file == nil {
+		return nil
+	}
+
+	err := w.buf.Flush()
+	if closeErr := w.file.Close(); err == nil {
+		err = closeErr
+	}
+	w.file = nil
+	return err
+}
+
+// Close writes what is left to the current file. Adding more after that starts a new file,
+// so the writer can be closed after every pass when indexing in several.
+func (w *BulkFileWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if err := w.closeFile(); err != nil {
+		return err
+	}
+	w.log.Infof("Wrote %s documents to bulk files in %s, up to %s",
+		humanize.Comma(int64(w.written)),
+		w.dir,
+		fmt.Sprintf(bulkFileNameFormat, w.files),
+	)
+	return nil
+}
+
+// bulkAction is the metadata of a document in the action line of a bulk request
+type bulkAction struct {
+	Index       string `json:"_index"`
+	ID          string `json:"_id"`
+	Version     *int64 `json:"version"`
+	VersionType string `json:"version_type"`
+}
+
+// ReplayBulk sends the bulk requests in the files to the cluster. The requests are split up and sent with
+// the same bulk indexer and retries as when indexing, so the files do not need to match the flush bytes.
+// Actions without an index go to the index in the config.
+func (i *Indexer) ReplayBulk(ctx context.Context, paths []string) error {
+	counts := &indexCounts{}
+	start := time.Now()
+	bulkIndexer, err := i.newBulkIndexer(BulkIndexerConfig{
+		Index:         i.config.IndexName,
+		NumWorkers:    i.config.NumWorkers,
+		FlushBytes:    i.config.FlushBytes,
+		FlushInterval: i.config.FlushInterval,
+	})
+	if err != nil {
+		return err
+	}
+	pace := newPacer(i.config.MaxDocsPerSecond)
+
+	var replayErr error
+	for _, path := range paths {
+		i.log.Debugw("Replaying bulk file", "path", path)
+		if replayErr = i.replayFile(ctx, path, bulkIndexer, pace, counts, start); replayErr != nil {
+			break
+		}
+	}
+
+	// Send what has been added even if a file could not be read
+	err = bulkIndexer.Close(ctx)
+	i.logStats(bulkIndexer.Stats(), counts, start)
+	if outdated := counts.outdated.Load(); outdated > 0 {
+		i.log.Infof("Skipped %s documents that were older than the indexed version", humanize.Comma(int64(outdated)))
+	}
+	if replayErr != nil {
+		return replayErr
+	}
+	return errors.Wrap(err, "Closing of bulkindexer failed")
+}
+
+// replayFile adds every action in the file to the bulk indexer
+func (i *Indexer) replayFile(
+	ctx context.Context,
+	path string,
+	bulkIndexer BulkIndexer,
+	pace *pacer,
+	counts *indexCounts,
+	start time.Time,
+) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxBulkFileDocument)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+
+		var meta map[string]bulkAction
+		if err := json.Unmarshal(scanner.Bytes(), &meta); err != nil || len(meta) != 1 {
+			return fmt.Errorf("%s:%d is not a bulk action", path, line)
+		}
+
+		for action, target := range meta {
+			// Everything but deletes is followed by the document
+			var doc []byte
+			if action != "delete" {
+				if !scanner.Scan() {
+					return fmt.Errorf("%s:%d has no document for the action", path, line)
+				}
+				line++
+				doc = append([]byte(nil), scanner.Bytes()...)
+			}
+
+			if err := pace.wait(ctx, 1); err != nil {
+				return errors.Wrap(err, "Waiting for the rate limit failed")
+			}
+
+			var version int64
+			if target.Version != nil {
+				version = *target.Version
+			}
+			item := i.bulkIndexerItem(bulkIndexer, target.ID, version, doc, counts, start)
+			item.Action = action
+			item.Index = target.Index
+			item.VersionType = target.VersionType
+			if target.Version == nil {
+				item.Version = nil
+			}
+			if doc == nil {
+				item.Body = nil
+			}
+
+			if err := bulkIndexer.Add(ctx, item); err != nil {
+				return errors.Wrap(err, "Adding of indexing item failed")
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("could not read %s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,138 @@
+package elastic
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/karatekaneen/crossrefindexer"
+	"github.com/karatekaneen/crossrefindexer/elastictest"
+	"github.com/matryer/is"
+	"go.uber.org/zap"
+)
+
+func TestBulkFileWriter(t *testing.T) {
+	is := is.New(t)
+	dir := t.TempDir()
+
+	w, err := NewBulkFileWriter(dir, 500, zap.NewNop().Sugar())
+	is.NoErr(err)
+	is.NoErr(w.WriteSettings("crossref", DefaultSettings()))
+
+	pubs := make(chan crossrefindexer.SimplifiedPublication, 3)
+	pubs <- crossrefindexer.SimplifiedPublication{DOI: "10.1002/andp.19053220607", IndexedAt: 1690000000000}
+	pubs <- crossrefindexer.SimplifiedPublication{DOI: "10.1002/andp.19053220806", IndexedAt: 1690000000001}
+	pubs <- crossrefindexer.SimplifiedPublication{DOI: "10.1002/andp.19053221004", IndexedAt: 1690000000002}
+	close(pubs)
+	is.NoErr(w.WritePublications(context.Background(), "crossref", pubs))
+	is.NoErr(w.Close())
+
+	files, err := BulkFiles(dir)
+	is.NoErr(err)
+	is.Equal(len(files), 3) // Split by the flush bytes
+
+	var lines int
+	for _, path := range files {
+		data, err := os.ReadFile(path)
+		is.NoErr(err)
+		is.True(len(data) <= 500)
+		lines += bytes.Count(data, []byte("\n"))
+	}
+	is.Equal(lines, 6) // Action and document for each publication
+
+	first, err := os.ReadFile(files[0])
+	is.NoErr(err)
+	is.True(bytes.HasPrefix(first, []byte(
+		`{"index":{"_id":"10.1002/andp.19053220607","_index":"crossref","version":1690000000000,"version_type":"external_gte"}}`,
+	)))
+
+	settings, err := BulkSettings(dir)
+	is.NoErr(err)
+	is.Equal(len(settings), 1)
+	is.Equal(settings["crossref"].Mappings.Properties["DOI"], DefaultSettings().Mappings.Properties["DOI"])
+
+	// Later runs add files after the existing ones
+	w, err = NewBulkFileWriter(dir, 500, zap.NewNop().Sugar())
+	is.NoErr(err)
+	is.NoErr(w.Add(BulkIndexerItem{Action: "delete", DocumentID: "10.1002/andp.19053220607"}))
+	is.NoErr(w.Close())
+	files, err = BulkFiles(dir)
+	is.NoErr(err)
+	is.Equal(filepath.Base(files[len(files)-1]), "bulk-000004.ndjson")
+
+	is.NoErr(RemoveBulkFiles(dir))
+	files, err = BulkFiles(dir)
+	is.NoErr(err)
+	is.Equal(len(files), 0)
+}
+
+func TestReplayBulk(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		wantBody string
+		wantErr  bool
+	}{
+		{
+			name: "documents are sent with their metadata",
+			content: `{"index":{"_id":"a","_index":"crossref","version":2,"version_type":"external_gte"}}
+{"DOI":"a"}
+{"delete":{"_id":"b"}}
+`,
+			wantBody: `{"index":{"_id":"a","_index":"crossref","version":2,"version_type":"external_gte"}}
+{"DOI":"a"}
+{"delete":{"_id":"b"}}
+`,
+		},
+		{
+			name:    "action without document",
+			content: `{"index":{"_id":"a"}}` + "\n",
+			wantErr: true,
+		},
+		{
+			name:    "not a bulk action",
+			content: `{"DOI":"a"}` + "\n",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			is := is.New(t)
+
+			var body []byte
+			transport := elastictest.New(
+				elastictest.WithResponse(elastictest.CaseBulkOk),
+				elastictest.WithValidation(func(r *http.Request) error {
+					if r.URL.Path != "/crossref/_bulk" {
+						return fmt.Errorf("URL %q not matching expected", r.URL)
+					}
+					var err error
+					body, err = io.ReadAll(r.Body)
+					return err
+				}),
+			)
+			idx, err := New(
+				context.Background(),
+				Config{IndexName: "crossref", Adaptive: true, FlushBytes: 1_000_000, MaxFlushBytes: 1_000_000},
+				zap.NewNop().Sugar(),
+				WithTransport(transport),
+			)
+			is.NoErr(err)
+
+			path := t.TempDir() + "/bulk-000001.ndjson"
+			is.NoErr(os.WriteFile(path, []byte(tt.content), 0o644))
+
+			err = idx.ReplayBulk(context.Background(), []string{path})
+			is.Equal(err != nil, tt.wantErr)
+			if !tt.wantErr {
+				is.Equal(string(body), tt.wantBody)
+			}
+		})
+	}
+}
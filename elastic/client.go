@@ -0,0 +1,237 @@
+package elastic
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cenkalti/backoff"
+	"github.com/elastic/go-elasticsearch/v7/esapi"
+	"go.uber.org/zap"
+)
+
+// Flavor is the kind of cluster to talk to
+type Flavor string
+
+const (
+	FlavorAuto           Flavor = "auto"
+	FlavorElasticsearch7 Flavor = "elasticsearch7"
+	FlavorElasticsearch8 Flavor = "elasticsearch8"
+	FlavorOpenSearch     Flavor = "opensearch"
+)
+
+// Client is implemented once for every kind of cluster that is supported.
+// The requests in esapi are sent with Perform so the same requests can be used with all of them.
+type Client interface {
+	esapi.Transport
+	NewBulkIndexer(cfg BulkIndexerConfig) (BulkIndexer, error)
+}
+
+type BulkIndexerConfig struct {
+	Index         string        // The default index name
+	NumWorkers    int           // The number of worker goroutines
+	FlushBytes    int           // The flush threshold in bytes
+	FlushInterval time.Duration // The periodic flush
+}
+
+// BulkIndexer is the common subset of the bulk indexers in the different client libraries
+type BulkIndexer interface {
+	Add(ctx context.Context, item BulkIndexerItem) error
+	Close(ctx context.Context) error
+	Stats() BulkIndexerStats
+}
+
+type BulkIndexerItem struct {
+	Action      string
+	Index       string // Optional index, otherwise the default index of the bulk indexer
+	DocumentID  string
+	Body        io.ReadSeeker
+	Version     *int64 // Optional version of the document, see VersionType
+	VersionType string // How the version is compared with the stored one, like "external_gte"
+
+	OnSuccess func(ctx context.Context)                                 // Called for each successful operation
+	OnFailure func(ctx context.Context, res BulkItemFailure, err error) // Called for each failed operation
+}
+
+// BulkItemFailure is the error returned by the cluster for a single item
+type BulkItemFailure struct {
+	Status int
+	Type   string
+	Reason string
+}
+
+type BulkIndexerStats struct {
+	NumAdded    uint64
+	NumFlushed  uint64
+	NumFailed   uint64
+	NumIndexed  uint64
+	NumRequests uint64
+}
+
+// ClusterInfo is the interesting parts of the response from the root endpoint
+type ClusterInfo struct {
+	Name        string `json:"name"`
+	ClusterName string `json:"cluster_name"`
+	Version     struct {
+		Number       string `json:"number"`
+		Distribution string `json:"distribution"` // Only set by OpenSearch
+		BuildFlavor  string `json:"build_flavor"`
+	} `json:"version"`
+	Tagline string `json:"tagline"`
+}
+
+// MajorVersion returns the first part of the version number or 0 if it can't be parsed
+func (c ClusterInfo) MajorVersion() int {
+	major, _, _ := strings.Cut(c.Version.Number, ".")
+	v, err := strconv.Atoi(major)
+	if err != nil {
+		return 0
+	}
+	return v
+}
+
+// Flavor figures out what kind of cluster responded
+func (c ClusterInfo) Flavor() (Flavor, error) {
+	if strings.EqualFold(c.Version.Distribution, "opensearch") {
+		return FlavorOpenSearch, nil
+	}
+
+	switch c.MajorVersion() {
+	case 7:
+		return FlavorElasticsearch7, nil
+	case 8:
+		return FlavorElasticsearch8, nil
+	default:
+		return "", fmt.Errorf("unsupported cluster version %q", c.Version.Number)
+	}
+}
+
+// newClient creates a client for the flavor
+func newClient(
+	cfg Config,
+	flavor Flavor,
+	retryBackoff *backoff.ExponentialBackOff,
+	transport http.RoundTripper,
+	logger *zap.SugaredLogger,
+) (Client, error) {
+	switch flavor {
+	case FlavorElasticsearch7:
+		return newClientV7(cfg, retryBackoff, transport, logger)
+	case FlavorElasticsearch8:
+		return newClientV8(cfg, retryBackoff, transport, logger)
+	case FlavorOpenSearch:
+		return newClientOpenSearch(cfg, retryBackoff, transport, logger)
+	default:
+		return nil, fmt.Errorf("unknown cluster flavor %q", flavor)
+	}
+}
+
+// waitForClusterInfo fetches the cluster info and retries until the cluster
+// responds or the wait timeout in the config has passed. Useful when the cluster is still starting.
+func waitForClusterInfo(
+	ctx context.Context,
+	cfg Config,
+	transport http.RoundTripper,
+	logger *zap.SugaredLogger,
+) (ClusterInfo, error) {
+	retryBackoff := backoff.NewExponentialBackOff()
+	retryBackoff.MaxElapsedTime = cfg.WaitTimeout
+
+	for {
+		info, err := fetchClusterInfo(ctx, cfg, transport)
+		if err == nil {
+			return info, nil
+		}
+
+		wait := retryBackoff.NextBackOff()
+		if wait == backoff.Stop || cfg.WaitTimeout <= 0 {
+			return info, err
+		}
+
+		logger.Infow("Cluster not available yet, retrying", "err", err, "wait", wait)
+		select {
+		case <-ctx.Done():
+			return info, ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
+
+// fetchClusterInfo requests the root endpoint of each address until one answers, without
+// going through any of the client libraries since they can refuse to talk to each other's clusters.
+func fetchClusterInfo(ctx context.Context, cfg Config, transport http.RoundTripper) (ClusterInfo, error) {
+	// Same default as the client libraries
+	addresses := cfg.Addresses
+	if len(addresses) == 0 {
+		addresses = []string{"http://localhost:9200"}
+	}
+
+	var errs []error
+	for _, address := range addresses {
+		info, err := fetchNodeInfo(ctx, cfg, address, transport)
+		if err == nil {
+			return info, nil
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", address, err))
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return ClusterInfo{}, errors.Join(errs...)
+}
+
+// fetchNodeInfo requests the root endpoint of a single address
+func fetchNodeInfo(ctx context.Context, cfg Config, address string, transport http.RoundTripper) (ClusterInfo, error) {
+	var info ClusterInfo
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(address, "/")+"/", nil)
+	if err != nil {
+		return info, fmt.Errorf("could not create info request: %w", err)
+	}
+	if auth := authorizationHeader(cfg); auth != "" {
+		req.Header.Set("Authorization", auth)
+	}
+
+	resp, err := (&http.Client{Transport: transport, Timeout: 30 * time.Second}).Do(req)
+	if err != nil {
+		return info, fmt.Errorf("info request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return info, fmt.Errorf("info request failed with status %d", resp.StatusCode)
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
+		return info, fmt.Errorf("could not decode info response: %w", err)
+	}
+
+	return info, nil
+}
+
+// retryBackoffFunc adapts the exponential backoff to what the clients expect
+func retryBackoffFunc(retryBackoff *backoff.ExponentialBackOff, logger *zap.SugaredLogger) func(int) time.Duration {
+	return func(i int) time.Duration {
+		if i == 1 {
+			retryBackoff.Reset()
+		}
+
+		logger.Debugf("Retry for the %d time", i)
+		return retryBackoff.NextBackOff()
+	}
+}
+
+// retryOnStatus are the statuses that are worth retrying. The adaptive bulk indexer handles 429 itself,
+// since it has to know about the back-pressure and retries would otherwise add to its own.
+func retryOnStatus(cfg Config) []int {
+	if cfg.Adaptive {
+		return []int{502, 503, 504}
+	}
+	return []int{502, 503, 504, 429}
+}
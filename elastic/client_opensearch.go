@@ -0,0 +1,109 @@
+package elastic
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/cenkalti/backoff"
+	opensearch "github.com/opensearch-project/opensearch-go/v2"
+	"github.com/opensearch-project/opensearch-go/v2/opensearchutil"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// clientOpenSearch talks to OpenSearch
+type clientOpenSearch struct {
+	*opensearch.Client
+}
+
+func newClientOpenSearch(
+	cfg Config,
+	retryBackoff *backoff.ExponentialBackOff,
+	transport http.RoundTripper,
+	logger *zap.SugaredLogger,
+) (*clientOpenSearch, error) {
+	if cfg.APIKey != "" || cfg.ServiceToken != "" {
+		return nil, fmt.Errorf("API keys and service tokens are not supported by OpenSearch")
+	}
+
+	openSearchConfig := opensearch.Config{
+		RetryOnStatus:       retryOnStatus(cfg),
+		Password:            cfg.Password,
+		Username:            cfg.Username,
+		Addresses:           cfg.Addresses,
+		DisableRetry:        cfg.DisableRetry,
+		CompressRequestBody: cfg.CompressRequestBody,
+		MaxRetries:          cfg.MaxRetries,
+		Transport:           transport,
+		RetryBackoff:        retryBackoffFunc(retryBackoff, logger),
+	}
+
+	es, err := opensearch.NewClient(openSearchConfig)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to init opensearch client")
+	}
+
+	return &clientOpenSearch{Client: es}, nil
+}
+
+func (c *clientOpenSearch) NewBulkIndexer(cfg BulkIndexerConfig) (BulkIndexer, error) {
+	bi, err := opensearchutil.NewBulkIndexer(opensearchutil.BulkIndexerConfig{
+		Index:         cfg.Index,
+		Client:        c.Client,
+		NumWorkers:    cfg.NumWorkers,
+		FlushBytes:    cfg.FlushBytes,
+		FlushInterval: cfg.FlushInterval,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "could not create bulk indexer")
+	}
+
+	return &bulkIndexerOpenSearch{bi: bi}, nil
+}
+
+type bulkIndexerOpenSearch struct {
+	bi opensearchutil.BulkIndexer
+}
+
+func (b *bulkIndexerOpenSearch) Add(ctx context.Context, item BulkIndexerItem) error {
+	return b.bi.Add(ctx, opensearchutil.BulkIndexerItem{
+		Action:      item.Action,
+		Index:       item.Index,
+		DocumentID:  item.DocumentID,
+		Body:        item.Body,
+		Version:     item.Version,
+		VersionType: optionalString(item.VersionType),
+		OnSuccess: func(ctx context.Context, _ opensearchutil.BulkIndexerItem, _ opensearchutil.BulkIndexerResponseItem) {
+			if item.OnSuccess != nil {
+				item.OnSuccess(ctx)
+			}
+		},
+		OnFailure: func(ctx context.Context, _ opensearchutil.BulkIndexerItem, res opensearchutil.BulkIndexerResponseItem, err error) {
+			if item.OnFailure != nil {
+				item.OnFailure(ctx, BulkItemFailure{Status: res.Status, Type: res.Error.Type, Reason: res.Error.Reason}, err)
+			}
+		},
+	})
+}
+
+func (b *bulkIndexerOpenSearch) Close(ctx context.Context) error { return b.bi.Close(ctx) }
+
+func (b *bulkIndexerOpenSearch) Stats() BulkIndexerStats {
+	s := b.bi.Stats()
+	return BulkIndexerStats{
+		NumAdded:    s.NumAdded,
+		NumFlushed:  s.NumFlushed,
+		NumFailed:   s.NumFailed,
+		NumIndexed:  s.NumIndexed,
+		NumRequests: s.NumRequests,
+	}
+}
+
+// optionalString returns nil for empty strings since the OpenSearch client uses pointers for optional values
+func optionalString(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
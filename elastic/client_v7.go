@@ -0,0 +1,98 @@
+package elastic
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/cenkalti/backoff"
+	"github.com/elastic/go-elasticsearch/v7"
+	"github.com/elastic/go-elasticsearch/v7/esutil"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// clientV7 talks to Elasticsearch 7
+type clientV7 struct {
+	*elasticsearch.Client
+}
+
+func newClientV7(
+	cfg Config,
+	retryBackoff *backoff.ExponentialBackOff,
+	transport http.RoundTripper,
+	logger *zap.SugaredLogger,
+) (*clientV7, error) {
+	elasticConfig := elasticsearch.Config{
+		RetryOnStatus:       retryOnStatus(cfg),
+		Password:            cfg.Password,
+		Username:            cfg.Username,
+		Addresses:           cfg.Addresses,
+		APIKey:              cfg.APIKey,
+		ServiceToken:        cfg.ServiceToken,
+		DisableRetry:        cfg.DisableRetry,
+		CompressRequestBody: cfg.CompressRequestBody,
+		MaxRetries:          cfg.MaxRetries,
+		Transport:           transport,
+		RetryBackoff:        retryBackoffFunc(retryBackoff, logger),
+	}
+
+	es, err := elasticsearch.NewClient(elasticConfig)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to init elasticsearch client")
+	}
+
+	return &clientV7{Client: es}, nil
+}
+
+func (c *clientV7) NewBulkIndexer(cfg BulkIndexerConfig) (BulkIndexer, error) {
+	bi, err := esutil.NewBulkIndexer(esutil.BulkIndexerConfig{
+		Index:         cfg.Index,
+		Client:        c.Client,
+		NumWorkers:    cfg.NumWorkers,
+		FlushBytes:    cfg.FlushBytes,
+		FlushInterval: cfg.FlushInterval,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "could not create bulk indexer")
+	}
+
+	return &bulkIndexerV7{bi: bi}, nil
+}
+
+type bulkIndexerV7 struct {
+	bi esutil.BulkIndexer
+}
+
+func (b *bulkIndexerV7) Add(ctx context.Context, item BulkIndexerItem) error {
+	return b.bi.Add(ctx, esutil.BulkIndexerItem{
+		Action:      item.Action,
+		Index:       item.Index,
+		DocumentID:  item.DocumentID,
+		Body:        item.Body,
+		Version:     item.Version,
+		VersionType: item.VersionType,
+		OnSuccess: func(ctx context.Context, _ esutil.BulkIndexerItem, _ esutil.BulkIndexerResponseItem) {
+			if item.OnSuccess != nil {
+				item.OnSuccess(ctx)
+			}
+		},
+		OnFailure: func(ctx context.Context, _ esutil.BulkIndexerItem, res esutil.BulkIndexerResponseItem, err error) {
+			if item.OnFailure != nil {
+				item.OnFailure(ctx, BulkItemFailure{Status: res.Status, Type: res.Error.Type, Reason: res.Error.Reason}, err)
+			}
+		},
+	})
+}
+
+func (b *bulkIndexerV7) Close(ctx context.Context) error { return b.bi.Close(ctx) }
+
+func (b *bulkIndexerV7) Stats() BulkIndexerStats {
+	s := b.bi.Stats()
+	return BulkIndexerStats{
+		NumAdded:    s.NumAdded,
+		NumFlushed:  s.NumFlushed,
+		NumFailed:   s.NumFailed,
+		NumIndexed:  s.NumIndexed,
+		NumRequests: s.NumRequests,
+	}
+}
@@ -0,0 +1,85 @@
+package elastic
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/elastic/go-elasticsearch/v7/esapi"
+)
+
+// Refresh makes everything indexed so far visible to searches and counts
+func (i *Indexer) Refresh(ctx context.Context, indexName string) error {
+	resp, err := esapi.IndicesRefreshRequest{Index: []string{indexName}}.Do(ctx, i.client)
+	if err != nil {
+		return fmt.Errorf("Refresh request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.IsError() {
+		return newElasticError(resp)
+	}
+
+	return nil
+}
+
+// Count returns the number of documents in the index
+func (i *Indexer) Count(ctx context.Context, indexName string) (int, error) {
+	resp, err := esapi.CountRequest{Index: []string{indexName}}.Do(ctx, i.client)
+	if err != nil {
+		return 0, fmt.Errorf("Count request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.IsError() {
+		return 0, newElasticError(resp)
+	}
+
+	var result struct {
+		Count int `json:"count"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return 0, fmt.Errorf("could not decode count response: %w", err)
+	}
+
+	return result.Count, nil
+}
+
+// Documents fetches the stored documents with the ids. Documents that are not found are left out.
+func (i *Indexer) Documents(ctx context.Context, indexName string, ids []string) (map[string]json.RawMessage, error) {
+	data, err := json.Marshal(map[string]any{"ids": ids})
+	if err != nil {
+		return nil, fmt.Errorf("could not marshal ids to json: %w", err)
+	}
+
+	resp, err := esapi.MgetRequest{Index: indexName, Body: bytes.NewReader(data)}.Do(ctx, i.client)
+	if err != nil {
+		return nil, fmt.Errorf("Mget request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.IsError() {
+		return nil, newElasticError(resp)
+	}
+
+	var result struct {
+		Docs []struct {
+			ID     string          `json:"_id"`
+			Found  bool            `json:"found"`
+			Source json.RawMessage `json:"_source"`
+		} `json:"docs"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("could not decode mget response: %w", err)
+	}
+
+	docs := make(map[string]json.RawMessage, len(result.Docs))
+	for _, doc := range result.Docs {
+		if doc.Found {
+			docs[doc.ID] = doc.Source
+		}
+	}
+
+	return docs, nil
+}
@@ -0,0 +1,88 @@
+package elastic
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/karatekaneen/crossrefindexer/elastictest"
+	"github.com/matryer/is"
+	"go.uber.org/zap"
+)
+
+func TestRefreshAndCount(t *testing.T) {
+	is := is.New(t)
+
+	transport := elastictest.New(
+		elastictest.WithPathResponse("/crossref/_refresh", elastictest.CaseRefreshOk),
+		elastictest.WithPathResponse("/crossref/_count", elastictest.CaseCountOk),
+	)
+	idx, err := New(context.Background(), Config{}, zap.NewNop().Sugar(), WithTransport(transport))
+	is.NoErr(err)
+
+	is.NoErr(idx.Refresh(context.Background(), "crossref"))
+
+	count, err := idx.Count(context.Background(), "crossref")
+	is.NoErr(err)
+	is.Equal(count, 2)
+}
+
+func TestDocuments(t *testing.T) {
+	tests := []struct {
+		name     string
+		response elastictest.TestCase
+		wantIDs  []string
+		wantErr  bool
+	}{
+		{
+			name:     "missing documents are left out",
+			response: elastictest.CaseMgetOk,
+			wantIDs:  []string{"10.1002/andp.19053220607"},
+		},
+		{
+			name:     "index not found",
+			response: elastictest.CaseSearchIndexNotFound,
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			is := is.New(t)
+
+			var body map[string][]string
+			transport := elastictest.New(
+				elastictest.WithResponse(tt.response),
+				elastictest.WithValidation(func(r *http.Request) error {
+					if r.URL.Path != "/crossref/_mget" {
+						return fmt.Errorf("URL %q not matching expected", r.URL)
+					}
+					data, err := io.ReadAll(r.Body)
+					if err != nil {
+						return err
+					}
+					return json.Unmarshal(data, &body)
+				}),
+			)
+			idx, err := New(context.Background(), Config{}, zap.NewNop().Sugar(), WithTransport(transport))
+			is.NoErr(err)
+
+			ids := []string{"10.1002/andp.19053220607", "10.1002/andp.19053220806"}
+			docs, err := idx.Documents(context.Background(), "crossref", ids)
+			if tt.wantErr {
+				is.True(err != nil)
+				return
+			}
+
+			is.NoErr(err)
+			is.Equal(body["ids"], ids) // All ids should be requested
+			is.Equal(len(docs), len(tt.wantIDs))
+			for _, id := range tt.wantIDs {
+				is.True(len(docs[id]) > 0) // Found documents should have a source
+			}
+		})
+	}
+}
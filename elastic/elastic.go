@@ -12,8 +12,7 @@ import (
 
 	"github.com/cenkalti/backoff"
 	"github.com/dustin/go-humanize"
-	"github.com/elastic/go-elasticsearch/v7"
-	"github.com/elastic/go-elasticsearch/v7/esutil"
+	"github.com/elastic/go-elasticsearch/v7/esapi"
 	"github.com/karatekaneen/crossrefindexer"
 	"github.com/pkg/errors"
 	"go.uber.org/zap"
@@ -21,6 +20,7 @@ import (
 
 type Config struct {
 	IndexName           string        `help:"The index to write to"                                    default:"crossref"              name:"index"         env:"ES_INDEX"`
+	CitationsIndexName  string        `help:"The index to write citation edges to"                     default:"citations"             name:"citations-index" env:"ES_CITATIONS_INDEX"`
 	FlushBytes          int           `help:"How many bytes to buffer before flushing. Defaults to 5M" default:"2000000"               name:"flushbytes"    env:"ES_FLUSH_BYTES"`
 	FlushInterval       time.Duration `help:"How many seconds to wait before flushing"                 default:"2s"                    name:"flushinterval" env:"ES_FLUSH_INTERVAL"`
 	NumWorkers          int           `help:"Number of goroutines to run"                              default:"4"                     name:"workers"       env:"ES_WORKERS"`
@@ -31,18 +31,38 @@ type Config struct {
 	DisableRetry        bool          `help:"Fail on first failure"                                    default:"false"                 name:"noretry"       env:"ES_NO_RETRY"`
 	MaxRetries          int           `help:"Max number of retries after failure"                      default:"5"                                          env:"ES_MAX_RETRIES"`
 	CompressRequestBody bool          `help:"If the request body should be compressed"                 default:"false"                 name:"compress"      env:"ES_COMPRESS"`
+	APIKey              string        `help:"Base64 encoded API key to authenticate with"                                                   name:"api-key"       env:"ES_API_KEY"        optional:""`
+	ServiceToken        string        `help:"Service account token to authenticate with"                                                   name:"service-token" env:"ES_SERVICE_TOKEN"  optional:""`
+	CloudID             string        `help:"Cloud ID of an Elastic Cloud deployment. Replaces hosts"                                     name:"cloud-id"      env:"ES_CLOUD_ID"       optional:""`
+	CACertFile          string        `help:"Path to a CA cert to trust"                                                                   name:"ca-file"       env:"ES_CA_CERT_FILE"   optional:"" type:"existingfile"`
+	ClientCertFile      string        `help:"Path to a client certificate for mutual TLS"                                                 name:"cert"          env:"ES_CLIENT_CERT"    optional:"" type:"existingfile"`
+	ClientKeyFile       string        `help:"Path to the key of the client certificate"                                                   name:"key"           env:"ES_CLIENT_KEY"     optional:"" type:"existingfile"`
+	InsecureSkipVerify  bool          `help:"Skip verification of the server certificate. Only use for development"                   default:"false" name:"insecure"      env:"ES_INSECURE"`
+	WaitTimeout         time.Duration `help:"How long to wait for the cluster to become available and healthy"                           default:"60s"   name:"wait-timeout"  env:"ES_WAIT_TIMEOUT"`
+	Flavor              Flavor        `help:"Kind of cluster. Detected from the cluster if set to auto. Can be auto, elasticsearch7, elasticsearch8 or opensearch" default:"auto" name:"flavor" env:"ES_FLAVOR" enum:"auto,elasticsearch7,elasticsearch8,opensearch"`
+	Adaptive            bool          `help:"Adjust workers and flush bytes to the back-pressure of the cluster"                       default:"false"    name:"adaptive"         env:"ES_ADAPTIVE"`
+	MinWorkers          int           `help:"Fewest workers to use when adaptive"                                                       default:"1"        name:"min-workers"      env:"ES_MIN_WORKERS"`
+	MaxWorkers          int           `help:"Most workers to use when adaptive"                                                         default:"16"       name:"max-workers"      env:"ES_MAX_WORKERS"`
+	MinFlushBytes       int           `help:"Smallest flush size when adaptive"                                                         default:"500000"   name:"min-flushbytes"   env:"ES_MIN_FLUSH_BYTES"`
+	MaxFlushBytes       int           `help:"Largest flush size when adaptive"                                                          default:"20000000" name:"max-flushbytes"   env:"ES_MAX_FLUSH_BYTES"`
+	TargetLatency       time.Duration `help:"Bulk requests slower than this make the adaptive indexer back off"                        default:"2s"       name:"target-latency"   env:"ES_TARGET_LATENCY"`
+	MaxDocsPerSecond    int           `help:"Ceiling for the number of documents indexed per second. 0 means no limit"                 default:"0"        name:"max-docs-per-sec" env:"ES_MAX_DOCS_PER_SEC"`
 }
 
 type Indexer struct {
 	config    Config
-	client    *elasticsearch.Client
+	client    Client
+	flavor    Flavor       // The kind of cluster that the client is created for
+	info      *ClusterInfo // Set if the info has been fetched from the cluster
 	log       *zap.SugaredLogger
 	transport http.RoundTripper
 }
 
 type Option func(*Indexer)
 
-func New(config Config, log *zap.SugaredLogger, options ...Option) (*Indexer, error) {
+// New creates the indexer. When the flavor is detected it waits for the cluster as long as the wait timeout
+// in the config allows, or until the context is cancelled.
+func New(ctx context.Context, config Config, log *zap.SugaredLogger, options ...Option) (*Indexer, error) {
 	idx := &Indexer{
 		config: config,
 		log:    log,
@@ -54,7 +74,39 @@ func New(config Config, log *zap.SugaredLogger, options ...Option) (*Indexer, er
 		option(idx)
 	}
 
-	esClient, err := createElasticClient(config, retryBackoff, idx.transport, log)
+	if idx.transport == nil {
+		transport, err := newTransport(config)
+		if err != nil {
+			return nil, err
+		}
+		idx.transport = transport
+	}
+
+	if config.CloudID != "" {
+		address, err := cloudIDAddress(config.CloudID)
+		if err != nil {
+			return nil, err
+		}
+		config.Addresses = []string{address}
+		idx.config = config
+	}
+
+	idx.flavor = config.Flavor
+	if idx.flavor == FlavorAuto || idx.flavor == "" {
+		info, err := waitForClusterInfo(ctx, config, idx.transport, log)
+		if err != nil {
+			return nil, fmt.Errorf("could not detect cluster flavor: %w", err)
+		}
+
+		idx.flavor, err = info.Flavor()
+		if err != nil {
+			return nil, err
+		}
+		idx.info = &info
+		log.Debugw("Detected cluster flavor", "flavor", idx.flavor, "version", info.Version.Number)
+	}
+
+	esClient, err := newClient(config, idx.flavor, retryBackoff, idx.transport, log)
 	if err != nil {
 		return nil, err
 	}
@@ -69,10 +121,8 @@ func New(config Config, log *zap.SugaredLogger, options ...Option) (*Indexer, er
 func WithTransport(rt http.RoundTripper) Option { return func(i *Indexer) { i.transport = rt } }
 
 func (i *Indexer) DeleteIndex(ctx context.Context, indexName string) error {
-	// The API is kinda fubar so lets just assign it to a variable for ease of use
-	deleteApi := i.client.API.Indices.Delete
-
-	resp, err := deleteApi([]string{indexName})
+	// The request structs work with all the client flavors
+	resp, err := esapi.IndicesDeleteRequest{Index: []string{indexName}}.Do(ctx, i.client)
 	if err != nil {
 		return fmt.Errorf("Delete request failed: %w", err)
 	}
@@ -87,17 +137,14 @@ func (i *Indexer) DeleteIndex(ctx context.Context, indexName string) error {
 }
 
 func (i *Indexer) CreateIndex(ctx context.Context, indexName string, settings IndexSettings) error {
-	createApi := i.client.API.Indices.Create
-
 	data, err := json.Marshal(settings)
 	if err != nil {
 		return fmt.Errorf("could not marshal settings to json: %w", err)
 	}
-	resp, err := createApi(
-		indexName,
-		createApi.WithContext(ctx),
-		createApi.WithBody(bytes.NewReader(data)),
-	)
+	resp, err := esapi.IndicesCreateRequest{
+		Index: indexName,
+		Body:  bytes.NewReader(data),
+	}.Do(ctx, i.client)
 	if err != nil {
 		return fmt.Errorf("Delete request failed: %w", err)
 	}
@@ -119,34 +166,70 @@ func (i *Indexer) IndexPublications(
 	ctx context.Context,
 	data chan crossrefindexer.SimplifiedPublication,
 ) error {
-	countSuccessful := &atomic.Uint64{}
+	return indexDocuments(ctx, i, i.config.IndexName, "publications", data,
+		func(pub crossrefindexer.SimplifiedPublication) (string, int64) { return pub.DOI, pub.IndexedAt },
+	)
+}
+
+// IndexCitations consumes all the citation edges sent on `data` into the citations index
+func (i *Indexer) IndexCitations(ctx context.Context, data chan crossrefindexer.Citation) error {
+	return indexDocuments(ctx, i, i.config.CitationsIndexName, "citations", data,
+		func(c crossrefindexer.Citation) (string, int64) { return c.ID(), c.IndexedAt },
+	)
+}
+
+// indexDocuments indexes everything sent on `data` into the index and closes the indexer when the channel is closed.
+// identify returns the id and version of a document. `kind` is what the documents are called in the logs.
+func indexDocuments[T any](
+	ctx context.Context,
+	i *Indexer,
+	indexName string,
+	kind string,
+	data chan T,
+	identify func(T) (string, int64),
+) error {
+	counts := &indexCounts{}
 	start := time.Now()
-	bulkIndexer, err := createBulkIndexer(i.config, i.client)
+	bulkIndexer, err := i.newBulkIndexer(BulkIndexerConfig{
+		Index:         indexName,
+		NumWorkers:    i.config.NumWorkers,
+		FlushBytes:    i.config.FlushBytes,
+		FlushInterval: i.config.FlushInterval,
+	})
 	if err != nil {
 		return err
 	}
+	pace := newPacer(i.config.MaxDocsPerSecond)
 
 	for {
-		// we receive a publication
-		pub, stillOpen := <-data
+		// we receive a document
+		doc, stillOpen := <-data
 		if !stillOpen {
-			// If the channel is closed  - We "commit" the publications already in the slice before returning
-			i.log.Debug("Starting to close indexer")
+			// If the channel is closed  - We "commit" the documents already in the slice before returning
+			i.log.Debugw("Starting to close indexer", "index", indexName)
 			err := bulkIndexer.Close(ctx)
 			i.log.Debugf("Closed indexer with err: %q", err)
 
-			i.logStats(bulkIndexer.Stats(), start)
+			i.logStats(bulkIndexer.Stats(), counts, start)
+			if outdated := counts.outdated.Load(); outdated > 0 {
+				i.log.Infof("Skipped %s %s that were older than the indexed version", humanize.Comma(int64(outdated)), kind)
+			}
 			return errors.Wrap(err, "Closing of bulkindexer failed")
 		}
 
-		jsonData, err := json.Marshal(pub)
+		if err := pace.wait(ctx, 1); err != nil {
+			return errors.Wrap(err, "Waiting for the rate limit failed")
+		}
+
+		id, version := identify(doc)
+		jsonData, err := json.Marshal(doc)
 		if err != nil {
-			return errors.Wrap(err, fmt.Sprintf("Cannot encode publication %s", pub.DOI))
+			return errors.Wrap(err, fmt.Sprintf("Cannot encode document %s", id))
 		}
 
 		err = bulkIndexer.Add(
 			ctx,
-			i.bulkIndexerItem(bulkIndexer, pub.DOI, jsonData, countSuccessful, start),
+			i.bulkIndexerItem(bulkIndexer, id, version, jsonData, counts, start),
 		)
 		if err != nil {
 			return errors.Wrap(err, "Adding of indexing item failed")
@@ -154,43 +237,88 @@ func (i *Indexer) IndexPublications(
 	}
 }
 
-// bulkIndexerItem builds the object to be passed for indexing
+// newBulkIndexer creates the adaptive bulk indexer if enabled, otherwise the one from the client library
+func (i *Indexer) newBulkIndexer(cfg BulkIndexerConfig) (BulkIndexer, error) {
+	if !i.config.Adaptive {
+		return i.client.NewBulkIndexer(cfg)
+	}
+
+	maxRetries := i.config.MaxRetries
+	if i.config.DisableRetry {
+		maxRetries = 0
+	}
+
+	return newAdaptiveBulkIndexer(i.client, cfg, ThrottleConfig{
+		MinWorkers:    i.config.MinWorkers,
+		MaxWorkers:    i.config.MaxWorkers,
+		MinFlushBytes: i.config.MinFlushBytes,
+		MaxFlushBytes: i.config.MaxFlushBytes,
+		TargetLatency: i.config.TargetLatency,
+	}, maxRetries, i.log), nil
+}
+
+// indexCounts keeps track of the outcome of the indexing
+type indexCounts struct {
+	successful atomic.Uint64
+	outdated   atomic.Uint64 // Rejected because a newer version of the document was already indexed
+}
+
+// bulkIndexerItem builds the object to be passed for indexing.
+// The version makes the cluster keep the newest metadata when the same DOI is indexed more than once,
+// no matter in which order the bulk requests arrive.
 func (i *Indexer) bulkIndexerItem(
-	bulkIndexer esutil.BulkIndexer,
+	bulkIndexer BulkIndexer,
 	documentId string,
+	version int64,
 	data []byte,
-	countSuccessful *atomic.Uint64,
+	counts *indexCounts,
 	startTime time.Time,
-) esutil.BulkIndexerItem {
-	return esutil.BulkIndexerItem{
-		Action:     "index",
-		DocumentID: documentId,
-		Body:       bytes.NewReader(data),
+) BulkIndexerItem {
+	return BulkIndexerItem{
+		Action:      "index",
+		DocumentID:  documentId,
+		Body:        bytes.NewReader(data),
+		Version:     &version,
+		VersionType: "external_gte", // Equal versions overwrite so that re-indexing the same data works
 
 		// OnSuccess is called for each successful operation
-		OnSuccess: func(ctx context.Context, item esutil.BulkIndexerItem, res esutil.BulkIndexerResponseItem) {
-			count := countSuccessful.Add(1)
+		OnSuccess: func(ctx context.Context) {
+			count := counts.successful.Add(1)
 
 			// Log more often in the beginning to get quick feedback
 			highFreq := count < 1_000_000 && count%100_000 == 0   // Log every 100k in the beginning
 			lowFreq := count >= 1_000_000 && count%1_000_000 == 0 // Log every 1m afterwards
 			if highFreq || lowFreq {
-				i.logStats(bulkIndexer.Stats(), startTime)
+				i.logStats(bulkIndexer.Stats(), counts, startTime)
 			}
 		},
-		OnFailure: func(ctx context.Context, item esutil.BulkIndexerItem, res esutil.BulkIndexerResponseItem, err error) {
+		OnFailure: func(ctx context.Context, res BulkItemFailure, err error) {
+			if err == nil && res.Status == http.StatusConflict {
+				counts.outdated.Add(1)
+				i.log.Debugw("Newer version already indexed", "id", documentId, "version", version)
+				return
+			}
+
 			if err != nil {
 				i.log.Errorw("Indexing failed", "err", err)
 			} else {
-				i.log.Errorw("Indexing failed", "type", res.Error.Type, "reason", res.Error.Reason)
+				i.log.Errorw("Indexing failed", "type", res.Type, "reason", res.Reason)
 			}
 		},
 	}
 }
 
-func (i *Indexer) logStats(biStats esutil.BulkIndexerStats, start time.Time) {
+func (i *Indexer) logStats(biStats BulkIndexerStats, counts *indexCounts, start time.Time) {
 	dur := time.Since(start)
 
+	// Outdated documents are failures to the cluster but expected when there are duplicates.
+	// The counters are updated separately so they might be a bit out of sync.
+	if outdated := counts.outdated.Load(); outdated < biStats.NumFailed {
+		biStats.NumFailed -= outdated
+	} else {
+		biStats.NumFailed = 0
+	}
+
 	if biStats.NumFailed > 0 {
 		i.log.Errorf(
 			"Indexed [%s] documents with [%s] errors in %s (%s docs/sec)",
@@ -208,46 +336,3 @@ func (i *Indexer) logStats(biStats esutil.BulkIndexerStats, start time.Time) {
 		)
 	}
 }
-
-func createElasticClient(
-	cfg Config,
-	retryBackoff *backoff.ExponentialBackOff,
-	transport http.RoundTripper,
-	logger *zap.SugaredLogger,
-) (*elasticsearch.Client, error) {
-	elasticConfig := elasticsearch.Config{
-		RetryOnStatus:       []int{502, 503, 504, 429},
-		Password:            cfg.Password,
-		Username:            cfg.Username,
-		Addresses:           cfg.Addresses,
-		CACert:              cfg.CACert,
-		DisableRetry:        cfg.DisableRetry,
-		CompressRequestBody: cfg.CompressRequestBody,
-		MaxRetries:          cfg.MaxRetries,
-		Transport:           transport,
-		RetryBackoff: func(i int) time.Duration {
-			if i == 1 {
-				retryBackoff.Reset()
-			}
-
-			logger.Debugf("Retry for the %d time", i)
-			return retryBackoff.NextBackOff()
-		},
-	}
-
-	es, err := elasticsearch.NewClient(elasticConfig)
-
-	return es, errors.Wrap(err, "failed to init elasticsearch client")
-}
-
-func createBulkIndexer(cfg Config, es *elasticsearch.Client) (esutil.BulkIndexer, error) {
-	bi, err := esutil.NewBulkIndexer(esutil.BulkIndexerConfig{
-		Index:         cfg.IndexName,     // The default index name
-		Client:        es,                // The Elasticsearch client
-		NumWorkers:    cfg.NumWorkers,    // The number of worker goroutines
-		FlushBytes:    cfg.FlushBytes,    // The flush threshold in bytes
-		FlushInterval: cfg.FlushInterval, // The periodic flush
-	})
-
-	return bi, errors.Wrap(err, "could not create bulk indexer")
-}
@@ -1,11 +1,17 @@
 package elastic
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/karatekaneen/crossrefindexer"
 	"github.com/karatekaneen/crossrefindexer/elastictest"
 	"github.com/matryer/is"
 	"go.uber.org/zap"
@@ -49,7 +55,7 @@ func TestDeleteIndex(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			is := is.New(t)
 
-			idx, err := New(Config{}, zap.NewNop().Sugar(), WithTransport(tt.transport))
+			idx, err := New(context.Background(), Config{}, zap.NewNop().Sugar(), WithTransport(tt.transport))
 			is.NoErr(err)
 
 			err = idx.DeleteIndex(context.Background(), tt.input)
@@ -101,7 +107,7 @@ func TestCreateIndex(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			is := is.New(t)
 
-			idx, err := New(Config{}, zap.NewNop().Sugar(), WithTransport(tt.transport))
+			idx, err := New(context.Background(), Config{}, zap.NewNop().Sugar(), WithTransport(tt.transport))
 			is.NoErr(err)
 
 			err = idx.CreateIndex(context.Background(), tt.input, DefaultSettings())
@@ -114,3 +120,370 @@ func TestCreateIndex(t *testing.T) {
 		})
 	}
 }
+
+func TestSearch(t *testing.T) {
+	tests := []struct {
+		name      string
+		transport *elastictest.ElasticTransport
+		wantIDs   []string
+		wantErr   bool
+	}{
+		{
+			name: "happy path",
+			transport: elastictest.New(
+				elastictest.WithResponse(elastictest.CaseSearchOk),
+				elastictest.WithValidation(func(r *http.Request) error {
+					if r.URL.Path != "/crossref/_search" || r.URL.Query().Get("size") != "5" {
+						return fmt.Errorf("URL %q not matching expected", r.URL)
+					}
+					return nil
+				}),
+			),
+			wantIDs: []string{"10.1002/andp.19053220607", "10.1002/andp.19053220806"},
+		},
+		{
+			name: "index not found",
+			transport: elastictest.New(
+				elastictest.WithResponse(elastictest.CaseSearchIndexNotFound),
+			),
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			is := is.New(t)
+
+			idx, err := New(context.Background(), Config{}, zap.NewNop().Sugar(), WithTransport(tt.transport))
+			is.NoErr(err)
+
+			query := map[string]any{"match": map[string]any{"bibliographic": "Einstein 1905"}}
+			hits, err := idx.Search(context.Background(), "crossref", query, 5)
+			if tt.wantErr {
+				is.True(err != nil)
+				return
+			}
+
+			is.NoErr(err)
+			is.Equal(len(hits), len(tt.wantIDs))
+			for i, hit := range hits {
+				is.Equal(hit.ID, tt.wantIDs[i])
+				is.True(hit.Score > 0)
+			}
+		})
+	}
+}
+
+func TestDetectFlavor(t *testing.T) {
+	tests := []struct {
+		name   string
+		info   elastictest.TestCase
+		flavor Flavor
+		want   Client
+	}{
+		{name: "elasticsearch 7", info: elastictest.CaseInfoElasticsearch7, flavor: FlavorAuto, want: &clientV7{}},
+		{name: "elasticsearch 8", info: elastictest.CaseInfoElasticsearch8, flavor: FlavorAuto, want: &clientV8{}},
+		{name: "opensearch", info: elastictest.CaseInfoOpenSearch, flavor: FlavorAuto, want: &clientOpenSearch{}},
+		{name: "explicit flavor", info: elastictest.CaseInfoElasticsearch7, flavor: FlavorElasticsearch8, want: &clientV8{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			is := is.New(t)
+
+			transport := elastictest.New(elastictest.WithInfo(tt.info))
+			idx, err := New(context.Background(), Config{Flavor: tt.flavor}, zap.NewNop().Sugar(), WithTransport(transport))
+			is.NoErr(err)
+
+			is.Equal(fmt.Sprintf("%T", idx.client), fmt.Sprintf("%T", tt.want))
+		})
+	}
+}
+
+// roundTripFunc lets a function be used as the transport
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) { return f(r) }
+
+func TestDetectFlavorCancelled(t *testing.T) {
+	is := is.New(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	unavailable := roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		cancel() // Like Ctrl-C while waiting for the cluster to start
+		return nil, errors.New("connection refused")
+	})
+
+	done := make(chan error)
+	go func() {
+		_, err := New(ctx, Config{WaitTimeout: time.Hour}, zap.NewNop().Sugar(), WithTransport(unavailable))
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		is.True(errors.Is(err, context.Canceled))
+	case <-time.After(5 * time.Second):
+		t.Fatal("waiting for the cluster was not cancelled")
+	}
+}
+
+func TestDetectFlavorFirstNodeDown(t *testing.T) {
+	is := is.New(t)
+
+	cluster := elastictest.New(elastictest.WithInfo(elastictest.CaseInfoElasticsearch8))
+	var asked []string
+	transport := roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		asked = append(asked, r.URL.Host)
+		if r.URL.Host == "es1:9200" {
+			return nil, errors.New("connection refused")
+		}
+		return cluster.RoundTrip(r)
+	})
+
+	idx, err := New(
+		context.Background(),
+		Config{Addresses: []string{"http://es1:9200", "http://es2:9200"}},
+		zap.NewNop().Sugar(),
+		WithTransport(transport),
+	)
+	is.NoErr(err)
+	is.Equal(idx.flavor, FlavorElasticsearch8)
+	is.Equal(asked[:2], []string{"es1:9200", "es2:9200"})
+}
+
+func TestFlavors(t *testing.T) {
+	flavors := []struct {
+		name string
+		info elastictest.TestCase
+	}{
+		{name: "elasticsearch 7", info: elastictest.CaseInfoElasticsearch7},
+		{name: "elasticsearch 8", info: elastictest.CaseInfoElasticsearch8},
+		{name: "opensearch", info: elastictest.CaseInfoOpenSearch},
+	}
+
+	operations := []struct {
+		name     string
+		response elastictest.TestCase
+		run      func(*Indexer) error
+	}{
+		{
+			name:     "create index",
+			response: elastictest.CaseCreateIndexOk,
+			run: func(idx *Indexer) error {
+				return idx.CreateIndex(context.Background(), "crossref", DefaultSettings())
+			},
+		},
+		{
+			name:     "delete index",
+			response: elastictest.CaseDeleteIndexNotFound,
+			run: func(idx *Indexer) error {
+				return idx.DeleteIndex(context.Background(), "crossref")
+			},
+		},
+		{
+			name:     "search",
+			response: elastictest.CaseSearchOk,
+			run: func(idx *Indexer) error {
+				hits, err := idx.Search(context.Background(), "crossref", map[string]any{"match_all": map[string]any{}}, 2)
+				if err == nil && len(hits) != 2 {
+					return fmt.Errorf("expected 2 hits, got %d", len(hits))
+				}
+				return err
+			},
+		},
+		{
+			name:     "index publications",
+			response: elastictest.CaseBulkOk,
+			run: func(idx *Indexer) error {
+				data := make(chan crossrefindexer.SimplifiedPublication, 2)
+				data <- crossrefindexer.SimplifiedPublication{DOI: "10.1002/andp.19053220607"}
+				data <- crossrefindexer.SimplifiedPublication{DOI: "10.1002/andp.19053220806"}
+				close(data)
+				return idx.IndexPublications(context.Background(), data)
+			},
+		},
+	}
+
+	for _, flavor := range flavors {
+		for _, op := range operations {
+			t.Run(flavor.name+" "+op.name, func(t *testing.T) {
+				is := is.New(t)
+
+				transport := elastictest.New(
+					elastictest.WithInfo(flavor.info),
+					elastictest.WithResponse(op.response),
+				)
+				idx, err := New(context.Background(), Config{IndexName: "crossref"}, zap.NewNop().Sugar(), WithTransport(transport))
+				is.NoErr(err)
+
+				is.NoErr(op.run(idx))
+			})
+		}
+	}
+}
+
+func TestIndexPublications(t *testing.T) {
+	tests := []struct {
+		name     string
+		response elastictest.TestCase
+		adaptive bool
+	}{
+		{name: "all indexed", response: elastictest.CaseBulkOk},
+		{name: "partial failure", response: elastictest.CaseBulkPartialFailure},
+		{name: "newer version already indexed", response: elastictest.CaseBulkVersionConflict},
+		{name: "adaptive all indexed", response: elastictest.CaseBulkOk, adaptive: true},
+		{name: "adaptive newer version already indexed", response: elastictest.CaseBulkVersionConflict, adaptive: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			is := is.New(t)
+
+			var lines int
+			var body []byte
+			transport := elastictest.New(
+				elastictest.WithResponse(tt.response),
+				elastictest.WithValidation(func(r *http.Request) error {
+					if r.URL.Path != "/crossref/_bulk" || r.Method != http.MethodPost {
+						return fmt.Errorf("URL %q or Method %q not matching expected", r.URL, r.Method)
+					}
+					var err error
+					body, err = io.ReadAll(r.Body)
+					lines = bytes.Count(body, []byte("\n"))
+					return err
+				}),
+			)
+			cfg := Config{IndexName: "crossref", Adaptive: tt.adaptive, FlushBytes: 1_000_000, MaxFlushBytes: 1_000_000}
+			idx, err := New(context.Background(), cfg, zap.NewNop().Sugar(), WithTransport(transport))
+			is.NoErr(err)
+
+			data := make(chan crossrefindexer.SimplifiedPublication, 2)
+			data <- crossrefindexer.SimplifiedPublication{DOI: "10.1002/andp.19053220607", IndexedAt: 1690000000000}
+			data <- crossrefindexer.SimplifiedPublication{DOI: "10.1002/andp.19053220806", IndexedAt: 1690000000001}
+			close(data)
+
+			is.NoErr(idx.IndexPublications(context.Background(), data))
+			is.Equal(lines, 4) // Action and document for each publication
+
+			// The timestamp is the version so that the newest metadata is kept
+			is.True(bytes.Contains(body, []byte(`"version":1690000000001`)))
+			is.True(bytes.Contains(body, []byte(`"version_type":"external_gte"`)))
+		})
+	}
+}
+
+func TestIndexPublicationsAdaptive(t *testing.T) {
+	tests := []struct {
+		name       string
+		responses  []elastictest.TestCase
+		wantLines  []int // Lines in the body of each bulk request
+		wantFailed uint64
+	}{
+		{
+			name:      "all indexed",
+			responses: []elastictest.TestCase{elastictest.CaseBulkOk},
+			wantLines: []int{4},
+		},
+		{
+			name:       "partial failure is not retried",
+			responses:  []elastictest.TestCase{elastictest.CaseBulkPartialFailure},
+			wantLines:  []int{4},
+			wantFailed: 1,
+		},
+		{
+			name:      "rejected document is retried",
+			responses: []elastictest.TestCase{elastictest.CaseBulkRejected, elastictest.CaseBulkOk},
+			wantLines: []int{4, 2},
+		},
+		{
+			name:       "rejected until out of retries",
+			responses:  []elastictest.TestCase{elastictest.CaseBulkRejected, elastictest.CaseBulkRejectedAll},
+			wantLines:  []int{4, 2},
+			wantFailed: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			is := is.New(t)
+
+			var lines []int
+			transport := elastictest.New(
+				elastictest.WithPathResponses("/crossref/_bulk", tt.responses...),
+				elastictest.WithValidation(func(r *http.Request) error {
+					body, err := io.ReadAll(r.Body)
+					lines = append(lines, bytes.Count(body, []byte("\n")))
+					return err
+				}),
+			)
+			cfg := Config{
+				IndexName:     "crossref",
+				FlushBytes:    1_000_000,
+				NumWorkers:    1,
+				MaxRetries:    1,
+				Adaptive:      true,
+				MaxWorkers:    1,
+				MaxFlushBytes: 1_000_000,
+			}
+			idx, err := New(context.Background(), cfg, zap.NewNop().Sugar(), WithTransport(transport))
+			is.NoErr(err)
+
+			bi, err := idx.newBulkIndexer(BulkIndexerConfig{Index: "crossref", NumWorkers: 1, FlushBytes: 1_000_000})
+			is.NoErr(err)
+
+			for _, doi := range []string{"10.1002/andp.19053220607", "10.1002/andp.19053220806"} {
+				is.NoErr(bi.Add(context.Background(), BulkIndexerItem{
+					Action:     "index",
+					DocumentID: doi,
+					Body:       strings.NewReader(`{"doi":"` + doi + `"}`),
+				}))
+			}
+			is.NoErr(bi.Close(context.Background()))
+
+			is.Equal(lines, tt.wantLines) // Only the rejected documents should be sent again
+			stats := bi.Stats()
+			is.Equal(stats.NumAdded, uint64(2))
+			is.Equal(stats.NumFailed, tt.wantFailed)
+			is.Equal(stats.NumFlushed, 2-tt.wantFailed)
+		})
+	}
+}
+
+func TestIndexCitations(t *testing.T) {
+	is := is.New(t)
+
+	var body []byte
+	transport := elastictest.New(
+		elastictest.WithResponse(elastictest.CaseBulkOk),
+		elastictest.WithValidation(func(r *http.Request) error {
+			if r.URL.Path != "/citations/_bulk" {
+				return fmt.Errorf("URL %q not matching expected", r.URL)
+			}
+			var err error
+			body, err = io.ReadAll(r.Body)
+			return err
+		}),
+	)
+	idx, err := New(context.Background(), Config{CitationsIndexName: "citations"}, zap.NewNop().Sugar(), WithTransport(transport))
+	is.NoErr(err)
+
+	data := make(chan crossrefindexer.Citation, 2)
+	data <- crossrefindexer.Citation{
+		CitingDOI: "10.1002/andp.19053220607",
+		CitedDOI:  "10.1002/andp.19053220806",
+		Key:       "ref1",
+		IndexedAt: 1690000000000,
+	}
+	data <- crossrefindexer.Citation{
+		CitingDOI: "10.1002/andp.19053220607",
+		CitedDOI:  "10.1002/andp.19053221004",
+		Key:       "ref2",
+		IndexedAt: 1690000000000,
+	}
+	close(data)
+
+	is.NoErr(idx.IndexCitations(context.Background(), data))
+	is.True(bytes.Contains(body, []byte(`"_id":"10.1002/andp.19053220607 10.1002/andp.19053220806"`))) // Id of the edge
+	is.True(bytes.Contains(body, []byte(`"cited_doi":"10.1002/andp.19053220806"`)))
+}
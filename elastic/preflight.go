@@ -0,0 +1,349 @@
+package elastic
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cenkalti/backoff"
+	"github.com/elastic/go-elasticsearch/v7/esapi"
+)
+
+// maxHealthWait is the longest time to let the cluster wait for the health status in a single request
+const maxHealthWait = 30 * time.Second
+
+// Preflight makes sure that the cluster is ready to be indexed to before starting.
+// It waits for the cluster to become healthy and checks that the version is supported,
+// that there is disk space left and that the user has the privileges on the indices.
+func (i *Indexer) Preflight(ctx context.Context, indexNames []string, privileges ...string) error {
+	checks := []struct {
+		name  string
+		check func(context.Context) error
+	}{
+		{name: "cluster health", check: i.WaitForHealth},
+		{name: "version", check: i.checkVersion},
+		{name: "disk watermarks", check: i.checkDiskWatermarks},
+		{name: "privileges", check: func(ctx context.Context) error {
+			return i.checkPrivileges(ctx, indexNames, privileges)
+		}},
+	}
+
+	for _, c := range checks {
+		if err := c.check(ctx); err != nil {
+			return fmt.Errorf("pre-flight check of %s failed: %w", c.name, err)
+		}
+		i.log.Debugw("Pre-flight check passed", "check", c.name)
+	}
+
+	return nil
+}
+
+type clusterHealth struct {
+	ClusterName string `json:"cluster_name"`
+	Status      string `json:"status"`
+	TimedOut    bool   `json:"timed_out"`
+}
+
+// WaitForHealth blocks until the cluster health is yellow or green or until the wait timeout has passed.
+func (i *Indexer) WaitForHealth(ctx context.Context) error {
+	deadline := time.Now().Add(i.config.WaitTimeout)
+	retryBackoff := backoff.NewExponentialBackOff()
+
+	var health clusterHealth
+	for {
+		wait := time.Until(deadline)
+		if wait > maxHealthWait {
+			wait = maxHealthWait
+		}
+
+		var err error
+		health, err = i.clusterHealth(ctx, wait)
+		if err == nil && !health.TimedOut && health.Status != "red" {
+			return nil
+		}
+
+		if time.Now().After(deadline) {
+			if err != nil {
+				return fmt.Errorf("cluster did not respond within %s: %w", i.config.WaitTimeout, err)
+			}
+			return fmt.Errorf(
+				"cluster health is %s after waiting %s. Check that all nodes have started and that no shards are unassigned",
+				health.Status,
+				i.config.WaitTimeout,
+			)
+		}
+
+		i.log.Infow("Waiting for cluster to become healthy", "status", health.Status, "err", err)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(retryBackoff.NextBackOff()):
+		}
+	}
+}
+
+func (i *Indexer) clusterHealth(ctx context.Context, wait time.Duration) (clusterHealth, error) {
+	var health clusterHealth
+
+	req := esapi.ClusterHealthRequest{WaitForStatus: "yellow"}
+	if wait > 0 {
+		req.Timeout = wait
+	}
+
+	resp, err := req.Do(ctx, i.client)
+	if err != nil {
+		return health, fmt.Errorf("Health request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	// The cluster responds with 408 if the status was not reached in time
+	if resp.IsError() && resp.StatusCode != http.StatusRequestTimeout {
+		return health, newElasticError(resp)
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&health); err != nil {
+		return health, fmt.Errorf("could not decode health response: %w", err)
+	}
+
+	return health, nil
+}
+
+// Info returns information about the cluster. It is only fetched once.
+func (i *Indexer) Info(ctx context.Context) (ClusterInfo, error) {
+	if i.info != nil {
+		return *i.info, nil
+	}
+
+	info, err := fetchClusterInfo(ctx, i.config, i.transport)
+	if err != nil {
+		return info, err
+	}
+
+	i.info = &info
+	return info, nil
+}
+
+// checkVersion makes sure that the cluster is of the same kind as the client was created for
+func (i *Indexer) checkVersion(ctx context.Context) error {
+	info, err := i.Info(ctx)
+	if err != nil {
+		return err
+	}
+
+	flavor, err := info.Flavor()
+	if err != nil {
+		return fmt.Errorf("%w. Supported are Elasticsearch 7 and 8 and OpenSearch", err)
+	}
+
+	if flavor != i.flavor {
+		return fmt.Errorf(
+			"cluster is %s %s but the client is configured for %s. Set the flavor to auto to detect it",
+			flavor,
+			info.Version.Number,
+			i.flavor,
+		)
+	}
+
+	return nil
+}
+
+type nodeAllocation struct {
+	Node        string `json:"node"`
+	DiskPercent string `json:"disk.percent"`
+}
+
+const (
+	watermarkHigh       = "cluster.routing.allocation.disk.watermark.high"
+	watermarkFloodStage = "cluster.routing.allocation.disk.watermark.flood_stage"
+	diskThreshold       = "cluster.routing.allocation.disk.threshold_enabled"
+)
+
+// checkDiskWatermarks fails if any node is above the flood stage watermark since the
+// cluster will then make the indices read-only. Nodes above the high watermark only give a warning.
+func (i *Indexer) checkDiskWatermarks(ctx context.Context) error {
+	settings, err := i.clusterSettings(ctx)
+	if err != nil {
+		return err
+	}
+
+	if settings[diskThreshold] == "false" {
+		i.log.Debug("Disk thresholds are disabled in the cluster")
+		return nil
+	}
+
+	floodStage, floodOk := parseWatermark(settings[watermarkFloodStage])
+	high, highOk := parseWatermark(settings[watermarkHigh])
+	if !floodOk && !highOk {
+		i.log.Debugw("Disk watermarks are not percentages, skipping check",
+			"flood_stage", settings[watermarkFloodStage],
+			"high", settings[watermarkHigh],
+		)
+		return nil
+	}
+
+	resp, err := esapi.CatAllocationRequest{Format: "json"}.Do(ctx, i.client)
+	if err != nil {
+		return fmt.Errorf("Allocation request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.IsError() {
+		return newElasticError(resp)
+	}
+
+	var nodes []nodeAllocation
+	if err := json.NewDecoder(resp.Body).Decode(&nodes); err != nil {
+		return fmt.Errorf("could not decode allocation response: %w", err)
+	}
+
+	for _, node := range nodes {
+		// Unassigned shards are listed without any disk usage
+		used, err := strconv.ParseFloat(node.DiskPercent, 64)
+		if err != nil {
+			continue
+		}
+
+		switch {
+		case floodOk && used >= floodStage:
+			return fmt.Errorf(
+				"disk of node %s is %.0f%% full which is above the flood stage watermark of %.0f%%. "+
+					"Indices will be read-only until disk space is freed",
+				node.Node,
+				used,
+				floodStage,
+			)
+		case highOk && used >= high:
+			i.log.Warnf(
+				"Disk of node %s is %.0f%% full which is above the high watermark of %.0f%%. Shards will be moved away from it",
+				node.Node,
+				used,
+				high,
+			)
+		}
+	}
+
+	return nil
+}
+
+// clusterSettings returns the flattened cluster settings where transient
+// settings have precedence over persistent ones which have precedence over the defaults.
+func (i *Indexer) clusterSettings(ctx context.Context) (map[string]string, error) {
+	yes := true
+	resp, err := esapi.ClusterGetSettingsRequest{FlatSettings: &yes, IncludeDefaults: &yes}.Do(ctx, i.client)
+	if err != nil {
+		return nil, fmt.Errorf("Settings request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.IsError() {
+		return nil, newElasticError(resp)
+	}
+
+	var layers struct {
+		Defaults   map[string]any `json:"defaults"`
+		Persistent map[string]any `json:"persistent"`
+		Transient  map[string]any `json:"transient"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&layers); err != nil {
+		return nil, fmt.Errorf("could not decode settings response: %w", err)
+	}
+
+	settings := map[string]string{}
+	for _, layer := range []map[string]any{layers.Defaults, layers.Persistent, layers.Transient} {
+		for key, value := range layer {
+			if s, ok := value.(string); ok {
+				settings[key] = s
+			}
+		}
+	}
+
+	return settings, nil
+}
+
+// parseWatermark parses watermarks given as percentages ("90%") or ratios ("0.9") into a percentage.
+// Absolute values like "10gb" are not supported.
+func parseWatermark(value string) (float64, bool) {
+	if percent, found := strings.CutSuffix(value, "%"); found {
+		v, err := strconv.ParseFloat(percent, 64)
+		return v, err == nil
+	}
+
+	v, err := strconv.ParseFloat(value, 64)
+	if err != nil || v > 1 {
+		return 0, false
+	}
+	return v * 100, true
+}
+
+type hasPrivilegesResponse struct {
+	Username        string                     `json:"username"`
+	HasAllRequested bool                       `json:"has_all_requested"`
+	Index           map[string]map[string]bool `json:"index"`
+}
+
+// checkPrivileges makes sure the user has the privileges on the indices.
+// Skipped for OpenSearch and when security is disabled in the cluster.
+func (i *Indexer) checkPrivileges(ctx context.Context, indexNames []string, privileges []string) error {
+	if len(privileges) == 0 || len(indexNames) == 0 || i.flavor == FlavorOpenSearch {
+		return nil
+	}
+
+	body, err := json.Marshal(map[string]any{
+		"index": []map[string]any{{"names": indexNames, "privileges": privileges}},
+	})
+	if err != nil {
+		return fmt.Errorf("could not marshal privileges to json: %w", err)
+	}
+
+	resp, err := esapi.SecurityHasPrivilegesRequest{Body: bytes.NewReader(body)}.Do(ctx, i.client)
+	if err != nil {
+		return fmt.Errorf("Privileges request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.IsError() {
+		elasticErr := newElasticError(resp)
+		if strings.Contains(strings.ToLower(elasticErr.Reason), "security") {
+			i.log.Debugw("Security is not enabled, skipping privileges check", "reason", elasticErr.Reason)
+			return nil
+		}
+		return elasticErr
+	}
+
+	var result hasPrivilegesResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("could not decode privileges response: %w", err)
+	}
+
+	if result.HasAllRequested {
+		return nil
+	}
+
+	for _, indexName := range indexNames {
+		missing := []string{}
+		for privilege, granted := range result.Index[indexName] {
+			if !granted {
+				missing = append(missing, privilege)
+			}
+		}
+		if len(missing) == 0 {
+			continue
+		}
+		sort.Strings(missing)
+
+		return fmt.Errorf(
+			"user %q is missing the privileges [%s] on index %q. Grant them through a role assigned to the user",
+			result.Username,
+			strings.Join(missing, ", "),
+			indexName,
+		)
+	}
+
+	return fmt.Errorf("user %q is missing privileges on %v", result.Username, indexNames)
+}
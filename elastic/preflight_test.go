@@ -0,0 +1,120 @@
+package elastic
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/karatekaneen/crossrefindexer/elastictest"
+	"github.com/matryer/is"
+	"go.uber.org/zap"
+)
+
+func TestPreflight(t *testing.T) {
+	healthy := []elastictest.Option{
+		elastictest.WithPathResponse("/_cluster/health", elastictest.CaseHealthGreen),
+		elastictest.WithPathResponse("/_cluster/settings", elastictest.CaseClusterSettings),
+		elastictest.WithPathResponse("/_cat/allocation", elastictest.CaseAllocationOk),
+		elastictest.WithPathResponse("/_security/user/_has_privileges", elastictest.CaseHasPrivilegesOk),
+	}
+
+	tests := []struct {
+		name    string
+		flavor  Flavor
+		options []elastictest.Option
+		wantErr string
+	}{
+		{
+			name:    "happy path",
+			options: healthy,
+		},
+		{
+			name: "cluster stays red",
+			options: append(healthy,
+				elastictest.WithPathResponse("/_cluster/health", elastictest.CaseHealthRedTimedOut),
+			),
+			wantErr: "cluster health is red",
+		},
+		{
+			name:    "flavor does not match cluster",
+			flavor:  FlavorElasticsearch8,
+			options: healthy,
+			wantErr: "cluster is elasticsearch7 7.17.10 but the client is configured for elasticsearch8",
+		},
+		{
+			name: "disk above flood stage",
+			options: append(healthy,
+				elastictest.WithPathResponse("/_cat/allocation", elastictest.CaseAllocationDiskFull),
+			),
+			wantErr: "above the flood stage watermark of 95%",
+		},
+		{
+			name: "missing privileges",
+			options: append(healthy,
+				elastictest.WithPathResponse("/_security/user/_has_privileges", elastictest.CaseHasPrivilegesMissing),
+			),
+			wantErr: `user "indexer" is missing the privileges [create_index] on index "crossref"`,
+		},
+		{
+			name: "security disabled",
+			options: append(healthy,
+				elastictest.WithPathResponse("/_security/user/_has_privileges", elastictest.CaseHasPrivilegesSecurityDisabled),
+			),
+		},
+		{
+			name: "opensearch skips privileges",
+			options: append(healthy,
+				elastictest.WithInfo(elastictest.CaseInfoOpenSearch),
+				elastictest.WithPathResponse("/_security/user/_has_privileges", elastictest.CaseHasPrivilegesMissing),
+			),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			is := is.New(t)
+
+			// Copy the options so that the appends in the test cases don't share backing arrays
+			options := append([]elastictest.Option{}, tt.options...)
+			cfg := Config{Flavor: tt.flavor, WaitTimeout: 10 * time.Millisecond}
+			idx, err := New(context.Background(), cfg, zap.NewNop().Sugar(), WithTransport(elastictest.New(options...)))
+			is.NoErr(err)
+
+			err = idx.Preflight(context.Background(), []string{"crossref"}, "create_index", "index")
+			if tt.wantErr != "" {
+				is.True(err != nil)
+				is.True(strings.Contains(err.Error(), tt.wantErr)) // Error should explain what is wrong
+				return
+			}
+
+			is.NoErr(err)
+		})
+	}
+}
+
+func Test_parseWatermark(t *testing.T) {
+	tests := []struct {
+		input  string
+		want   float64
+		wantOk bool
+	}{
+		{input: "95%", want: 95, wantOk: true},
+		{input: "92.5%", want: 92.5, wantOk: true},
+		{input: "0.9", want: 90, wantOk: true},
+		{input: "10gb", wantOk: false},
+		{input: "", wantOk: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			is := is.New(t)
+
+			got, ok := parseWatermark(tt.input)
+			is.Equal(ok, tt.wantOk)
+			if tt.wantOk {
+				is.Equal(got, tt.want)
+			}
+		})
+	}
+}
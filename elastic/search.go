@@ -0,0 +1,53 @@
+package elastic
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/elastic/go-elasticsearch/v7/esapi"
+)
+
+// Hit is a single document returned from a search
+type Hit struct {
+	ID     string          `json:"_id"`
+	Score  float64         `json:"_score"`
+	Source json.RawMessage `json:"_source"`
+}
+
+type searchResponse struct {
+	Hits struct {
+		Hits []Hit `json:"hits"`
+	} `json:"hits"`
+}
+
+// Search runs the query against the index and returns at most `size` hits sorted by score.
+// The query is the content of the "query" key in the search request body.
+func (i *Indexer) Search(ctx context.Context, indexName string, query map[string]any, size int) ([]Hit, error) {
+	data, err := json.Marshal(map[string]any{"query": query})
+	if err != nil {
+		return nil, fmt.Errorf("could not marshal query to json: %w", err)
+	}
+
+	resp, err := esapi.SearchRequest{
+		Index: []string{indexName},
+		Body:  bytes.NewReader(data),
+		Size:  &size,
+	}.Do(ctx, i.client)
+	if err != nil {
+		return nil, fmt.Errorf("Search request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.IsError() {
+		return nil, newElasticError(resp)
+	}
+
+	var result searchResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("could not decode search response: %w", err)
+	}
+
+	return result.Hits.Hits, nil
+}
@@ -37,14 +37,80 @@ type Settings struct {
 }
 
 type FieldSetting struct {
-	Type     string `json:"type,omitempty"`
-	Analyzer string `json:"analyzer,omitempty"`
+	Type       string                  `json:"type,omitempty"`
+	Analyzer   string                  `json:"analyzer,omitempty"`
+	Format     string                  `json:"format,omitempty"`     // For date fields
+	Properties map[string]FieldSetting `json:"properties,omitempty"` // For object and nested fields
 }
 
 type Mappings struct {
 	Properties map[string]FieldSetting `json:"properties,omitempty"`
 }
 
+// updatesMapping maps the Crossmark updates. Nested so that the type and DOI of the same update can be matched together.
+func updatesMapping() FieldSetting {
+	return FieldSetting{
+		Type: "nested",
+		Properties: map[string]FieldSetting{
+			"type": {
+				Type: "keyword",
+			},
+			"DOI": {
+				Type:     "text",
+				Analyzer: "case_insensitive_keyword",
+			},
+		},
+	}
+}
+
+// authorsMapping maps the authors. Nested so that an ORCID or affiliation can be matched to the name of the same author.
+func authorsMapping() FieldSetting {
+	name := FieldSetting{
+		Type:     "text",
+		Analyzer: "case_insensitive_folding_text",
+	}
+	keyword := FieldSetting{Type: "keyword"}
+
+	return FieldSetting{
+		Type: "nested",
+		Properties: map[string]FieldSetting{
+			"given":               name,
+			"family":              name,
+			"suffix":              name,
+			"name":                name,
+			"sequence":            keyword,
+			"orcid":               keyword,
+			"authenticated_orcid": {Type: "boolean"},
+			"affiliation": {
+				Properties: map[string]FieldSetting{
+					"name": name,
+					"ids": {
+						Properties: map[string]FieldSetting{
+							"id":   keyword,
+							"type": keyword,
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+// partialDateMapping maps a date that is only as precise as its precision says, like 2006 or 2006-02
+func partialDateMapping() FieldSetting {
+	return FieldSetting{
+		Properties: map[string]FieldSetting{
+			"date": {
+				Type:   "date",
+				Format: "strict_date||strict_year_month||strict_year",
+			},
+			"precision": {
+				Type: "keyword",
+			},
+		},
+	}
+}
+
 func DefaultSettings(modifiers ...func(*IndexSettings)) IndexSettings {
 	settings := IndexSettings{
 		Settings: Settings{
@@ -90,6 +156,9 @@ func DefaultSettings(modifiers ...func(*IndexSettings)) IndexSettings {
 					Type:     "text",
 					Analyzer: "case_insensitive_keyword",
 				},
+				"original_doi": {
+					Type: "keyword",
+				},
 				"title": {
 					Type:     "text",
 					Analyzer: "case_insensitive_folding_text_stopwords",
@@ -102,10 +171,21 @@ func DefaultSettings(modifiers ...func(*IndexSettings)) IndexSettings {
 					Type:     "text",
 					Analyzer: "case_insensitive_folding_text",
 				},
+				"authors": authorsMapping(),
 				"first_page": {
 					Type:     "text",
 					Analyzer: "case_insensitive_folding_keyword",
 				},
+				"last_page": {
+					Type:     "text",
+					Analyzer: "case_insensitive_folding_keyword",
+				},
+				"page_count": {
+					Type: "integer",
+				},
+				"is_article_number": {
+					Type: "boolean",
+				},
 				"journal": {
 					Type:     "text",
 					Analyzer: "case_insensitive_folding_text_stopwords",
@@ -134,6 +214,109 @@ func DefaultSettings(modifiers ...func(*IndexSettings)) IndexSettings {
 					Type:     "text",
 					Analyzer: "case_insensitive_folding_text_stopwords",
 				},
+				"published_date": partialDateMapping(),
+				"dates": {
+					Properties: map[string]FieldSetting{
+						"issued":           partialDateMapping(),
+						"published_print":  partialDateMapping(),
+						"published_online": partialDateMapping(),
+						"created":          partialDateMapping(),
+					},
+				},
+				"is_retracted": {
+					Type: "boolean",
+				},
+				"updated_by": updatesMapping(),
+				"updates":    updatesMapping(),
+			},
+		},
+	}
+
+	// Apply modifiers
+	for _, modifier := range modifiers {
+		modifier(&settings)
+	}
+
+	return settings
+}
+
+// WithAbstract maps the abstract with a language analyzer like "english", see
+// https://www.elastic.co/guide/en/elasticsearch/reference/current/analysis-lang-analyzer.html
+func WithAbstract(analyzer string) func(*IndexSettings) {
+	return func(settings *IndexSettings) {
+		settings.Mappings.Properties["abstract"] = FieldSetting{
+			Type:     "text",
+			Analyzer: analyzer,
+		}
+	}
+}
+
+// WithExtended maps the fields of the extended profile. They are for filtering and display,
+// so they are keywords and dates rather than analyzed text.
+func WithExtended() func(*IndexSettings) {
+	return func(settings *IndexSettings) {
+		keyword := FieldSetting{Type: "keyword"}
+		date := FieldSetting{Type: "date"}
+
+		properties := map[string]FieldSetting{
+			"issn": keyword,
+			"issn_type": {
+				Type: "nested",
+				Properties: map[string]FieldSetting{
+					"value": keyword,
+					"type":  keyword,
+				},
+			},
+			"publisher": {
+				Type:     "text",
+				Analyzer: "case_insensitive_folding_keyword",
+			},
+			"member":  keyword,
+			"type":    keyword,
+			"subject": keyword,
+			"url":     keyword,
+			"license": {
+				Type: "nested",
+				Properties: map[string]FieldSetting{
+					"url":             keyword,
+					"content_version": keyword,
+					"delay_in_days":   {Type: "integer"},
+					"start":           date,
+				},
+			},
+			"deposited": date,
+			"indexed":   date,
+		}
+		for name, field := range properties {
+			settings.Mappings.Properties[name] = field
+		}
+	}
+}
+
+// CitationSettings are the settings of the index with citation edges. It uses the same analyzers as the publications.
+func CitationSettings(modifiers ...func(*IndexSettings)) IndexSettings {
+	settings := IndexSettings{
+		Settings: DefaultSettings().Settings,
+		Mappings: Mappings{
+			Properties: map[string]FieldSetting{
+				"citing_doi": {
+					Type:     "text",
+					Analyzer: "case_insensitive_keyword",
+				},
+				"cited_doi": {
+					Type:     "text",
+					Analyzer: "case_insensitive_keyword",
+				},
+				"doi_asserted_by": {
+					Type: "keyword",
+				},
+				"key": {
+					Type: "keyword",
+				},
+				"unstructured": {
+					Type:     "text",
+					Analyzer: "case_insensitive_folding_text",
+				},
 			},
 		},
 	}
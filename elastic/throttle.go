@@ -0,0 +1,173 @@
+package elastic
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// ThrottleConfig bounds how the adaptive bulk indexer may change concurrency and batch size
+type ThrottleConfig struct {
+	MinWorkers    int
+	MaxWorkers    int
+	MinFlushBytes int
+	MaxFlushBytes int
+	TargetLatency time.Duration // Bulk requests slower than this are a sign of an overloaded cluster
+}
+
+// throttleSample is what was observed from a single bulk request
+type throttleSample struct {
+	latency  time.Duration
+	rejected bool // The cluster responded with 429 or rejected items because its queues are full
+}
+
+// controller adjusts the number of workers and the flush size with additive increase and
+// multiplicative decrease, the same way TCP handles congestion. It backs off quickly when the
+// cluster pushes back and slowly probes for more throughput when requests are fast.
+type controller struct {
+	mu         sync.Mutex
+	changed    chan struct{} // Closed and replaced when a worker might have become free
+	cfg        ThrottleConfig
+	workers    int
+	flushBytes int
+	inFlight   int
+}
+
+func newController(cfg ThrottleConfig, workers, flushBytes int) *controller {
+	if cfg.MinWorkers < 1 {
+		cfg.MinWorkers = 1
+	}
+	if cfg.MaxWorkers < cfg.MinWorkers {
+		cfg.MaxWorkers = cfg.MinWorkers
+	}
+	if cfg.MaxFlushBytes < cfg.MinFlushBytes {
+		cfg.MaxFlushBytes = cfg.MinFlushBytes
+	}
+
+	return &controller{
+		changed:    make(chan struct{}),
+		cfg:        cfg,
+		workers:    clamp(workers, cfg.MinWorkers, cfg.MaxWorkers),
+		flushBytes: clamp(flushBytes, cfg.MinFlushBytes, cfg.MaxFlushBytes),
+	}
+}
+
+// observe adjusts the limits based on the outcome of a bulk request
+func (c *controller) observe(s throttleSample) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	switch {
+	case s.rejected:
+		// The cluster is overloaded so back off hard
+		c.workers = clamp(c.workers/2, c.cfg.MinWorkers, c.cfg.MaxWorkers)
+		c.flushBytes = clamp(c.flushBytes/2, c.cfg.MinFlushBytes, c.cfg.MaxFlushBytes)
+	case c.cfg.TargetLatency > 0 && s.latency > c.cfg.TargetLatency:
+		// Slow but still accepting, so send a bit less at the time
+		c.workers = clamp(c.workers-1, c.cfg.MinWorkers, c.cfg.MaxWorkers)
+		c.flushBytes = clamp(c.flushBytes*3/4, c.cfg.MinFlushBytes, c.cfg.MaxFlushBytes)
+	case c.cfg.TargetLatency <= 0 || s.latency < c.cfg.TargetLatency/2:
+		// Plenty of headroom, probe for more
+		c.workers = clamp(c.workers+1, c.cfg.MinWorkers, c.cfg.MaxWorkers)
+		c.flushBytes = clamp(c.flushBytes+c.flushBytes/4, c.cfg.MinFlushBytes, c.cfg.MaxFlushBytes)
+	}
+
+	// More workers might be allowed now
+	c.broadcast()
+}
+
+// acquire blocks until there are fewer requests in flight than the current number of workers,
+// or until the context is cancelled
+func (c *controller) acquire(ctx context.Context) error {
+	for {
+		c.mu.Lock()
+		if c.inFlight < c.workers {
+			c.inFlight++
+			c.mu.Unlock()
+			return nil
+		}
+		changed := c.changed
+		c.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-changed:
+		}
+	}
+}
+
+func (c *controller) release() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.inFlight--
+	c.broadcast()
+}
+
+// broadcast wakes up everyone waiting in acquire. The lock must be held.
+func (c *controller) broadcast() {
+	close(c.changed)
+	c.changed = make(chan struct{})
+}
+
+// limits returns the current number of workers and flush size
+func (c *controller) limits() (workers, flushBytes int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.workers, c.flushBytes
+}
+
+func clamp(v, lower, upper int) int {
+	if v < lower {
+		return lower
+	}
+	if v > upper {
+		return upper
+	}
+	return v
+}
+
+// pacer limits the rate of documents to a ceiling. A zero rate means no limit.
+type pacer struct {
+	mu       sync.Mutex
+	interval time.Duration // Time per document
+	next     time.Time     // When the next document may be sent
+}
+
+func newPacer(docsPerSecond int) *pacer {
+	p := &pacer{}
+	if docsPerSecond > 0 {
+		p.interval = time.Second / time.Duration(docsPerSecond)
+	}
+	return p
+}
+
+// wait blocks until n more documents may be sent without exceeding the rate
+func (p *pacer) wait(ctx context.Context, n int) error {
+	if p.interval == 0 {
+		return nil
+	}
+
+	p.mu.Lock()
+	now := time.Now()
+	if p.next.Before(now) {
+		p.next = now
+	}
+	sendAt := p.next
+	p.next = p.next.Add(time.Duration(n) * p.interval)
+	p.mu.Unlock()
+
+	delay := time.Until(sendAt)
+	if delay <= 0 {
+		return nil
+	}
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(delay):
+		return nil
+	}
+}
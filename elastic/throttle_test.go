@@ -0,0 +1,178 @@
+package elastic
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+)
+
+func TestControllerObserve(t *testing.T) {
+	cfg := ThrottleConfig{
+		MinWorkers:    1,
+		MaxWorkers:    8,
+		MinFlushBytes: 1000,
+		MaxFlushBytes: 16000,
+		TargetLatency: time.Second,
+	}
+
+	tests := []struct {
+		name           string
+		workers        int
+		flushBytes     int
+		samples        []throttleSample
+		wantWorkers    int
+		wantFlushBytes int
+	}{
+		{
+			name:           "fast requests increase",
+			workers:        4,
+			flushBytes:     4000,
+			samples:        []throttleSample{{latency: 100 * time.Millisecond}},
+			wantWorkers:    5,
+			wantFlushBytes: 5000,
+		},
+		{
+			name:           "rejections halve",
+			workers:        4,
+			flushBytes:     4000,
+			samples:        []throttleSample{{latency: 100 * time.Millisecond, rejected: true}},
+			wantWorkers:    2,
+			wantFlushBytes: 2000,
+		},
+		{
+			name:           "slow requests decrease",
+			workers:        4,
+			flushBytes:     4000,
+			samples:        []throttleSample{{latency: 2 * time.Second}},
+			wantWorkers:    3,
+			wantFlushBytes: 3000,
+		},
+		{
+			name:           "close to target keeps",
+			workers:        4,
+			flushBytes:     4000,
+			samples:        []throttleSample{{latency: 800 * time.Millisecond}},
+			wantWorkers:    4,
+			wantFlushBytes: 4000,
+		},
+		{
+			name:           "never below min",
+			workers:        1,
+			flushBytes:     1000,
+			samples:        []throttleSample{{rejected: true}, {rejected: true}},
+			wantWorkers:    1,
+			wantFlushBytes: 1000,
+		},
+		{
+			name:           "never above max",
+			workers:        8,
+			flushBytes:     16000,
+			samples:        []throttleSample{{}, {}, {}},
+			wantWorkers:    8,
+			wantFlushBytes: 16000,
+		},
+		{
+			name:           "start is clamped to bounds",
+			workers:        32,
+			flushBytes:     10,
+			wantWorkers:    8,
+			wantFlushBytes: 1000,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			is := is.New(t)
+
+			c := newController(cfg, tt.workers, tt.flushBytes)
+			for _, s := range tt.samples {
+				c.observe(s)
+			}
+
+			workers, flushBytes := c.limits()
+			is.Equal(workers, tt.wantWorkers)
+			is.Equal(flushBytes, tt.wantFlushBytes)
+		})
+	}
+}
+
+func TestControllerAcquire(t *testing.T) {
+	is := is.New(t)
+
+	ctx := context.Background()
+	c := newController(ThrottleConfig{MinWorkers: 1, MaxWorkers: 4}, 2, 0)
+	is.NoErr(c.acquire(ctx))
+	is.NoErr(c.acquire(ctx))
+
+	acquired := make(chan struct{})
+	go func() {
+		if err := c.acquire(ctx); err != nil {
+			t.Error(err)
+		}
+		close(acquired)
+	}()
+
+	select {
+	case <-acquired:
+		t.Fatal("acquired more than the number of workers")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	c.release()
+	select {
+	case <-acquired:
+	case <-time.After(time.Second):
+		t.Fatal("release did not let the waiting worker through")
+	}
+
+	is.Equal(c.inFlight, 2)
+}
+
+func TestControllerAcquireCancelled(t *testing.T) {
+	is := is.New(t)
+
+	c := newController(ThrottleConfig{MinWorkers: 1, MaxWorkers: 1}, 1, 0)
+	is.NoErr(c.acquire(context.Background()))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	result := make(chan error)
+	go func() { result <- c.acquire(ctx) }()
+
+	cancel()
+	select {
+	case err := <-result:
+		is.True(errors.Is(err, context.Canceled))
+	case <-time.After(time.Second):
+		t.Fatal("cancelling did not stop the wait for a worker")
+	}
+
+	is.Equal(c.inFlight, 1) // The cancelled wait did not take a worker
+}
+
+func TestPacer(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+
+	unlimited := newPacer(0)
+	start := time.Now()
+	for n := 0; n < 1000; n++ {
+		is.NoErr(unlimited.wait(ctx, 1))
+	}
+	is.True(time.Since(start) < 100*time.Millisecond) // No limit should not wait
+
+	limited := newPacer(100)
+	start = time.Now()
+	for n := 0; n < 6; n++ {
+		is.NoErr(limited.wait(ctx, 1))
+	}
+	is.True(time.Since(start) >= 50*time.Millisecond) // 6 documents at 100/s take at least 50ms
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	limited = newPacer(1)
+	is.NoErr(limited.wait(cancelled, 1))       // The first document is sent at once
+	is.True(limited.wait(cancelled, 1) != nil) // Waiting for the next one is cancelled
+}
@@ -1,20 +1,45 @@
 package elastictest
 
 import (
+	"bytes"
 	"io"
 	"log"
 	"net/http"
 	"os"
 	"path/filepath"
-	"strings"
+	"sync"
 
 	"github.com/pkg/errors"
 )
 
 type ElasticTransport struct {
 	validation func(*http.Request) error // To validate the request being made
-	response   io.ReadCloser             // The data to send back
+	response   []byte                    // The data to send back
 	code       int                       // Statuscode to return
+	info       []byte                    // The data to send back from the root endpoint
+	product    bool                      // If the Elastic product header should be set
+	routes     map[string]*route         // Responses for specific paths
+}
+
+// route responds with the responses in order and repeats the last one when they run out
+type route struct {
+	mu        sync.Mutex
+	responses [][]byte
+	codes     []int
+	calls     int
+}
+
+func (r *route) next() (int, []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	n := r.calls
+	if n >= len(r.responses) {
+		n = len(r.responses) - 1
+	}
+	r.calls++
+
+	return r.codes[n], r.responses[n]
 }
 
 type (
@@ -34,6 +59,82 @@ var (
 		path:       "testdata/elastic/create_index_conflict.json",
 		statusCode: 400,
 	}
+	CaseInfoElasticsearch7 = TestCase{
+		path:       "testdata/elastic/info_elasticsearch7.json",
+		statusCode: 200,
+	}
+	CaseInfoElasticsearch8 = TestCase{
+		path:       "testdata/elastic/info_elasticsearch8.json",
+		statusCode: 200,
+	}
+	CaseInfoOpenSearch = TestCase{
+		path:       "testdata/elastic/info_opensearch.json",
+		statusCode: 200,
+	}
+	CaseBulkOk = TestCase{
+		path:       "testdata/elastic/bulk_ok.json",
+		statusCode: 200,
+	}
+	CaseBulkPartialFailure = TestCase{
+		path:       "testdata/elastic/bulk_partial_failure.json",
+		statusCode: 200,
+	}
+	CaseBulkVersionConflict = TestCase{
+		path:       "testdata/elastic/bulk_version_conflict.json",
+		statusCode: 200,
+	}
+	CaseBulkRejected = TestCase{
+		path:       "testdata/elastic/bulk_rejected.json",
+		statusCode: 200,
+	}
+	CaseBulkRejectedAll = TestCase{
+		path:       "testdata/elastic/bulk_rejected_all.json",
+		statusCode: 200,
+	}
+	CaseRefreshOk = TestCase{
+		path:       "testdata/elastic/refresh_ok.json",
+		statusCode: 200,
+	}
+	CaseCountOk = TestCase{
+		path:       "testdata/elastic/count_ok.json",
+		statusCode: 200,
+	}
+	CaseMgetOk = TestCase{
+		path:       "testdata/elastic/mget_ok.json",
+		statusCode: 200,
+	}
+	CaseHealthGreen = TestCase{
+		path:       "testdata/elastic/cluster_health_green.json",
+		statusCode: 200,
+	}
+	CaseHealthRedTimedOut = TestCase{
+		path:       "testdata/elastic/cluster_health_red.json",
+		statusCode: 408,
+	}
+	CaseClusterSettings = TestCase{
+		path:       "testdata/elastic/cluster_settings.json",
+		statusCode: 200,
+	}
+	CaseAllocationOk = TestCase{
+		path:       "testdata/elastic/cat_allocation_ok.json",
+		statusCode: 200,
+	}
+	CaseAllocationDiskFull = TestCase{
+		path:       "testdata/elastic/cat_allocation_disk_full.json",
+		statusCode: 200,
+	}
+	CaseHasPrivilegesOk = TestCase{
+		path:       "testdata/elastic/has_privileges_ok.json",
+		statusCode: 200,
+	}
+	CaseHasPrivilegesMissing = TestCase{
+		path:       "testdata/elastic/has_privileges_missing.json",
+		statusCode: 200,
+	}
+	CaseHasPrivilegesSecurityDisabled = TestCase{
+		path:       "testdata/elastic/has_privileges_security_disabled.json",
+		statusCode: 500,
+	}
 	CaseDeleteIndexOk = TestCase{
 		path:       "testdata/elastic/delete_index_ok.json",
 		statusCode: 200,
@@ -42,6 +143,18 @@ var (
 		path:       "testdata/elastic/delete_index_notfound.json",
 		statusCode: 404,
 	}
+	CaseSearchOk = TestCase{
+		path:       "testdata/elastic/search_ok.json",
+		statusCode: 200,
+	}
+	CaseSearchEmpty = TestCase{
+		path:       "testdata/elastic/search_empty.json",
+		statusCode: 200,
+	}
+	CaseSearchIndexNotFound = TestCase{
+		path:       "testdata/elastic/search_notfound.json",
+		statusCode: 404,
+	}
 )
 
 func WithValidation(val func(*http.Request) error) Option {
@@ -51,27 +164,53 @@ func WithValidation(val func(*http.Request) error) Option {
 // WithResponse reads the testfile into the response.
 // Will crash if file reading goes wrong.
 func WithResponse(tCase TestCase) Option {
-	root, err := getProjectRoot()
-	if err != nil {
-		log.Fatal(err) // In test code we crash everything!
+	data := readTestCase(tCase)
+
+	return func(et *ElasticTransport) {
+		et.response = data
+		et.code = tCase.statusCode
 	}
+}
 
-	f, err := os.Open(filepath.Join(root, tCase.path))
-	if err != nil {
-		log.Fatal(err)
+// WithPathResponse reads the testfile into the response for requests to the path.
+// Requests to other paths get the response from WithResponse.
+func WithPathResponse(path string, tCase TestCase) Option {
+	return WithPathResponses(path, tCase)
+}
+
+// WithPathResponses responds to requests to the path with the testfiles in order.
+// The last one is repeated for the requests after that.
+func WithPathResponses(path string, tCases ...TestCase) Option {
+	r := &route{}
+	for _, tCase := range tCases {
+		r.responses = append(r.responses, readTestCase(tCase))
+		r.codes = append(r.codes, tCase.statusCode)
 	}
 
 	return func(et *ElasticTransport) {
-		et.response = f
-		et.code = tCase.statusCode
+		et.routes[path] = r
+	}
+}
+
+// WithInfo sets the response of the root endpoint which is used to detect the kind of cluster.
+// Responses for OpenSearch are sent without the Elastic product header.
+func WithInfo(tCase TestCase) Option {
+	data := readTestCase(tCase)
+
+	return func(et *ElasticTransport) {
+		et.info = data
+		et.product = tCase != CaseInfoOpenSearch
 	}
 }
 
 func New(options ...Option) *ElasticTransport {
 	e := &ElasticTransport{
 		validation: func(r *http.Request) error { return nil },
-		response:   io.NopCloser(strings.NewReader(`{}`)),
+		response:   []byte(`{}`),
 		code:       http.StatusOK,
+		info:       readTestCase(CaseInfoElasticsearch7),
+		product:    true,
+		routes:     map[string]*route{},
 	}
 
 	for _, option := range options {
@@ -81,37 +220,63 @@ func New(options ...Option) *ElasticTransport {
 	return e
 }
 
-// This is a naive solution to be able to open files simply
-// when you're running tests from different working directories.
-//
-// * Will probably crash in some environments *
+func readTestCase(tCase TestCase) []byte {
+	root, err := getProjectRoot()
+	if err != nil {
+		log.Fatal(err) // In test code we crash everything!
+	}
+
+	data, err := os.ReadFile(filepath.Join(root, tCase.path))
+	if err != nil {
+		log.Fatal(err)
+	}
+	return data
+}
+
+// getProjectRoot walks up from the working directory until it finds the go.mod file
+// so that test files can be opened no matter which package the tests are run from.
 func getProjectRoot() (string, error) {
 	wd, err := os.Getwd()
 	if err != nil {
 		return "", errors.Wrap(err, "could not get project root path")
 	}
 
-	projectName := "crossrefindexer"
-	parentFolder, _, _ := strings.Cut(wd, projectName)
-	return filepath.Join(parentFolder, projectName), nil
+	for dir := wd; ; dir = filepath.Dir(dir) {
+		if _, err := os.Stat(filepath.Join(dir, "go.mod")); err == nil {
+			return dir, nil
+		}
+
+		if dir == filepath.Dir(dir) {
+			return "", errors.Errorf("could not find project root from %s", wd)
+		}
+	}
 }
 
 func (et *ElasticTransport) RoundTrip(r *http.Request) (*http.Response, error) {
 	if r.URL.Path == "/" && r.Method == "GET" {
-		return response(http.StatusOK, io.NopCloser(strings.NewReader(""))), nil
+		return et.respond(http.StatusOK, et.info), nil
 	}
 	if err := et.validation(r); err != nil {
 		return nil, err
 	}
 
-	// * The header is needed so that the Elastic client won't shit itself
-	return response(et.code, et.response), nil
+	if route, ok := et.routes[r.URL.Path]; ok {
+		return et.respond(route.next()), nil
+	}
+
+	return et.respond(et.code, et.response), nil
 }
 
-func response(status int, body io.ReadCloser) *http.Response {
+func (et *ElasticTransport) respond(status int, body []byte) *http.Response {
+	header := http.Header{"Content-Type": []string{"application/json"}}
+	if et.product {
+		// * The header is needed so that the Elastic client won't shit itself
+		header.Set("X-Elastic-Product", "Elasticsearch")
+	}
+
 	return &http.Response{
 		StatusCode: status,
-		Body:       body,
-		Header:     http.Header{"X-Elastic-Product": []string{"Elasticsearch"}},
+		Body:       io.NopCloser(bytes.NewReader(body)),
+		Header:     header,
 	}
 }
@@ -0,0 +1,135 @@
+package export
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/karatekaneen/crossrefindexer"
+)
+
+// bibtexTypes maps Crossref types to BibTeX entry types. Anything else is misc.
+var bibtexTypes = map[string]string{
+	"journal-article":     "article",
+	"proceedings-article": "inproceedings",
+	"book-chapter":        "incollection",
+	"book-section":        "incollection",
+	"book-part":           "incollection",
+	"book":                "book",
+	"edited-book":         "book",
+	"monograph":           "book",
+	"reference-book":      "book",
+	"dissertation":        "phdthesis",
+	"report":              "techreport",
+}
+
+// bibtexKeyInvalid is what can't be in a citation key. DOIs are used as keys since they are unique.
+var bibtexKeyInvalid = regexp.MustCompile(`[^A-Za-z0-9._:/-]`)
+
+// bibtexEscape escapes the characters that mean something to LaTeX. Unicode is kept as is.
+var bibtexEscape = strings.NewReplacer(
+	`\`, `\textbackslash{}`,
+	`{`, `\{`,
+	`}`, `\}`,
+	`&`, `\&`,
+	`%`, `\%`,
+	`$`, `\$`,
+	`#`, `\#`,
+	`_`, `\_`,
+	`~`, `\textasciitilde{}`,
+	`^`, `\textasciicircum{}`,
+)
+
+// bibtexVerbatimEscape makes values of verbatim fields, like doi and url, safe to put in braces. Nothing else
+// is escaped since LaTeX doesn't interpret them, and braces are percent encoded as in a URL.
+var bibtexVerbatimEscape = strings.NewReplacer(`{`, `%7B`, `}`, `%7D`)
+
+var bibtexMonths = []string{"jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec"}
+
+type bibtexEncoder struct {
+	w io.Writer
+}
+
+func (e *bibtexEncoder) Encode(pub crossrefindexer.SimplifiedPublication) error {
+	_, err := io.WriteString(e.w, toBibTeX(pub))
+	return err
+}
+
+func (e *bibtexEncoder) Close() error { return nil }
+
+func toBibTeX(pub crossrefindexer.SimplifiedPublication) string {
+	ext := extended(pub)
+
+	entryType := bibtexTypes[ext.Type]
+	if entryType == "" {
+		entryType = "misc"
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "@%s{%s,\n", entryType, bibtexKeyInvalid.ReplaceAllString(pub.DOI, "_"))
+
+	field := func(name, value string) {
+		if value != "" {
+			fmt.Fprintf(&b, "  %s = {%s},\n", name, bibtexEscape.Replace(value))
+		}
+	}
+	verbatim := func(name, value string) {
+		if value != "" {
+			fmt.Fprintf(&b, "  %s = {%s},\n", name, bibtexVerbatimEscape.Replace(value))
+		}
+	}
+
+	authors := make([]string, 0, len(pub.Authors))
+	for _, author := range pub.Authors {
+		switch {
+		case author.Family == "" && author.Name != "":
+			// Extra braces keep organizations from being split into first and last names
+			authors = append(authors, "{"+bibtexEscape.Replace(author.Name)+"}")
+		case author.Family != "":
+			name := []string{author.Family}
+			if author.Suffix != "" {
+				name = append(name, author.Suffix)
+			}
+			if author.Given != "" {
+				name = append(name, author.Given)
+			}
+			authors = append(authors, bibtexEscape.Replace(strings.Join(name, ", ")))
+		}
+	}
+	if len(authors) > 0 {
+		fmt.Fprintf(&b, "  author = {%s},\n", strings.Join(authors, " and "))
+	}
+
+	field("title", first(pub.Title))
+	switch entryType {
+	case "article":
+		field("journal", first(pub.Journal))
+	case "inproceedings", "incollection":
+		field("booktitle", first(pub.Journal))
+	}
+
+	if parts := dateParts(pub.PublishedDate); len(parts) > 0 {
+		field("year", fmt.Sprintf("%04d", parts[0]))
+		if len(parts) > 1 && parts[1] >= 1 && parts[1] <= 12 {
+			// Months are written as macros without braces
+			fmt.Fprintf(&b, "  month = %s,\n", bibtexMonths[parts[1]-1])
+		}
+	}
+
+	field("volume", pub.Volume)
+	field("number", pub.Issue)
+	if pub.LastPage != "" && pub.LastPage != pub.FirstPage {
+		field("pages", pub.FirstPage+"--"+pub.LastPage)
+	} else {
+		field("pages", pub.FirstPage)
+	}
+	field("publisher", ext.Publisher)
+	field("issn", first(ext.ISSN))
+	verbatim("doi", pub.DOI)
+	verbatim("url", ext.URL)
+	field("abstract", pub.Abstract)
+
+	b.WriteString("}\n\n")
+	return b.String()
+}
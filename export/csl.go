@@ -0,0 +1,139 @@
+package export
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/karatekaneen/crossrefindexer"
+)
+
+// cslTypes maps Crossref types to CSL types. Anything else is an article.
+// See https://docs.citationstyles.org/en/stable/specification.html#appendix-iii-types
+var cslTypes = map[string]string{
+	"journal-article":     "article-journal",
+	"proceedings-article": "paper-conference",
+	"book-chapter":        "chapter",
+	"book-section":        "chapter",
+	"book-part":           "chapter",
+	"reference-entry":     "entry",
+	"book":                "book",
+	"edited-book":         "book",
+	"monograph":           "book",
+	"reference-book":      "book",
+	"dissertation":        "thesis",
+	"report":              "report",
+	"dataset":             "dataset",
+	"standard":            "standard",
+	"peer-review":         "review",
+	"posted-content":      "article",
+}
+
+type cslItem struct {
+	ID                  string    `json:"id"`
+	Type                string    `json:"type"`
+	Title               string    `json:"title,omitempty"`
+	ContainerTitle      string    `json:"container-title,omitempty"`
+	ContainerTitleShort string    `json:"container-title-short,omitempty"`
+	Author              []cslName `json:"author,omitempty"`
+	Issued              *cslDate  `json:"issued,omitempty"`
+	Volume              string    `json:"volume,omitempty"`
+	Issue               string    `json:"issue,omitempty"`
+	Page                string    `json:"page,omitempty"`
+	Number              string    `json:"number,omitempty"` // Article number
+	Publisher           string    `json:"publisher,omitempty"`
+	DOI                 string    `json:"DOI,omitempty"`
+	URL                 string    `json:"URL,omitempty"`
+	ISSN                string    `json:"ISSN,omitempty"`
+	Abstract            string    `json:"abstract,omitempty"`
+}
+
+type cslName struct {
+	Family  string `json:"family,omitempty"`
+	Given   string `json:"given,omitempty"`
+	Suffix  string `json:"suffix,omitempty"`
+	Literal string `json:"literal,omitempty"` // Organizations
+}
+
+type cslDate struct {
+	DateParts [][]int `json:"date-parts"`
+}
+
+// cslEncoder writes a JSON array with one item per line
+type cslEncoder struct {
+	w     io.Writer
+	count int
+}
+
+func (e *cslEncoder) Encode(pub crossrefindexer.SimplifiedPublication) error {
+	data, err := json.Marshal(toCSL(pub))
+	if err != nil {
+		return fmt.Errorf("could not encode %s: %w", pub.DOI, err)
+	}
+
+	separator := ",\n"
+	if e.count == 0 {
+		separator = "[\n"
+	}
+	e.count++
+
+	if _, err := io.WriteString(e.w, separator); err != nil {
+		return err
+	}
+	_, err = e.w.Write(data)
+	return err
+}
+
+func (e *cslEncoder) Close() error {
+	end := "\n]\n"
+	if e.count == 0 {
+		end = "[]\n"
+	}
+	_, err := io.WriteString(e.w, end)
+	return err
+}
+
+func toCSL(pub crossrefindexer.SimplifiedPublication) cslItem {
+	ext := extended(pub)
+
+	item := cslItem{
+		ID:                  pub.DOI,
+		Type:                cslTypes[ext.Type],
+		Title:               first(pub.Title),
+		ContainerTitle:      first(pub.Journal),
+		ContainerTitleShort: first(pub.AbbreviatedJournal),
+		Volume:              pub.Volume,
+		Issue:               pub.Issue,
+		Publisher:           ext.Publisher,
+		DOI:                 pub.DOI,
+		URL:                 ext.URL,
+		ISSN:                first(ext.ISSN),
+		Abstract:            pub.Abstract,
+	}
+	if item.Type == "" {
+		item.Type = "article"
+	}
+
+	for _, author := range pub.Authors {
+		if author.Family == "" && author.Name != "" {
+			item.Author = append(item.Author, cslName{Literal: author.Name})
+			continue
+		}
+		item.Author = append(item.Author, cslName{Family: author.Family, Given: author.Given, Suffix: author.Suffix})
+	}
+
+	if parts := dateParts(pub.PublishedDate); len(parts) > 0 {
+		item.Issued = &cslDate{DateParts: [][]int{parts}}
+	}
+
+	switch {
+	case pub.IsArticleNumber:
+		item.Number = pub.FirstPage
+	case pub.LastPage != "" && pub.LastPage != pub.FirstPage:
+		item.Page = pub.FirstPage + "-" + pub.LastPage
+	default:
+		item.Page = pub.FirstPage
+	}
+
+	return item
+}
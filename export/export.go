@@ -0,0 +1,142 @@
+// Package export writes Crossref metadata in formats that citation managers can import.
+package export
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/karatekaneen/crossrefindexer"
+)
+
+// Names of the supported formats
+const (
+	FormatCSLJSON = "csl-json"
+	FormatBibTeX  = "bibtex"
+	FormatRIS     = "ris"
+	FormatParquet = "parquet" // Written to a directory with NewParquetEncoder
+)
+
+// Encoder writes publications one at a time so that nothing has to be kept in memory
+type Encoder interface {
+	Encode(pub crossrefindexer.SimplifiedPublication) error
+	// Close writes whatever ends the file. It does not close the underlying writer.
+	Close() error
+}
+
+// NewEncoder creates an encoder for the format that writes to w
+func NewEncoder(format string, w io.Writer) (Encoder, error) {
+	switch format {
+	case FormatCSLJSON:
+		return &cslEncoder{w: w}, nil
+	case FormatBibTeX:
+		return &bibtexEncoder{w: w}, nil
+	case FormatRIS:
+		return &risEncoder{w: w}, nil
+	default:
+		return nil, fmt.Errorf("unknown export format %q", format)
+	}
+}
+
+// Simplify converts a record with everything the export formats can use
+func Simplify(pub *crossrefindexer.Crossref) crossrefindexer.SimplifiedPublication {
+	return crossrefindexer.ToSimplifiedPublication(pub, crossrefindexer.WithExtended(), crossrefindexer.WithAbstract())
+}
+
+// Filter selects the publications to export. Empty fields don't filter anything.
+// A publication must match all fields that are set, but only one of the values in each.
+type Filter struct {
+	Types         []string // Crossref types, like journal-article
+	Prefixes      []string // DOI prefixes, like 10.1002
+	ISSNs         []string
+	Members       []string // Crossref member ids
+	FromYear      int
+	ToYear        int
+	SkipRetracted bool
+}
+
+// Match is true if the publication should be exported. It must have been simplified with Simplify.
+func (f Filter) Match(pub crossrefindexer.SimplifiedPublication) bool {
+	extended := pub.ExtendedMetadata
+	if extended == nil {
+		extended = &crossrefindexer.ExtendedMetadata{}
+	}
+
+	if len(f.Types) > 0 && !containsFold(f.Types, extended.Type) {
+		return false
+	}
+	if len(f.Prefixes) > 0 {
+		prefix, _, _ := strings.Cut(pub.DOI, "/")
+		if !containsFold(f.Prefixes, prefix) {
+			return false
+		}
+	}
+	if len(f.ISSNs) > 0 && !containsAny(f.ISSNs, extended.ISSN) {
+		return false
+	}
+	if len(f.Members) > 0 && !containsFold(f.Members, extended.Member) {
+		return false
+	}
+	if f.FromYear != 0 && pub.Year < f.FromYear {
+		return false
+	}
+	if f.ToYear != 0 && (pub.Year == 0 || pub.Year > f.ToYear) {
+		return false
+	}
+	if f.SkipRetracted && pub.IsRetracted {
+		return false
+	}
+	return true
+}
+
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsAny(values, candidates []string) bool {
+	for _, candidate := range candidates {
+		if containsFold(values, candidate) {
+			return true
+		}
+	}
+	return false
+}
+
+// first returns the first value or an empty string
+func first(values []string) string {
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+// dateParts splits a partial date like 2006-02 into its numbers
+func dateParts(date *crossrefindexer.PartialDate) []int {
+	if date == nil {
+		return nil
+	}
+
+	var parts []int
+	for _, part := range strings.Split(date.Date, "-") {
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			return parts
+		}
+		parts = append(parts, n)
+	}
+	return parts
+}
+
+// extended returns the extended metadata that Simplify adds, or an empty one
+func extended(pub crossrefindexer.SimplifiedPublication) crossrefindexer.ExtendedMetadata {
+	if pub.ExtendedMetadata == nil {
+		return crossrefindexer.ExtendedMetadata{}
+	}
+	return *pub.ExtendedMetadata
+}
@@ -0,0 +1,192 @@
+package export
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/karatekaneen/crossrefindexer"
+	"github.com/matryer/is"
+)
+
+func einstein() *crossrefindexer.Crossref {
+	given, family, first := "A.", "Einstein", "first"
+	consortium := "The Relativity Group"
+	abstract := "<jats:p>On the <jats:italic>electrodynamics</jats:italic> of moving bodies.</jats:p>"
+	short := []string{"Ann. Phys."}
+
+	return &crossrefindexer.Crossref{
+		Doi:                 "10.1002/ANDP.19053221004",
+		Type:                "journal-article",
+		Title:               []string{"Zur Elektrodynamik bewegter Körper"},
+		ContainerTitle:      []string{"Annalen der Physik"},
+		ShortContainerTitle: &short,
+		Author: []crossrefindexer.Author{
+			{Given: &given, Family: &family, Sequence: &first},
+			{Name: &consortium},
+		},
+		Issued:    crossrefindexer.DateParts{DateParts: [][]int{{1905, 6}}},
+		Volume:    "322",
+		Issue:     "10",
+		Page:      "891-921",
+		Publisher: "Wiley",
+		Issn:      []string{"0003-3804"},
+		URL:       "http://dx.doi.org/10.1002/andp.19053221004",
+		Abstract:  &abstract,
+	}
+}
+
+func encode(t *testing.T, format string, pubs ...*crossrefindexer.Crossref) string {
+	is := is.New(t)
+
+	var buf bytes.Buffer
+	encoder, err := NewEncoder(format, &buf)
+	is.NoErr(err)
+	for _, pub := range pubs {
+		is.NoErr(encoder.Encode(Simplify(pub)))
+	}
+	is.NoErr(encoder.Close())
+	return buf.String()
+}
+
+func TestCSLJSON(t *testing.T) {
+	is := is.New(t)
+
+	other := einstein()
+	other.Doi = "10.1000/other"
+	other.Type = "dataset"
+	other.Page = "e1234"
+
+	var items []map[string]any
+	is.NoErr(json.Unmarshal([]byte(encode(t, FormatCSLJSON, einstein(), other)), &items))
+	is.Equal(len(items), 2)
+
+	item := items[0]
+	is.Equal(item["id"], "10.1002/andp.19053221004")
+	is.Equal(item["type"], "article-journal")
+	is.Equal(item["title"], "Zur Elektrodynamik bewegter Körper")
+	is.Equal(item["container-title"], "Annalen der Physik")
+	is.Equal(item["container-title-short"], "Ann. Phys.")
+	is.Equal(item["page"], "891-921")
+	is.Equal(item["ISSN"], "0003-3804")
+	is.Equal(item["abstract"], "On the electrodynamics of moving bodies.")
+
+	authors, err := json.Marshal(item["author"])
+	is.NoErr(err)
+	is.Equal(string(authors), `[{"family":"Einstein","given":"A."},{"literal":"The Relativity Group"}]`)
+	issued, err := json.Marshal(item["issued"])
+	is.NoErr(err)
+	is.Equal(string(issued), `{"date-parts":[[1905,6]]}`)
+
+	is.Equal(items[1]["type"], "dataset")
+	is.Equal(items[1]["number"], "e1234")
+	is.Equal(items[1]["page"], nil)
+
+	// An empty export is still valid JSON
+	is.Equal(encode(t, FormatCSLJSON), "[]\n")
+}
+
+func TestBibTeX(t *testing.T) {
+	is := is.New(t)
+
+	pub := einstein()
+	pub.Title = []string{"Costs & 100% of $x_1$"}
+
+	is.Equal(encode(t, FormatBibTeX, pub), `@article{10.1002/andp.19053221004,
+  author = {Einstein, A. and {The Relativity Group}},
+  title = {Costs \& 100\% of \$x\_1\$},
+  journal = {Annalen der Physik},
+  year = {1905},
+  month = jun,
+  volume = {322},
+  number = {10},
+  pages = {891--921},
+  publisher = {Wiley},
+  issn = {0003-3804},
+  doi = {10.1002/andp.19053221004},
+  url = {http://dx.doi.org/10.1002/andp.19053221004},
+  abstract = {On the electrodynamics of moving bodies.},
+}
+
+`)
+}
+
+func TestBibTeXVerbatimFields(t *testing.T) {
+	is := is.New(t)
+
+	// SICI DOIs contain characters that LaTeX would otherwise need escaped
+	pub := einstein()
+	pub.Doi = "10.1002/(SICI)1097-4636(199606)31:2<213::AID-JBM8>3.0.CO;2-#"
+	pub.URL = "http://dx.doi.org/10.1002/(SICI)1097-4636(199606)31:2<213::AID-JBM8>3.0.CO;2-#"
+	pub.Title = []string{"Under_score"}
+
+	bibtex := encode(t, FormatBibTeX, pub)
+	is.True(strings.Contains(bibtex, "  doi = {10.1002/(sici)1097-4636(199606)31:2<213::aid-jbm8>3.0.co;2-#},\n"))
+	is.True(strings.Contains(bibtex, "  url = {http://dx.doi.org/10.1002/(SICI)1097-4636(199606)31:2<213::AID-JBM8>3.0.CO;2-#},\n"))
+	is.True(strings.Contains(bibtex, "  title = {Under\\_score},\n")) // Other fields are still escaped
+}
+
+func TestRIS(t *testing.T) {
+	is := is.New(t)
+
+	is.Equal(encode(t, FormatRIS, einstein()), `TY  - JOUR
+AU  - Einstein, A.
+AU  - The Relativity Group
+TI  - Zur Elektrodynamik bewegter Körper
+T2  - Annalen der Physik
+J2  - Ann. Phys.
+PY  - 1905
+DA  - 1905/06/
+VL  - 322
+IS  - 10
+SP  - 891
+EP  - 921
+PB  - Wiley
+SN  - 0003-3804
+DO  - 10.1002/andp.19053221004
+UR  - http://dx.doi.org/10.1002/andp.19053221004
+AB  - On the electrodynamics of moving bodies.
+ER  - 
+
+`)
+}
+
+func TestUnknownFormat(t *testing.T) {
+	is := is.New(t)
+
+	_, err := NewEncoder("endnote", &bytes.Buffer{})
+	is.True(err != nil)
+}
+
+func TestFilter(t *testing.T) {
+	retracted := einstein()
+	retracted.UpdatedBy = []crossrefindexer.Update{{DOI: "10.1002/notice", Type: "retraction"}}
+
+	tests := []struct {
+		name   string
+		filter Filter
+		pub    *crossrefindexer.Crossref
+		want   bool
+	}{
+		{name: "no filter", filter: Filter{}, pub: einstein(), want: true},
+		{name: "type", filter: Filter{Types: []string{"book", "journal-article"}}, pub: einstein(), want: true},
+		{name: "other type", filter: Filter{Types: []string{"book"}}, pub: einstein(), want: false},
+		{name: "prefix", filter: Filter{Prefixes: []string{"10.1002"}}, pub: einstein(), want: true},
+		{name: "other prefix", filter: Filter{Prefixes: []string{"10.100"}}, pub: einstein(), want: false},
+		{name: "ISSN", filter: Filter{ISSNs: []string{"0003-3804"}}, pub: einstein(), want: true},
+		{name: "other ISSN", filter: Filter{ISSNs: []string{"1234-5678"}}, pub: einstein(), want: false},
+		{name: "year range", filter: Filter{FromYear: 1900, ToYear: 1905}, pub: einstein(), want: true},
+		{name: "too old", filter: Filter{FromYear: 1906}, pub: einstein(), want: false},
+		{name: "too new", filter: Filter{ToYear: 1904}, pub: einstein(), want: false},
+		{name: "retracted", filter: Filter{SkipRetracted: true}, pub: retracted, want: false},
+		{name: "retracted kept", filter: Filter{}, pub: retracted, want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			is := is.New(t)
+			is.Equal(tt.filter.Match(Simplify(tt.pub)), tt.want)
+		})
+	}
+}
@@ -0,0 +1,384 @@
+package export
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/karatekaneen/crossrefindexer"
+	"github.com/xitongsys/parquet-go/parquet"
+	"github.com/xitongsys/parquet-go/schema"
+	"github.com/xitongsys/parquet-go/writer"
+)
+
+// Names of the document profiles in Parquet
+const (
+	ProfileMinimal  = "minimal"
+	ProfileExtended = "extended"
+)
+
+// ParquetSchemaFile is written next to the Parquet files and describes their columns
+const ParquetSchemaFile = "schema.txt"
+
+// parquetCodecs are the supported compressions of the columns
+var parquetCodecs = map[string]parquet.CompressionCodec{
+	"none":   parquet.CompressionCodec_UNCOMPRESSED,
+	"snappy": parquet.CompressionCodec_SNAPPY,
+	"gzip":   parquet.CompressionCodec_GZIP,
+	"zstd":   parquet.CompressionCodec_ZSTD,
+}
+
+// ParquetConfig describes where and how the Parquet files are written
+type ParquetConfig struct {
+	Dir          string // Created if it does not exist
+	Profile      string // ProfileMinimal or ProfileExtended
+	Compression  string // none, snappy, gzip or zstd
+	RowGroupSize int    // Number of rows in each row group
+	MaxFileBytes int64  // A new file is started when a file has grown past this, after a complete row group
+}
+
+// parquetRow has the columns of the minimal profile, the same fields as the indexed document
+type parquetRow struct {
+	DOI                    string          `parquet:"name=doi, type=BYTE_ARRAY, convertedtype=UTF8"`
+	OriginalDOI            *string         `parquet:"name=original_doi, type=BYTE_ARRAY, convertedtype=UTF8, repetitiontype=OPTIONAL"`
+	Title                  []string        `parquet:"name=title, type=LIST, valuetype=BYTE_ARRAY, valueconvertedtype=UTF8"`
+	FirstAuthor            string          `parquet:"name=first_author, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Authors                []parquetAuthor `parquet:"name=authors, type=LIST"`
+	FirstPage              string          `parquet:"name=first_page, type=BYTE_ARRAY, convertedtype=UTF8"`
+	LastPage               *string         `parquet:"name=last_page, type=BYTE_ARRAY, convertedtype=UTF8, repetitiontype=OPTIONAL"`
+	PageCount              int32           `parquet:"name=page_count, type=INT32"`
+	IsArticleNumber        bool            `parquet:"name=is_article_number, type=BOOLEAN"`
+	Journal                []string        `parquet:"name=journal, type=LIST, valuetype=BYTE_ARRAY, valueconvertedtype=UTF8"`
+	AbbreviatedJournal     []string        `parquet:"name=abbreviated_journal, type=LIST, valuetype=BYTE_ARRAY, valueconvertedtype=UTF8"`
+	Volume                 string          `parquet:"name=volume, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Issue                  string          `parquet:"name=issue, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Year                   int32           `parquet:"name=year, type=INT32"`
+	PublishedDate          *string         `parquet:"name=published_date, type=BYTE_ARRAY, convertedtype=UTF8, repetitiontype=OPTIONAL"`
+	PublishedDatePrecision *string         `parquet:"name=published_date_precision, type=BYTE_ARRAY, convertedtype=UTF8, repetitiontype=OPTIONAL"`
+	Bibliographic          string          `parquet:"name=bibliographic, type=BYTE_ARRAY, convertedtype=UTF8"`
+	IsRetracted            bool            `parquet:"name=is_retracted, type=BOOLEAN"`
+	IndexedAt              int64           `parquet:"name=indexed_at, type=INT64, convertedtype=TIMESTAMP_MILLIS"`
+}
+
+type parquetAuthor struct {
+	Given    *string `parquet:"name=given, type=BYTE_ARRAY, convertedtype=UTF8, repetitiontype=OPTIONAL"`
+	Family   *string `parquet:"name=family, type=BYTE_ARRAY, convertedtype=UTF8, repetitiontype=OPTIONAL"`
+	Suffix   *string `parquet:"name=suffix, type=BYTE_ARRAY, convertedtype=UTF8, repetitiontype=OPTIONAL"`
+	Name     *string `parquet:"name=name, type=BYTE_ARRAY, convertedtype=UTF8, repetitiontype=OPTIONAL"`
+	Sequence *string `parquet:"name=sequence, type=BYTE_ARRAY, convertedtype=UTF8, repetitiontype=OPTIONAL"`
+	ORCID    *string `parquet:"name=orcid, type=BYTE_ARRAY, convertedtype=UTF8, repetitiontype=OPTIONAL"`
+}
+
+// parquetExtendedRow has the columns of parquetRow followed by those of the extended profile and the abstract.
+// The library does not flatten embedded structs, so the columns are repeated.
+type parquetExtendedRow struct {
+	DOI                    string          `parquet:"name=doi, type=BYTE_ARRAY, convertedtype=UTF8"`
+	OriginalDOI            *string         `parquet:"name=original_doi, type=BYTE_ARRAY, convertedtype=UTF8, repetitiontype=OPTIONAL"`
+	Title                  []string        `parquet:"name=title, type=LIST, valuetype=BYTE_ARRAY, valueconvertedtype=UTF8"`
+	FirstAuthor            string          `parquet:"name=first_author, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Authors                []parquetAuthor `parquet:"name=authors, type=LIST"`
+	FirstPage              string          `parquet:"name=first_page, type=BYTE_ARRAY, convertedtype=UTF8"`
+	LastPage               *string         `parquet:"name=last_page, type=BYTE_ARRAY, convertedtype=UTF8, repetitiontype=OPTIONAL"`
+	PageCount              int32           `parquet:"name=page_count, type=INT32"`
+	IsArticleNumber        bool            `parquet:"name=is_article_number, type=BOOLEAN"`
+	Journal                []string        `parquet:"name=journal, type=LIST, valuetype=BYTE_ARRAY, valueconvertedtype=UTF8"`
+	AbbreviatedJournal     []string        `parquet:"name=abbreviated_journal, type=LIST, valuetype=BYTE_ARRAY, valueconvertedtype=UTF8"`
+	Volume                 string          `parquet:"name=volume, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Issue                  string          `parquet:"name=issue, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Year                   int32           `parquet:"name=year, type=INT32"`
+	PublishedDate          *string         `parquet:"name=published_date, type=BYTE_ARRAY, convertedtype=UTF8, repetitiontype=OPTIONAL"`
+	PublishedDatePrecision *string         `parquet:"name=published_date_precision, type=BYTE_ARRAY, convertedtype=UTF8, repetitiontype=OPTIONAL"`
+	Bibliographic          string          `parquet:"name=bibliographic, type=BYTE_ARRAY, convertedtype=UTF8"`
+	IsRetracted            bool            `parquet:"name=is_retracted, type=BOOLEAN"`
+	IndexedAt              int64           `parquet:"name=indexed_at, type=INT64, convertedtype=TIMESTAMP_MILLIS"`
+
+	ISSN      []string `parquet:"name=issn, type=LIST, valuetype=BYTE_ARRAY, valueconvertedtype=UTF8"`
+	Publisher *string  `parquet:"name=publisher, type=BYTE_ARRAY, convertedtype=UTF8, repetitiontype=OPTIONAL"`
+	Member    *string  `parquet:"name=member, type=BYTE_ARRAY, convertedtype=UTF8, repetitiontype=OPTIONAL"`
+	Type      *string  `parquet:"name=type, type=BYTE_ARRAY, convertedtype=UTF8, repetitiontype=OPTIONAL"`
+	Subject   []string `parquet:"name=subject, type=LIST, valuetype=BYTE_ARRAY, valueconvertedtype=UTF8"`
+	URL       *string  `parquet:"name=url, type=BYTE_ARRAY, convertedtype=UTF8, repetitiontype=OPTIONAL"`
+	License   []string `parquet:"name=license, type=LIST, valuetype=BYTE_ARRAY, valueconvertedtype=UTF8"` // URLs of the licenses
+	Abstract  *string  `parquet:"name=abstract, type=BYTE_ARRAY, convertedtype=UTF8, repetitiontype=OPTIONAL"`
+}
+
+// optional is nil for empty strings so that they are stored as null
+func optional(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
+
+func toParquetRow(pub crossrefindexer.SimplifiedPublication) any {
+	row := parquetRow{
+		DOI:                pub.DOI,
+		OriginalDOI:        optional(pub.OriginalDOI),
+		Title:              pub.Title,
+		FirstAuthor:        pub.FirstAuthor,
+		Authors:            toParquetAuthors(pub.Authors),
+		FirstPage:          pub.FirstPage,
+		LastPage:           optional(pub.LastPage),
+		PageCount:          int32(pub.PageCount),
+		IsArticleNumber:    pub.IsArticleNumber,
+		Journal:            pub.Journal,
+		AbbreviatedJournal: pub.AbbreviatedJournal,
+		Volume:             pub.Volume,
+		Issue:              pub.Issue,
+		Year:               int32(pub.Year),
+		Bibliographic:      pub.Bibliographic,
+		IsRetracted:        pub.IsRetracted,
+		IndexedAt:          pub.IndexedAt,
+	}
+	if pub.PublishedDate != nil {
+		row.PublishedDate = optional(pub.PublishedDate.Date)
+		row.PublishedDatePrecision = optional(pub.PublishedDate.Precision)
+	}
+	return row
+}
+
+func toParquetExtendedRow(pub crossrefindexer.SimplifiedPublication) any {
+	minimal := toParquetRow(pub).(parquetRow)
+	ext := extended(pub)
+
+	row := parquetExtendedRow{
+		DOI:                    minimal.DOI,
+		OriginalDOI:            minimal.OriginalDOI,
+		Title:                  minimal.Title,
+		FirstAuthor:            minimal.FirstAuthor,
+		Authors:                minimal.Authors,
+		FirstPage:              minimal.FirstPage,
+		LastPage:               minimal.LastPage,
+		PageCount:              minimal.PageCount,
+		IsArticleNumber:        minimal.IsArticleNumber,
+		Journal:                minimal.Journal,
+		AbbreviatedJournal:     minimal.AbbreviatedJournal,
+		Volume:                 minimal.Volume,
+		Issue:                  minimal.Issue,
+		Year:                   minimal.Year,
+		PublishedDate:          minimal.PublishedDate,
+		PublishedDatePrecision: minimal.PublishedDatePrecision,
+		Bibliographic:          minimal.Bibliographic,
+		IsRetracted:            minimal.IsRetracted,
+		IndexedAt:              minimal.IndexedAt,
+
+		ISSN:      ext.ISSN,
+		Publisher: optional(ext.Publisher),
+		Member:    optional(ext.Member),
+		Type:      optional(ext.Type),
+		Subject:   ext.Subject,
+		URL:       optional(ext.URL),
+		Abstract:  optional(pub.Abstract),
+	}
+	for _, license := range ext.License {
+		row.License = append(row.License, license.URL)
+	}
+	return row
+}
+
+func toParquetAuthors(authors []crossrefindexer.PublicationAuthor) []parquetAuthor {
+	converted := make([]parquetAuthor, 0, len(authors))
+	for _, author := range authors {
+		converted = append(converted, parquetAuthor{
+			Given:    optional(author.Given),
+			Family:   optional(author.Family),
+			Suffix:   optional(author.Suffix),
+			Name:     optional(author.Name),
+			Sequence: optional(author.Sequence),
+			ORCID:    optional(author.ORCID),
+		})
+	}
+	return converted
+}
+
+// parquetEncoder buffers rows to write them a row group at a time and rolls over to a new file by size
+type parquetEncoder struct {
+	cfg     ParquetConfig
+	codec   parquet.CompressionCodec
+	model   any // A row used to get the schema
+	convert func(crossrefindexer.SimplifiedPublication) any
+	rows    int // Rows not yet written as a row group
+
+	files  int // Number of files started
+	file   *os.File
+	out    *countingWriter
+	writer *writer.ParquetWriter
+}
+
+// NewParquetEncoder writes Parquet files named part-00000.parquet, part-00001.parquet and so on to cfg.Dir,
+// together with ParquetSchemaFile.
+func NewParquetEncoder(cfg ParquetConfig) (Encoder, error) {
+	codec, ok := parquetCodecs[cfg.Compression]
+	if !ok {
+		return nil, fmt.Errorf("unknown parquet compression %q", cfg.Compression)
+	}
+	if cfg.RowGroupSize <= 0 {
+		return nil, fmt.Errorf("row group size must be positive, got %d", cfg.RowGroupSize)
+	}
+
+	encoder := &parquetEncoder{cfg: cfg, codec: codec}
+	switch cfg.Profile {
+	case ProfileMinimal:
+		encoder.model, encoder.convert = new(parquetRow), toParquetRow
+	case ProfileExtended:
+		encoder.model, encoder.convert = new(parquetExtendedRow), toParquetExtendedRow
+	default:
+		return nil, fmt.Errorf("unknown profile %q", cfg.Profile)
+	}
+
+	if err := os.MkdirAll(cfg.Dir, 0o755); err != nil {
+		return nil, fmt.Errorf("could not create output directory: %w", err)
+	}
+
+	// The schema only depends on the profile, so it is the same for every file and every run
+	handler, err := schema.NewSchemaHandlerFromStruct(encoder.model)
+	if err != nil {
+		return nil, fmt.Errorf("invalid parquet schema: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(cfg.Dir, ParquetSchemaFile), []byte(describeSchema(handler)), 0o644); err != nil {
+		return nil, fmt.Errorf("could not write schema: %w", err)
+	}
+
+	return encoder, nil
+}
+
+func (e *parquetEncoder) Encode(pub crossrefindexer.SimplifiedPublication) error {
+	if e.writer == nil {
+		if err := e.openFile(); err != nil {
+			return err
+		}
+	}
+
+	if err := e.writer.Write(e.convert(pub)); err != nil {
+		return fmt.Errorf("could not write %s to %s: %w", pub.DOI, e.file.Name(), err)
+	}
+	e.rows++
+	if e.rows < e.cfg.RowGroupSize {
+		return nil
+	}
+	return e.writeRowGroup()
+}
+
+func (e *parquetEncoder) Close() error {
+	return e.closeFile()
+}
+
+func (e *parquetEncoder) writeRowGroup() error {
+	if err := e.writer.Flush(true); err != nil {
+		return fmt.Errorf("could not write row group to %s: %w", e.file.Name(), err)
+	}
+	e.rows = 0
+
+	if e.cfg.MaxFileBytes > 0 && e.out.n >= e.cfg.MaxFileBytes {
+		return e.closeFile()
+	}
+	return nil
+}
+
+func (e *parquetEncoder) openFile() error {
+	path := filepath.Join(e.cfg.Dir, fmt.Sprintf("part-%05d.parquet", e.files))
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("could not create parquet file: %w", err)
+	}
+
+	out := &countingWriter{w: file}
+	pw, err := writer.NewParquetWriterFromWriter(out, e.model, 4)
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("could not create parquet writer: %w", err)
+	}
+	pw.CompressionType = e.codec
+	// Row groups are only written when RowGroupSize rows have been added
+	pw.RowGroupSize = math.MaxInt64
+
+	e.files++
+	e.file, e.out, e.writer = file, out, pw
+	return nil
+}
+
+func (e *parquetEncoder) closeFile() error {
+	if e.writer == nil {
+		return nil
+	}
+
+	err := e.writer.WriteStop()
+	if closeErr := e.file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("could not close %s: %w", e.file.Name(), err)
+	}
+
+	e.writer, e.file, e.out, e.rows = nil, nil, nil, 0
+	return nil
+}
+
+// describeSchema writes the schema in the message format used by the Parquet tools, like
+//
+//	required binary doi (UTF8);
+func describeSchema(handler *schema.SchemaHandler) string {
+	elements := handler.SchemaElements
+
+	var b strings.Builder
+	var describe func(i, depth int) int
+	describe = func(i, depth int) int {
+		element := elements[i]
+		name := handler.GetExName(i)
+		indent := strings.Repeat("  ", depth)
+
+		var converted string
+		if element.ConvertedType != nil {
+			converted = " (" + element.ConvertedType.String() + ")"
+		}
+
+		if element.NumChildren == nil || *element.NumChildren == 0 {
+			fmt.Fprintf(&b, "%s%s %s %s%s;\n", indent, repetition(element), physicalType(element), name, converted)
+			return i + 1
+		}
+
+		if depth == 0 {
+			fmt.Fprintf(&b, "message publication {\n")
+		} else {
+			fmt.Fprintf(&b, "%s%s group %s%s {\n", indent, repetition(element), name, converted)
+		}
+		next := i + 1
+		for child := 0; child < int(*element.NumChildren); child++ {
+			next = describe(next, depth+1)
+		}
+		fmt.Fprintf(&b, "%s}\n", indent)
+		return next
+	}
+
+	describe(0, 0)
+	return b.String()
+}
+
+func physicalType(element *parquet.SchemaElement) string {
+	if *element.Type == parquet.Type_BYTE_ARRAY {
+		return "binary"
+	}
+	return strings.ToLower(element.Type.String())
+}
+
+func repetition(element *parquet.SchemaElement) string {
+	if element.RepetitionType == nil {
+		return "required"
+	}
+	return strings.ToLower(element.RepetitionType.String())
+}
+
+// countingWriter keeps track of how much has been written to a file
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
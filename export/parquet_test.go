@@ -0,0 +1,106 @@
+package export
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/matryer/is"
+	"github.com/xitongsys/parquet-go-source/local"
+	"github.com/xitongsys/parquet-go/reader"
+)
+
+func TestParquet(t *testing.T) {
+	tests := []struct {
+		name         string
+		profile      string
+		maxFileBytes int64
+		wantFiles    int
+	}{
+		{name: "minimal in one file", profile: ProfileMinimal, wantFiles: 1},
+		{name: "extended in one file", profile: ProfileExtended, wantFiles: 1},
+		{name: "rolled by size", profile: ProfileMinimal, maxFileBytes: 1, wantFiles: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			is := is.New(t)
+
+			dir := t.TempDir()
+			encoder, err := NewParquetEncoder(ParquetConfig{
+				Dir:          dir,
+				Profile:      tt.profile,
+				Compression:  "zstd",
+				RowGroupSize: 2,
+				MaxFileBytes: tt.maxFileBytes,
+			})
+			is.NoErr(err)
+
+			for _, doi := range []string{"10.1000/a", "10.1000/b", "10.1000/c", "10.1000/d", "10.1000/e"} {
+				pub := einstein()
+				pub.Doi = doi
+				is.NoErr(encoder.Encode(Simplify(pub)))
+			}
+			is.NoErr(encoder.Close())
+
+			files, err := filepath.Glob(filepath.Join(dir, "part-*.parquet"))
+			is.NoErr(err)
+			is.Equal(len(files), tt.wantFiles)
+
+			// All rows can be read back in order
+			var dois []string
+			for _, path := range files {
+				switch tt.profile {
+				case ProfileMinimal:
+					rows := readParquet[parquetRow](t, path)
+					for _, row := range rows {
+						is.Equal(row.Title, []string{"Zur Elektrodynamik bewegter Körper"})
+						is.Equal(*row.PublishedDate, "1905-06")
+						dois = append(dois, row.DOI)
+					}
+				case ProfileExtended:
+					rows := readParquet[parquetExtendedRow](t, path)
+					for _, row := range rows {
+						is.Equal(*row.Publisher, "Wiley")
+						is.Equal(*row.Authors[1].Name, "The Relativity Group")
+						dois = append(dois, row.DOI)
+					}
+				}
+			}
+			is.Equal(dois, []string{"10.1000/a", "10.1000/b", "10.1000/c", "10.1000/d", "10.1000/e"})
+
+			schema, err := os.ReadFile(filepath.Join(dir, ParquetSchemaFile))
+			is.NoErr(err)
+			is.True(strings.Contains(string(schema), "first_author"))
+			is.Equal(strings.Contains(string(schema), "publisher"), tt.profile == ProfileExtended)
+		})
+	}
+}
+
+func readParquet[T any](t *testing.T, path string) []T {
+	is := is.New(t)
+
+	file, err := local.NewLocalFileReader(path)
+	is.NoErr(err)
+	defer file.Close()
+
+	pr, err := reader.NewParquetReader(file, new(T), 1)
+	is.NoErr(err)
+	defer pr.ReadStop()
+
+	rows := make([]T, pr.GetNumRows())
+	is.NoErr(pr.Read(&rows))
+	return rows
+}
+
+func TestParquetConfig(t *testing.T) {
+	is := is.New(t)
+
+	_, err := NewParquetEncoder(ParquetConfig{Dir: t.TempDir(), Profile: ProfileMinimal, Compression: "lzma", RowGroupSize: 1})
+	is.True(err != nil) // Unknown compression
+	_, err = NewParquetEncoder(ParquetConfig{Dir: t.TempDir(), Profile: "full", Compression: "zstd", RowGroupSize: 1})
+	is.True(err != nil) // Unknown profile
+	_, err = NewParquetEncoder(ParquetConfig{Dir: t.TempDir(), Profile: ProfileMinimal, Compression: "zstd"})
+	is.True(err != nil) // No row group size
+}
@@ -0,0 +1,104 @@
+package export
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/karatekaneen/crossrefindexer"
+)
+
+// risTypes maps Crossref types to RIS reference types. Anything else is GEN.
+var risTypes = map[string]string{
+	"journal-article":     "JOUR",
+	"proceedings-article": "CPAPER",
+	"book-chapter":        "CHAP",
+	"book-section":        "CHAP",
+	"book-part":           "CHAP",
+	"book":                "BOOK",
+	"edited-book":         "EDBOOK",
+	"monograph":           "BOOK",
+	"reference-book":      "BOOK",
+	"reference-entry":     "ENCYC",
+	"dissertation":        "THES",
+	"report":              "RPRT",
+	"dataset":             "DATA",
+	"standard":            "STAND",
+}
+
+type risEncoder struct {
+	w io.Writer
+}
+
+func (e *risEncoder) Encode(pub crossrefindexer.SimplifiedPublication) error {
+	_, err := io.WriteString(e.w, toRIS(pub))
+	return err
+}
+
+func (e *risEncoder) Close() error { return nil }
+
+func toRIS(pub crossrefindexer.SimplifiedPublication) string {
+	ext := extended(pub)
+
+	risType := risTypes[ext.Type]
+	if risType == "" {
+		risType = "GEN"
+	}
+
+	var b strings.Builder
+	tag := func(name, value string) {
+		// Values are a single line
+		if value = strings.Join(strings.Fields(value), " "); value != "" {
+			fmt.Fprintf(&b, "%s  - %s\n", name, value)
+		}
+	}
+
+	tag("TY", risType)
+	for _, author := range pub.Authors {
+		switch {
+		case author.Family == "" && author.Name != "":
+			tag("AU", author.Name)
+		case author.Family != "":
+			name := []string{author.Family}
+			if author.Given != "" {
+				name = append(name, author.Given)
+			}
+			if author.Suffix != "" {
+				name = append(name, author.Suffix)
+			}
+			tag("AU", strings.Join(name, ", "))
+		}
+	}
+
+	tag("TI", first(pub.Title))
+	tag("T2", first(pub.Journal))
+	tag("J2", first(pub.AbbreviatedJournal))
+
+	if parts := dateParts(pub.PublishedDate); len(parts) > 0 {
+		tag("PY", fmt.Sprintf("%04d", parts[0]))
+		// The date is year/month/day where the parts that are not known are left empty
+		date := []string{fmt.Sprintf("%04d", parts[0]), "", ""}
+		for i := 1; i < len(parts) && i < 3; i++ {
+			date[i] = fmt.Sprintf("%02d", parts[i])
+		}
+		tag("DA", strings.Join(date, "/"))
+	}
+
+	tag("VL", pub.Volume)
+	tag("IS", pub.Issue)
+	// Article numbers are the start page since RIS has no tag of their own
+	tag("SP", pub.FirstPage)
+	if pub.LastPage != pub.FirstPage {
+		tag("EP", pub.LastPage)
+	}
+	tag("PB", ext.Publisher)
+	for _, issn := range ext.ISSN {
+		tag("SN", issn)
+	}
+	tag("DO", pub.DOI)
+	tag("UR", ext.URL)
+	tag("AB", pub.Abstract)
+	b.WriteString("ER  - \n\n")
+
+	return b.String()
+}
@@ -0,0 +1,76 @@
+package crossrefindexer
+
+import (
+	"strings"
+	"time"
+)
+
+// ExtendedMetadata is the part of a publication that is only included in the extended profile.
+// It is embedded in SimplifiedPublication so that its fields end up next to the minimal ones.
+type ExtendedMetadata struct {
+	ISSN      []string             `json:"issn,omitempty"`
+	ISSNType  []PublicationISSN    `json:"issn_type,omitempty"`
+	Publisher string               `json:"publisher,omitempty"`
+	Member    string               `json:"member,omitempty"` // Crossref member id of the publisher
+	Type      string               `json:"type,omitempty"`   // Like journal-article, book-chapter or dataset
+	Subject   []string             `json:"subject,omitempty"`
+	URL       string               `json:"url,omitempty"`
+	License   []PublicationLicense `json:"license,omitempty"`
+	Deposited string               `json:"deposited,omitempty"` // When the metadata was last deposited by the member
+	Indexed   string               `json:"indexed,omitempty"`
+}
+
+// PublicationISSN is an ISSN together with its type, print or electronic
+type PublicationISSN struct {
+	Value string `json:"value"`
+	Type  string `json:"type"`
+}
+
+// PublicationLicense is the simplified form of a License
+type PublicationLicense struct {
+	URL            string `json:"url"`
+	ContentVersion string `json:"content_version,omitempty"` // Which version the license applies to, like vor or am
+	DelayInDays    int    `json:"delay_in_days,omitempty"`
+	Start          string `json:"start,omitempty"`
+}
+
+// WithExtended includes the metadata of the extended profile
+func WithExtended() TransformOption { return func(o *transformOptions) { o.extended = true } }
+
+func toExtendedMetadata(pub *Crossref) *ExtendedMetadata {
+	extended := &ExtendedMetadata{
+		ISSN:      pub.Issn,
+		Publisher: pub.Publisher,
+		Member:    pub.Member,
+		Type:      pub.Type,
+		Subject:   pub.Subject,
+		URL:       pub.URL,
+		Deposited: timeToISO(pub.Deposited.DateTime),
+		Indexed:   timeToISO(pub.Indexed.DateTime),
+	}
+
+	for _, issn := range pub.IssnType {
+		extended.ISSNType = append(extended.ISSNType, PublicationISSN{
+			Value: issn.Value,
+			Type:  strings.ToLower(issn.Type),
+		})
+	}
+
+	for _, license := range pub.License {
+		extended.License = append(extended.License, PublicationLicense{
+			URL:            license.URL,
+			ContentVersion: license.ContentVersion,
+			DelayInDays:    license.DelayInDays,
+			Start:          timeToISO(license.Start.DateTime),
+		})
+	}
+
+	return extended
+}
+
+func timeToISO(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
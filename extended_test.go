@@ -0,0 +1,68 @@
+package crossrefindexer
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+)
+
+func Test_ExtendedProfile(t *testing.T) {
+	is := is.New(t)
+
+	pub := generateCrossref(func(cr *Crossref) {
+		cr.Issn = []string{"1234-5678", "8765-4321"}
+		cr.IssnType = []IssnType{{Value: "1234-5678", Type: "Print"}, {Value: "8765-4321", Type: "electronic"}}
+		cr.Publisher = "Wiley"
+		cr.Member = "311"
+		cr.Type = "journal-article"
+		cr.Subject = []string{"General Physics and Astronomy"}
+		cr.URL = "http://dx.doi.org/10.1000/abc"
+		cr.PublishedOnline = &DateParts{DateParts: [][]int{{2006, 2}}}
+		cr.PublishedPrint = &DateParts{DateParts: [][]int{{2007}}}
+		cr.License = []License{{
+			URL:            "http://onlinelibrary.wiley.com/termsAndConditions#vor",
+			Start:          Indexed{DateTime: time.Date(2006, time.February, 27, 0, 0, 0, 0, time.UTC)},
+			ContentVersion: "vor",
+		}}
+	})
+
+	is.Equal(ToSimplifiedPublication(pub, WithExtended()), generateOutput(func(sp *SimplifiedPublication) {
+		sp.Dates.PublishedPrint = &PartialDate{Date: "2007", Precision: PrecisionYear}
+		sp.Dates.PublishedOnline = &PartialDate{Date: "2006-02", Precision: PrecisionMonth}
+		sp.ExtendedMetadata = &ExtendedMetadata{
+			ISSN:      []string{"1234-5678", "8765-4321"},
+			ISSNType:  []PublicationISSN{{Value: "1234-5678", Type: "print"}, {Value: "8765-4321", Type: "electronic"}},
+			Publisher: "Wiley",
+			Member:    "311",
+			Type:      "journal-article",
+			Subject:   []string{"General Physics and Astronomy"},
+			URL:       "http://dx.doi.org/10.1000/abc",
+			License: []PublicationLicense{{
+				URL:            "http://onlinelibrary.wiley.com/termsAndConditions#vor",
+				ContentVersion: "vor",
+				Start:          "2006-02-27T00:00:00Z",
+			}},
+			Indexed: "2022-04-01T12:00:00Z",
+		}
+	}))
+
+	// The fields are next to the minimal ones in the document
+	data, err := json.Marshal(ToSimplifiedPublication(pub, WithExtended()))
+	is.NoErr(err)
+	var doc map[string]any
+	is.NoErr(json.Unmarshal(data, &doc))
+	is.Equal(doc["publisher"], "Wiley")
+	is.Equal(doc["first_author"], "f1")
+
+	// The minimal profile is unchanged
+	data, err = json.Marshal(ToSimplifiedPublication(pub))
+	is.NoErr(err)
+	doc = map[string]any{}
+	is.NoErr(json.Unmarshal(data, &doc))
+	for _, field := range []string{"issn", "publisher", "type", "url", "license", "indexed"} {
+		_, ok := doc[field]
+		is.True(!ok) // Extended field in minimal profile
+	}
+}
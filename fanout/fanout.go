@@ -0,0 +1,165 @@
+// Package fanout passes every publication read to several sinks, so that the expensive decompression
+// and parsing of the input is only done once no matter how many places the publications are written to.
+package fanout
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/karatekaneen/crossrefindexer"
+	"go.uber.org/zap"
+)
+
+// Policy is what happens to the pass when a sink fails
+type Policy string
+
+const (
+	PolicyFail     Policy = "fail"     // Stop the whole pass
+	PolicyContinue Policy = "continue" // Stop sending to the failed sink but keep writing to the others
+)
+
+// Sink is somewhere to write the publications to
+type Sink struct {
+	Name   string
+	Buffer int // Publications queued for the sink. When it is full the sink holds back all the others
+	Policy Policy
+
+	// Write consumes the publications until the channel is closed. The publications are shared
+	// by all the sinks and must not be modified.
+	Write func(ctx context.Context, pubs chan *crossrefindexer.Crossref) error
+}
+
+// running is a sink that has been started
+type running struct {
+	Sink
+	pubs    chan *crossrefindexer.Crossref
+	done    chan struct{} // Closed when Write has returned
+	err     error         // What Write returned. Only read after done is closed
+	stopped bool          // Set when nothing more should be sent to the sink
+	sent    int
+}
+
+// Fanout sends the publications to the sinks. It is not safe for concurrent use.
+type Fanout struct {
+	sinks []*running
+	log   *zap.SugaredLogger
+}
+
+// Start starts writing to all the sinks. Close must be called when all publications are sent.
+func Start(ctx context.Context, log *zap.SugaredLogger, sinks ...Sink) *Fanout {
+	f := &Fanout{log: log}
+	for _, sink := range sinks {
+		r := &running{
+			Sink: sink,
+			pubs: make(chan *crossrefindexer.Crossref, sink.Buffer),
+			done: make(chan struct{}),
+		}
+		go func() {
+			defer close(r.done)
+			r.err = r.Write(ctx, r.pubs)
+		}()
+		f.sinks = append(f.sinks, r)
+	}
+	return f
+}
+
+// Send passes the publication to every sink that is still running. It blocks while the buffer of any of them
+// is full, so the slowest sink sets the pace. It fails if a sink with the fail policy has stopped.
+func (f *Fanout) Send(ctx context.Context, pub *crossrefindexer.Crossref) error {
+	for _, r := range f.sinks {
+		if r.stopped {
+			continue
+		}
+
+		select {
+		case <-r.done:
+			if err := f.stop(r); err != nil {
+				return err
+			}
+			continue
+		default:
+		}
+
+		select {
+		case r.pubs <- pub:
+			r.sent++
+		case <-r.done:
+			if err := f.stop(r); err != nil {
+				return err
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// stop stops sending to a sink that has returned before all publications were sent.
+// The error is only returned if the sink should stop the whole pass.
+func (f *Fanout) stop(r *running) error {
+	r.stopped = true
+
+	err := r.err
+	if err == nil {
+		err = errors.New("stopped before all publications were sent")
+	}
+	if r.Policy == PolicyFail {
+		return fmt.Errorf("sink %s failed: %w", r.Name, err)
+	}
+
+	f.log.Errorw("Sink failed, continuing with the other sinks", "sink", r.Name, "sent", r.sent, "err", err)
+	return nil
+}
+
+// Close tells the sinks that there are no more publications and waits for them to finish.
+// It returns the errors of the sinks with the fail policy. The others are only logged.
+func (f *Fanout) Close() error {
+	for _, r := range f.sinks {
+		close(r.pubs)
+	}
+
+	var errs []error
+	for _, r := range f.sinks {
+		<-r.done
+
+		switch {
+		case r.stopped && r.Policy == PolicyContinue:
+			// Already logged when it stopped
+		case r.err != nil && r.Policy == PolicyFail:
+			errs = append(errs, fmt.Errorf("sink %s failed: %w", r.Name, r.err))
+		case r.err != nil:
+			f.log.Errorw("Sink failed", "sink", r.Name, "sent", r.sent, "err", r.err)
+		default:
+			f.log.Debugw("Sink done", "sink", r.Name, "sent", r.sent)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Map makes a sink that writes something else than the publications. convert returns what to write
+// for each publication, which can be nothing or several things. If write returns before the channel
+// is closed the rest of the publications are not converted.
+func Map[T any](
+	convert func(*crossrefindexer.Crossref) []T,
+	write func(ctx context.Context, data chan T) error,
+) func(ctx context.Context, pubs chan *crossrefindexer.Crossref) error {
+	return func(ctx context.Context, pubs chan *crossrefindexer.Crossref) error {
+		data := make(chan T)
+		done := make(chan error, 1)
+		go func() { done <- write(ctx, data) }()
+
+		for pub := range pubs {
+			for _, value := range convert(pub) {
+				select {
+				case data <- value:
+				case err := <-done:
+					return err
+				}
+			}
+		}
+
+		close(data)
+		return <-done
+	}
+}
@@ -0,0 +1,150 @@
+package fanout
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/karatekaneen/crossrefindexer"
+	"github.com/matryer/is"
+	"go.uber.org/zap"
+)
+
+// collect is a sink that keeps the DOIs it gets
+type collect struct {
+	mu   sync.Mutex
+	dois []string
+}
+
+func (c *collect) write(ctx context.Context, pubs chan *crossrefindexer.Crossref) error {
+	for pub := range pubs {
+		c.mu.Lock()
+		c.dois = append(c.dois, pub.Doi)
+		c.mu.Unlock()
+	}
+	return nil
+}
+
+// failAfter is a sink that fails after getting n publications
+func failAfter(n int) func(ctx context.Context, pubs chan *crossrefindexer.Crossref) error {
+	return func(ctx context.Context, pubs chan *crossrefindexer.Crossref) error {
+		for range pubs {
+			n--
+			if n == 0 {
+				return errors.New("disk full")
+			}
+		}
+		return nil
+	}
+}
+
+func send(f *Fanout, n int) error {
+	for i := 0; i < n; i++ {
+		if err := f.Send(context.Background(), &crossrefindexer.Crossref{Doi: string(rune('a' + i))}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestFanout(t *testing.T) {
+	tests := []struct {
+		name        string
+		failing     Policy
+		wantSendErr bool
+		wantErr     bool
+	}{
+		{name: "failing sink is left out with the continue policy", failing: PolicyContinue},
+		{name: "failing sink stops the pass with the fail policy", failing: PolicyFail, wantSendErr: true, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			is := is.New(t)
+
+			first, second := &collect{}, &collect{}
+			f := Start(context.Background(), zap.NewNop().Sugar(),
+				Sink{Name: "first", Buffer: 2, Policy: PolicyFail, Write: first.write},
+				Sink{Name: "failing", Policy: tt.failing, Write: failAfter(2)},
+				Sink{Name: "second", Buffer: 0, Policy: PolicyFail, Write: second.write},
+			)
+
+			err := send(f, 10)
+			is.Equal(err != nil, tt.wantSendErr)
+			err = f.Close()
+			is.Equal(err != nil, tt.wantErr)
+
+			if !tt.wantSendErr {
+				is.Equal(len(first.dois), 10)
+				is.Equal(first.dois, second.dois) // The other sinks get everything in order
+			}
+		})
+	}
+}
+
+func TestBackPressure(t *testing.T) {
+	is := is.New(t)
+
+	gate := make(chan struct{})
+	slow := func(ctx context.Context, pubs chan *crossrefindexer.Crossref) error {
+		<-gate
+		for range pubs {
+		}
+		return nil
+	}
+	fast := &collect{}
+
+	f := Start(context.Background(), zap.NewNop().Sugar(),
+		Sink{Name: "slow", Buffer: 1, Policy: PolicyFail, Write: slow},
+		Sink{Name: "fast", Buffer: 10, Policy: PolicyFail, Write: fast.write},
+	)
+
+	sent := make(chan error)
+	go func() { sent <- send(f, 3) }()
+
+	select {
+	case <-sent:
+		t.Fatal("sending should wait for the slow sink")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	close(gate)
+	is.NoErr(<-sent)
+	is.NoErr(f.Close())
+	is.Equal(len(fast.dois), 3)
+}
+
+func TestMap(t *testing.T) {
+	is := is.New(t)
+
+	var got []string
+	write := Map(
+		func(pub *crossrefindexer.Crossref) []string {
+			if pub.Doi == "b" {
+				return nil
+			}
+			return []string{pub.Doi, pub.Doi}
+		},
+		func(ctx context.Context, data chan string) error {
+			for value := range data {
+				got = append(got, value)
+			}
+			return nil
+		},
+	)
+
+	f := Start(context.Background(), zap.NewNop().Sugar(), Sink{Name: "mapped", Policy: PolicyFail, Write: write})
+	is.NoErr(send(f, 3))
+	is.NoErr(f.Close())
+	is.Equal(got, []string{"a", "a", "c", "c"})
+
+	// A write that fails stops the conversion
+	failing := Map(
+		func(pub *crossrefindexer.Crossref) []string { return []string{pub.Doi} },
+		func(ctx context.Context, data chan string) error { return errors.New("failed") },
+	)
+	f = Start(context.Background(), zap.NewNop().Sugar(), Sink{Name: "failing", Policy: PolicyFail, Write: failing})
+	is.True(send(f, 3) != nil || f.Close() != nil)
+}
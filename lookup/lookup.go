@@ -0,0 +1,249 @@
+// Package lookup matches references against the index the same way Biblio-Glutton does.
+package lookup
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/karatekaneen/crossrefindexer"
+	"github.com/karatekaneen/crossrefindexer/elastic"
+	"github.com/karatekaneen/crossrefindexer/textnorm"
+)
+
+// ErrEmptyQuery is returned when none of the fields in the query are set
+var ErrEmptyQuery = errors.New("query must contain a DOI, a citation string or structured fields")
+
+// Query holds what is known about the reference to look up.
+// Either the raw citation (Biblio) or the structured fields should be set.
+type Query struct {
+	DOI         string `json:"doi,omitempty"`
+	Biblio      string `json:"biblio,omitempty"`
+	Title       string `json:"atitle,omitempty"`
+	FirstAuthor string `json:"firstAuthor,omitempty"`
+	ORCID       string `json:"orcid,omitempty"` // ORCID iD of any of the authors
+	Journal     string `json:"jtitle,omitempty"`
+	Volume      string `json:"volume,omitempty"`
+	FirstPage   string `json:"firstPage,omitempty"`
+	Year        int    `json:"year,omitempty"`
+}
+
+// Candidate is a publication found in the index
+type Candidate struct {
+	Score       float64                               `json:"score"`
+	Valid       bool                                  `json:"valid"` // If the candidate passed post-validation
+	Publication crossrefindexer.SimplifiedPublication `json:"publication"`
+}
+
+// Searcher runs queries against the index. Satisfied by *elastic.Indexer
+type Searcher interface {
+	Search(ctx context.Context, indexName string, query map[string]any, size int) ([]elastic.Hit, error)
+}
+
+type Lookup struct {
+	searcher  Searcher
+	indexName string
+}
+
+func New(searcher Searcher, indexName string) *Lookup {
+	return &Lookup{searcher: searcher, indexName: indexName}
+}
+
+// Find returns at most `size` candidates matching the query, best match first.
+func (l *Lookup) Find(ctx context.Context, q Query, size int) ([]Candidate, error) {
+	query, err := q.ElasticQuery()
+	if err != nil {
+		return nil, err
+	}
+
+	hits, err := l.searcher.Search(ctx, l.indexName, query, size)
+	if err != nil {
+		return nil, fmt.Errorf("lookup failed: %w", err)
+	}
+
+	candidates := make([]Candidate, 0, len(hits))
+	for _, hit := range hits {
+		var pub crossrefindexer.SimplifiedPublication
+		if err := json.Unmarshal(hit.Source, &pub); err != nil {
+			return nil, fmt.Errorf("could not decode document %s: %w", hit.ID, err)
+		}
+
+		candidates = append(candidates, Candidate{
+			Score:       hit.Score,
+			Valid:       PostValidate(q, pub),
+			Publication: pub,
+		})
+	}
+
+	return candidates, nil
+}
+
+// HasStructuredFields tells if any field other than the DOI and the citation string is set
+func (q Query) HasStructuredFields() bool {
+	return q.Title != "" || q.FirstAuthor != "" || q.ORCID != "" || q.Journal != "" || q.Volume != "" || q.FirstPage != ""
+}
+
+// ElasticQuery builds the search query. A DOI is an exact lookup and takes precedence.
+// Otherwise the structured fields must match, with the citation string and year used for scoring.
+func (q Query) ElasticQuery() (map[string]any, error) {
+	if q.DOI != "" {
+		// Look up what could be normalized also for invalid DOIs, it might still be indexed
+		doi, _ := crossrefindexer.NormalizeDOI(q.DOI)
+		return match("DOI", doi), nil
+	}
+
+	if !q.HasStructuredFields() {
+		if q.Biblio == "" {
+			return nil, ErrEmptyQuery
+		}
+		return match("bibliographic", q.Biblio), nil
+	}
+
+	must := []map[string]any{}
+	if q.Title != "" {
+		must = append(must, match("title", q.Title))
+	}
+	if q.FirstAuthor != "" {
+		must = append(must, match("first_author", q.FirstAuthor))
+	}
+	if q.ORCID != "" {
+		// Authors are nested so the ORCID must be queried within them
+		must = append(must, map[string]any{
+			"nested": map[string]any{
+				"path":  "authors",
+				"query": map[string]any{"term": map[string]any{"authors.orcid": crossrefindexer.NormalizeORCID(q.ORCID)}},
+			},
+		})
+	}
+	if q.Journal != "" {
+		must = append(must, map[string]any{
+			"multi_match": map[string]any{
+				"query":  q.Journal,
+				"fields": []string{"journal", "abbreviated_journal"},
+			},
+		})
+	}
+	if q.Volume != "" {
+		must = append(must, match("volume", q.Volume))
+	}
+	if q.FirstPage != "" {
+		must = append(must, match("first_page", q.FirstPage))
+	}
+
+	should := []map[string]any{}
+	if q.Biblio != "" {
+		should = append(should, match("bibliographic", q.Biblio))
+	}
+	if q.Year != 0 {
+		should = append(should, match("year", strconv.Itoa(q.Year)))
+	}
+
+	boolQuery := map[string]any{"must": must}
+	if len(should) > 0 {
+		boolQuery["should"] = should
+	}
+
+	return map[string]any{"bool": boolQuery}, nil
+}
+
+func match(field, value string) map[string]any {
+	return map[string]any{"match": map[string]any{field: value}}
+}
+
+// titleSimilarityThreshold is how similar the titles must be to be considered the same
+const titleSimilarityThreshold = 0.8
+
+// PostValidate checks that the candidate is plausible given the query, since
+// full text search will always return something even if it is not a match.
+func PostValidate(q Query, pub crossrefindexer.SimplifiedPublication) bool {
+	if q.DOI != "" {
+		doi, _ := crossrefindexer.NormalizeDOI(q.DOI)
+		return doi == pub.DOI
+	}
+
+	if q.Title != "" {
+		if len(pub.Title) == 0 || similarity(normalize(q.Title), normalize(pub.Title[0])) < titleSimilarityThreshold {
+			return false
+		}
+	}
+	if q.FirstAuthor != "" && normalize(q.FirstAuthor) != normalize(pub.FirstAuthor) {
+		return false
+	}
+	if q.ORCID != "" && !hasAuthorORCID(pub, crossrefindexer.NormalizeORCID(q.ORCID)) {
+		return false
+	}
+	if q.Volume != "" && normalize(q.Volume) != normalize(pub.Volume) {
+		return false
+	}
+	if q.FirstPage != "" && normalize(q.FirstPage) != normalize(pub.FirstPage) {
+		return false
+	}
+	if q.Year != 0 && pub.Year != 0 && q.Year != pub.Year {
+		return false
+	}
+
+	// The raw citation should at least contain the name of the first author
+	if q.Biblio != "" && pub.FirstAuthor != "" {
+		if !strings.Contains(normalize(q.Biblio), normalize(pub.FirstAuthor)) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func hasAuthorORCID(pub crossrefindexer.SimplifiedPublication, orcid string) bool {
+	for _, author := range pub.Authors {
+		if orcid != "" && author.ORCID == orcid {
+			return true
+		}
+	}
+	return false
+}
+
+// normalize cleans, folds diacritics and lowercases to make comparisons less strict.
+// Folding makes queries match indexes built both with and without folded diacritics.
+func normalize(s string) string {
+	return strings.ToLower(textnorm.Fold(textnorm.Clean(s)))
+}
+
+// similarity is the normalized Levenshtein similarity between 0 (nothing in common) and 1 (equal)
+func similarity(a, b string) float64 {
+	ra, rb := []rune(a), []rune(b)
+	if len(ra) == 0 && len(rb) == 0 {
+		return 1
+	}
+
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = prev[j] + 1 // Deletion
+			if curr[j-1]+1 < curr[j] {
+				curr[j] = curr[j-1] + 1 // Insertion
+			}
+			if prev[j-1]+cost < curr[j] {
+				curr[j] = prev[j-1] + cost // Substitution
+			}
+		}
+		prev, curr = curr, prev
+	}
+
+	longest := len(ra)
+	if len(rb) > longest {
+		longest = len(rb)
+	}
+	return 1 - float64(prev[len(rb)])/float64(longest)
+}
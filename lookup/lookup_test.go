@@ -0,0 +1,124 @@
+package lookup
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/karatekaneen/crossrefindexer"
+	"github.com/karatekaneen/crossrefindexer/elastic"
+	"github.com/matryer/is"
+)
+
+type fakeSearcher struct {
+	query map[string]any
+	hits  []elastic.Hit
+}
+
+func (f *fakeSearcher) Search(_ context.Context, _ string, query map[string]any, _ int) ([]elastic.Hit, error) {
+	f.query = query
+	return f.hits, nil
+}
+
+func hit(t *testing.T, score float64, pub crossrefindexer.SimplifiedPublication) elastic.Hit {
+	source, err := json.Marshal(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return elastic.Hit{ID: pub.DOI, Score: score, Source: source}
+}
+
+var einstein = crossrefindexer.SimplifiedPublication{
+	Title:       []string{"Zur Elektrodynamik bewegter Körper"},
+	DOI:         "10.1002/andp.19053221004",
+	FirstAuthor: "Einstein",
+	Authors:     []crossrefindexer.PublicationAuthor{{Given: "A.", Family: "Einstein", ORCID: "0000-0002-1825-0097"}},
+	FirstPage:   "891",
+	Journal:     []string{"Annalen der Physik"},
+	Volume:      "322",
+	Year:        1905,
+}
+
+func Test_Find(t *testing.T) {
+	other := einstein
+	other.DOI = "10.1000/other"
+	other.Title = []string{"Something completely different"}
+	other.FirstAuthor = "Bohr"
+
+	tests := []struct {
+		name      string
+		query     Query
+		wantQuery string
+		wantValid []bool
+		wantErr   bool
+	}{
+		{
+			name:      "citation string",
+			query:     Query{Biblio: "A. Einstein, Ann. Phys. 17, 891 (1905)"},
+			wantQuery: `{"match":{"bibliographic":"A. Einstein, Ann. Phys. 17, 891 (1905)"}}`,
+			wantValid: []bool{true, false},
+		},
+		{
+			name:      "title and first author",
+			query:     Query{Title: "Zur Elektrodynamik bewegter Koerper", FirstAuthor: "einstein"},
+			wantQuery: `{"bool":{"must":[{"match":{"title":"Zur Elektrodynamik bewegter Koerper"}},{"match":{"first_author":"einstein"}}]}}`,
+			wantValid: []bool{true, false},
+		},
+		{
+			name:      "journal, volume and page",
+			query:     Query{Journal: "Ann. Phys.", Volume: "322", FirstPage: "891", Year: 1905},
+			wantQuery: `{"bool":{"must":[{"multi_match":{"fields":["journal","abbreviated_journal"],"query":"Ann. Phys."}},{"match":{"volume":"322"}},{"match":{"first_page":"891"}}],"should":[{"match":{"year":"1905"}}]}}`,
+			wantValid: []bool{true, true},
+		},
+		{
+			name:      "ORCID and title",
+			query:     Query{ORCID: "https://orcid.org/0000-0002-1825-0097", Title: "Zur Elektrodynamik bewegter Koerper"},
+			wantQuery: `{"bool":{"must":[{"match":{"title":"Zur Elektrodynamik bewegter Koerper"}},{"nested":{"path":"authors","query":{"term":{"authors.orcid":"0000-0002-1825-0097"}}}}]}}`,
+			wantValid: []bool{true, false},
+		},
+		{
+			name:      "DOI",
+			query:     Query{DOI: "https://doi.org/10.1002/ANDP.19053221004"},
+			wantQuery: `{"match":{"DOI":"10.1002/andp.19053221004"}}`,
+			wantValid: []bool{true, false},
+		},
+		{
+			name:    "empty",
+			query:   Query{},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			is := is.New(t)
+
+			searcher := &fakeSearcher{hits: []elastic.Hit{hit(t, 10, einstein), hit(t, 5, other)}}
+			got, err := New(searcher, "crossref").Find(context.Background(), tt.query, 10)
+			if tt.wantErr {
+				is.True(err != nil)
+				return
+			}
+			is.NoErr(err)
+
+			gotQuery, err := json.Marshal(searcher.query)
+			is.NoErr(err)
+			is.Equal(string(gotQuery), tt.wantQuery)
+
+			is.Equal(len(got), len(tt.wantValid))
+			for i, candidate := range got {
+				is.Equal(candidate.Valid, tt.wantValid[i])
+			}
+			is.Equal(got[0].Publication, einstein)
+		})
+	}
+}
+
+func Test_similarity(t *testing.T) {
+	is := is.New(t)
+
+	is.Equal(similarity("", ""), 1.0)
+	is.Equal(similarity("abc", "abc"), 1.0)
+	is.Equal(similarity("abc", "xyz"), 0.0)
+	is.Equal(similarity("kitten", "sitting"), 1-3.0/7)
+}
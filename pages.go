@@ -0,0 +1,151 @@
+package crossrefindexer
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// PageRange is what is known about the pages of a publication from the page field of Crossref
+type PageRange struct {
+	First         string
+	Last          string // With abbreviated ranges expanded, so 123-9 ends at 129
+	Count         int    // Zero when it can't be known
+	ArticleNumber bool   // Electronic journals number articles instead of pages, like e1234
+}
+
+// maxPageCount is more pages than any publication has. Larger counts come from junk in the page field,
+// like 1-3000000000, and would not fit in the integer fields of the index.
+const maxPageCount = 100000
+
+// pageDashes are the dashes found between pages that all mean the same thing
+var pageDashes = strings.NewReplacer("‐", "-", "‑", "-", "‒", "-", "–", "-", "—", "-", "−", "-")
+
+var (
+	// pageSpacing is whitespace around the dash in a range
+	pageSpacing = regexp.MustCompile(`\s*-\s*`)
+	// pagePrefix is the "pp." or "p." that sometimes comes before the pages
+	pagePrefix = regexp.MustCompile(`(?i)^pp?\.\s*`)
+	// articleNumberWord is an article number written out, like "Article 123" or "Art. no. 123"
+	articleNumberWord = regexp.MustCompile(`(?i)^(?:article|art\.?)(?:\s*(?:no\.?|nr\.?|number))?\s*#?\s*(\S+)$`)
+	// articleNumberE is an article number with the e prefix used by many electronic journals
+	articleNumberE = regexp.MustCompile(`^[eE]\d+$`)
+	// pageNumber is a page with an optional prefix, like 123 or S12 for supplements
+	pageNumber = regexp.MustCompile(`^([A-Za-z]*)(\d+)$`)
+	// romanNumeral is a valid roman numeral used for pages in front matter, like xiv
+	romanNumeral = regexp.MustCompile(`(?i)^m{0,3}(cm|cd|d?c{0,3})(xc|xl|l?x{0,3})(ix|iv|v?i{0,3})$`)
+)
+
+// ParsePages parses the page field of Crossref, like 891-921, 123-9, S12-S15, xi-xiv or e1234.
+// Lists of ranges, like 1-3, 7-9, start at the first and end at the last with the pages of all ranges counted.
+func ParsePages(page string) PageRange {
+	page = pageDashes.Replace(strings.TrimSpace(page))
+	page = pagePrefix.ReplaceAllString(page, "")
+	page = pageSpacing.ReplaceAllString(page, "-")
+	if page == "" {
+		return PageRange{}
+	}
+
+	if match := articleNumberWord.FindStringSubmatch(page); match != nil {
+		return PageRange{First: match[1], ArticleNumber: true}
+	}
+	if articleNumberE.MatchString(page) {
+		return PageRange{First: page, ArticleNumber: true}
+	}
+
+	var pages PageRange
+	counted := true
+	for i, part := range strings.Split(page, ",") {
+		first, last, count := parsePageRange(strings.TrimSpace(part))
+		if i == 0 {
+			pages.First = first
+		}
+		pages.Last = last
+		pages.Count += count
+		counted = counted && count > 0
+	}
+
+	if !counted || pages.Count > maxPageCount {
+		pages.Count = 0
+	}
+	return pages
+}
+
+// parsePageRange parses a single page or range of pages. The count is zero if it is not a range that makes sense.
+func parsePageRange(pageRange string) (first, last string, count int) {
+	first, last, isRange := strings.Cut(pageRange, "-")
+	if strings.ContainsAny(first, " \t") {
+		// Not something that can be parsed, but the first word is still the best guess of the first page
+		return strings.Fields(first)[0], "", 0
+	}
+	if !isRange {
+		if pageNumber.MatchString(first) || isRoman(first) {
+			return first, first, 1
+		}
+		return first, "", 0
+	}
+	if last == "" || strings.ContainsAny(last, " \t") {
+		return first, "", 0
+	}
+
+	if isRoman(first) && isRoman(last) {
+		from, to := romanToInt(first), romanToInt(last)
+		return first, last, pageCount(from, to)
+	}
+
+	firstMatch, lastMatch := pageNumber.FindStringSubmatch(first), pageNumber.FindStringSubmatch(last)
+	if firstMatch == nil || lastMatch == nil {
+		return first, last, 0
+	}
+
+	prefix, firstDigits, lastDigits := firstMatch[1], firstMatch[2], lastMatch[2]
+	if lastMatch[1] != "" && !strings.EqualFold(lastMatch[1], prefix) {
+		return first, last, 0
+	}
+
+	// Abbreviated ranges leave out the leading digits that are the same as the first page
+	if len(lastDigits) < len(firstDigits) {
+		lastDigits = firstDigits[:len(firstDigits)-len(lastDigits)] + lastDigits
+	}
+	last = prefix + lastDigits
+
+	from, err := strconv.Atoi(firstDigits)
+	if err != nil {
+		return first, last, 0
+	}
+	to, err := strconv.Atoi(lastDigits)
+	if err != nil {
+		return first, last, 0
+	}
+
+	return first, last, pageCount(from, to)
+}
+
+// pageCount is the number of pages from one page to another, or zero if it is not a range that makes sense
+func pageCount(from, to int) int {
+	if to < from || to-from >= maxPageCount {
+		return 0
+	}
+	return to - from + 1
+}
+
+func isRoman(s string) bool {
+	return s != "" && romanNumeral.MatchString(s)
+}
+
+// romanToInt converts a valid roman numeral
+func romanToInt(s string) int {
+	values := map[byte]int{'i': 1, 'v': 5, 'x': 10, 'l': 50, 'c': 100, 'd': 500, 'm': 1000}
+	s = strings.ToLower(s)
+
+	total := 0
+	for i := 0; i < len(s); i++ {
+		value := values[s[i]]
+		if i+1 < len(s) && values[s[i+1]] > value {
+			total -= value
+		} else {
+			total += value
+		}
+	}
+	return total
+}
@@ -0,0 +1,49 @@
+package crossrefindexer
+
+import (
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+func Test_ParsePages(t *testing.T) {
+	tests := []struct {
+		page string
+		want PageRange
+	}{
+		{page: "891-921", want: PageRange{First: "891", Last: "921", Count: 31}},
+		{page: "200", want: PageRange{First: "200", Last: "200", Count: 1}},
+		{page: "123-9", want: PageRange{First: "123", Last: "129", Count: 7}},
+		{page: "1234-56", want: PageRange{First: "1234", Last: "1256", Count: 23}},
+		{page: "99-102", want: PageRange{First: "99", Last: "102", Count: 4}},
+		{page: "12–18", want: PageRange{First: "12", Last: "18", Count: 7}},
+		{page: "12 - 18", want: PageRange{First: "12", Last: "18", Count: 7}},
+		{page: "pp. 12-18", want: PageRange{First: "12", Last: "18", Count: 7}},
+		{page: "S12-S15", want: PageRange{First: "S12", Last: "S15", Count: 4}},
+		{page: "S12-15", want: PageRange{First: "S12", Last: "S15", Count: 4}},
+		{page: "xi-xiv", want: PageRange{First: "xi", Last: "xiv", Count: 4}},
+		{page: "IV", want: PageRange{First: "IV", Last: "IV", Count: 1}},
+		{page: "1-3, 7-9", want: PageRange{First: "1", Last: "9", Count: 6}},
+		{page: "e1234", want: PageRange{First: "e1234", ArticleNumber: true}},
+		{page: "E105", want: PageRange{First: "E105", ArticleNumber: true}},
+		{page: "Article 12", want: PageRange{First: "12", ArticleNumber: true}},
+		{page: "Art. no. 045001", want: PageRange{First: "045001", ArticleNumber: true}},
+		{page: "123-", want: PageRange{First: "123"}},
+		{page: "130-123", want: PageRange{First: "130", Last: "123"}},
+		{page: "S12-A15", want: PageRange{First: "S12", Last: "A15"}},
+		{page: "1-3000000000", want: PageRange{First: "1", Last: "3000000000"}},
+		{page: "1-100000", want: PageRange{First: "1", Last: "100000", Count: 100000}},
+		{page: "1-100001", want: PageRange{First: "1", Last: "100001"}},
+		{page: "1-3, 7a", want: PageRange{First: "1"}},
+		{page: "n/a", want: PageRange{First: "n/a"}},
+		{page: "see 12 ff", want: PageRange{First: "see"}},
+		{page: "", want: PageRange{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.page, func(t *testing.T) {
+			is := is.New(t)
+			is.Equal(ParsePages(tt.page), tt.want)
+		})
+	}
+}
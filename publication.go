@@ -2,9 +2,10 @@ package crossrefindexer
 
 import (
 	"fmt"
-	"regexp"
 	"strings"
 	"time"
+
+	"github.com/karatekaneen/crossrefindexer/textnorm"
 )
 
 // Reference and value semantics reflect required and optional value in json
@@ -49,6 +50,8 @@ type Crossref struct {
 	Type                string        `json:"type"`
 	URL                 string        `json:"URL"`
 	UpdatePolicy        *string       `json:"update-policy"` // Gap
+	UpdateTo            []Update      `json:"update-to"`     // Set on notices like retractions, pointing to what they update
+	UpdatedBy           []Update      `json:"updated-by"`    // Set on works that have been updated by a notice
 	Volume              string        `json:"volume"`
 	License             []License     `json:"license"`
 	AlternativeID       []string      `json:"alternative-id"`
@@ -64,13 +67,23 @@ type ContentDomain struct {
 	CrossmarkRestriction bool     `json:"crossmark-restriction"`
 }
 type Affiliation struct {
-	Name string `json:"name"`
+	Name string          `json:"name"`
+	ID   []AffiliationID `json:"id"`
+}
+type AffiliationID struct {
+	ID         string `json:"id"`
+	IDType     string `json:"id-type"` // Like ROR, ISNI or GRID
+	AssertedBy string `json:"asserted-by"`
 }
 type Author struct {
-	Given       *string        `json:"given"`
-	Family      *string        `json:"family"`
-	Sequence    *string        `json:"sequence"`
-	Affiliation *[]Affiliation `json:"affiliation"`
+	Given              *string        `json:"given"`
+	Family             *string        `json:"family"`
+	Suffix             *string        `json:"suffix"`
+	Name               *string        `json:"name"` // Set instead of given and family for organizations
+	Sequence           *string        `json:"sequence"`
+	ORCID              *string        `json:"ORCID"` // As URL, like http://orcid.org/0000-0002-1825-0097
+	AuthenticatedORCID bool           `json:"authenticated-orcid"`
+	Affiliation        *[]Affiliation `json:"affiliation"`
 }
 type DateParts struct {
 	DateParts [][]int `json:"date-parts"`
@@ -113,6 +126,15 @@ type IssnType struct {
 type Relation struct {
 	Cites []any `json:"cites"`
 }
+
+// Update is a Crossmark relation between a work and a notice such as a retraction or correction
+type Update struct {
+	Updated Indexed `json:"updated"`
+	DOI     string  `json:"DOI"`
+	Type    string  `json:"type"` // Like retraction, correction, erratum, withdrawal or expression_of_concern
+	Label   string  `json:"label"`
+	Source  string  `json:"source"`
+}
 type License struct {
 	URL            string  `json:"URL"`
 	Start          Indexed `json:"start"`
@@ -121,45 +143,57 @@ type License struct {
 }
 
 func pubTitle(pub Crossref) []string {
-	simpleTitle := pub.Title
-	if len(simpleTitle) == 0 {
+	if len(pub.Title) == 0 {
 		return []string{""}
 	}
-	for pos, title := range simpleTitle {
-		title = strings.Replace(title, "\n", " ", -1)
-		title = strings.Replace(title, "( )+", " ", -1)
-		simpleTitle[pos] = strings.TrimSpace(title)
+	return cleanTexts(pub.Title)
+}
+
+// cleanTexts returns a copy with every text cleaned with textnorm.Clean
+func cleanTexts(texts []string) []string {
+	if texts == nil {
+		return nil
+	}
+
+	cleaned := make([]string, len(texts))
+	for i, text := range texts {
+		cleaned[i] = textnorm.Clean(text)
+	}
+	return cleaned
+}
+
+// foldTexts removes diacritics from every text in place
+func foldTexts(texts []string) {
+	for i, text := range texts {
+		texts[i] = textnorm.Fold(text)
 	}
-	return simpleTitle
 }
 
 func firstPage(pub *Crossref) string {
-	sp := regexp.MustCompile(
-		`,|-` +
-			// This matches any white space character, including spaces, tabs, and newlines.
-			`|\s`)
-	pagePieces := sp.Split(pub.Page, -1)
-	return pagePieces[0]
+	return ParsePages(pub.Page).First
+}
+
+// PubYear is a date part (first one) in issued or created or published-online (we follow this order)
+func PubYear(pub *Crossref) int {
+	return extractYear(publishedDateParts(pub))
 }
 
-// year is a date part (first one) in issued or created or published-online (we follow this order)
-func pubYear(pub *Crossref) int {
-	var year int
+// publishedDateParts are the date-parts of the date that counts as the publication date
+func publishedDateParts(pub *Crossref) [][]int {
 	switch {
 	case pub.Issued.DateParts != nil:
-		year = extractYear(pub.Issued.DateParts)
+		return pub.Issued.DateParts
 	case pub.PublishedOnline != nil:
-		year = extractYear(pub.PublishedOnline.DateParts)
+		return pub.PublishedOnline.DateParts
 	case pub.PublishedPrint != nil:
-		year = extractYear(pub.PublishedPrint.DateParts)
+		return pub.PublishedPrint.DateParts
 	case pub.Created.DateParts != nil:
 		// this is deposit date, normally we will never use it, but it will ensure
 		// that we always have a date as conservative fallback
-		year = extractYear(pub.Created.DateParts)
+		return pub.Created.DateParts
 	default:
-		year = 0
+		return nil
 	}
-	return year
 }
 
 // extractYear from dateparts and handle if it is empty
@@ -171,13 +205,39 @@ func extractYear(dp [][]int) int {
 	return dp[0][0]
 }
 
+// firstAuthor is the family name of the author marked as first in the sequence, or the name
+// if it is an organization. Falls back to the first author with a family name or name.
+func firstAuthor(pub *Crossref) string {
+	for _, auth := range pub.Author {
+		if name := authorSurname(auth); stringFromPointer(auth.Sequence) == "first" && name != "" {
+			return name
+		}
+	}
+	for _, auth := range pub.Author {
+		if name := authorSurname(auth); name != "" {
+			return name
+		}
+	}
+	return ""
+}
+
+// authorSurname is the family name of a person, or the name of an organization which has nothing else
+func authorSurname(auth Author) string {
+	if family := stringFromPointer(auth.Family); family != "" {
+		return family
+	}
+	return stringFromPointer(auth.Name)
+}
+
 func buildBibliographicField(pub *Crossref) string {
-	author := make([]string, len(pub.Author))
+	author := make([]string, 0, len(pub.Author))
 	for _, auth := range pub.Author {
-		if stringFromPointer(auth.Family) == "" {
-			continue
+		// Organizations only have a name
+		if name := stringFromPointer(auth.Family); name != "" {
+			author = append(author, name)
+		} else if name := stringFromPointer(auth.Name); name != "" {
+			author = append(author, name)
 		}
-		author = append(author, *auth.Family)
 	}
 
 	abbreviatedJournal := []string{}
@@ -188,27 +248,87 @@ func buildBibliographicField(pub *Crossref) string {
 	bibliographic := []string{
 		strings.TrimSpace(strings.Join(author, " ")),
 		pubTitle(*pub)[0],
-		strings.Join(pub.ContainerTitle, " "),
-		strings.Join(abbreviatedJournal, " "),
+		strings.Join(cleanTexts(pub.ContainerTitle), " "),
+		strings.Join(cleanTexts(abbreviatedJournal), " "),
 		pub.Volume,
 		pub.Issue,
 		firstPage(pub),
-		fmt.Sprint(pubYear(pub)),
+		fmt.Sprint(PubYear(pub)),
 	}
 
-	return strings.Join(bibliographic, " ")
+	// Cleaning also collapses the spaces left by empty parts
+	return textnorm.Clean(strings.Join(bibliographic, " "))
 }
 
 type SimplifiedPublication struct {
-	Title              []string `json:"title"`
-	DOI                string   `json:"DOI"`
-	FirstPage          string   `json:"first_page"`
-	Journal            []string `json:"journal"`
-	AbbreviatedJournal []string `json:"abbreviated_journal"`
-	Volume             string   `json:"volume"`
-	Issue              string   `json:"issue"`
-	Year               int      `json:"year"`
-	Bibliographic      string   `json:"bibliographic"`
+	Title              []string            `json:"title"`
+	DOI                string              `json:"DOI"`                    // Normalized with NormalizeDOI
+	OriginalDOI        string              `json:"original_doi,omitempty"` // The DOI as written in the metadata if it differs
+	FirstAuthor        string              `json:"first_author"`
+	Authors            []PublicationAuthor `json:"authors,omitempty"`
+	FirstPage          string              `json:"first_page"`
+	LastPage           string              `json:"last_page,omitempty"`
+	PageCount          int                 `json:"page_count,omitempty"`
+	IsArticleNumber    bool                `json:"is_article_number,omitempty"` // FirstPage is an article number and not a page
+	Journal            []string            `json:"journal"`
+	AbbreviatedJournal []string            `json:"abbreviated_journal"`
+	Volume             string              `json:"volume"`
+	Issue              string              `json:"issue"`
+	Year               int                 `json:"year"`
+	PublishedDate      *PartialDate        `json:"published_date,omitempty"` // Chosen in the same order as Year
+	Dates              *PublicationDates   `json:"dates,omitempty"`
+	Bibliographic      string              `json:"bibliographic"`
+	IsRetracted        bool                `json:"is_retracted"`
+	UpdatedBy          []PublicationUpdate `json:"updated_by,omitempty"` // Notices that update this publication
+	Updates            []PublicationUpdate `json:"updates,omitempty"`    // Publications this notice updates
+	Abstract           string              `json:"abstract,omitempty"`   // Plain text, only set with WithAbstract
+
+	// Only set with WithExtended, the minimal profile leaves it out
+	*ExtendedMetadata
+
+	// IndexedAt is when Crossref last indexed the metadata in milliseconds. Not part of the document
+	// but used as its version so that only the newest metadata of a DOI is kept.
+	IndexedAt int64 `json:"-"`
+}
+
+// PublicationUpdate is the simplified form of an Update
+type PublicationUpdate struct {
+	Type string `json:"type"`
+	DOI  string `json:"DOI"`
+}
+
+// retractingUpdates are the kinds of updates that mean that the work should no longer be relied on
+var retractingUpdates = map[string]bool{
+	"retraction": true,
+	"withdrawal": true,
+	"removal":    true,
+}
+
+// publicationUpdates simplifies the updates with normalized DOIs
+func publicationUpdates(updates []Update) []PublicationUpdate {
+	if len(updates) == 0 {
+		return nil
+	}
+
+	simplified := make([]PublicationUpdate, 0, len(updates))
+	for _, update := range updates {
+		doi, _ := NormalizeDOI(update.DOI)
+		simplified = append(simplified, PublicationUpdate{
+			Type: strings.ToLower(update.Type),
+			DOI:  doi,
+		})
+	}
+	return simplified
+}
+
+// isRetracted is true if the work has been retracted, withdrawn or removed by a notice
+func isRetracted(pub *Crossref) bool {
+	for _, update := range pub.UpdatedBy {
+		if retractingUpdates[strings.ToLower(update.Type)] {
+			return true
+		}
+	}
+	return false
 }
 
 func stringFromPointer(s *string) string {
@@ -218,7 +338,27 @@ func stringFromPointer(s *string) string {
 	return *s
 }
 
-func ToSimplifiedPublication(pub *Crossref) SimplifiedPublication {
+// TransformOption changes what ToSimplifiedPublication includes
+type TransformOption func(*transformOptions)
+
+type transformOptions struct {
+	abstract bool
+	extended bool
+	fold     bool
+}
+
+// WithAbstract includes the abstract as plain text. Off by default since abstracts make up most of the size.
+func WithAbstract() TransformOption { return func(o *transformOptions) { o.abstract = true } }
+
+// WithFolding removes diacritics from titles, journals and the bibliographic string, so Körper becomes Korper
+func WithFolding() TransformOption { return func(o *transformOptions) { o.fold = true } }
+
+func ToSimplifiedPublication(pub *Crossref, options ...TransformOption) SimplifiedPublication {
+	var opts transformOptions
+	for _, option := range options {
+		option(&opts)
+	}
+
 	abbreviatedJournal := []string{}
 	if pub.ShortContainerTitle != nil {
 		abbreviatedJournal = *pub.ShortContainerTitle
@@ -226,13 +366,41 @@ func ToSimplifiedPublication(pub *Crossref) SimplifiedPublication {
 
 	var simpPub SimplifiedPublication
 	simpPub.Title = pubTitle(*pub)
-	simpPub.DOI = pub.Doi
-	simpPub.FirstPage = firstPage(pub)
-	simpPub.Journal = pub.ContainerTitle
-	simpPub.AbbreviatedJournal = abbreviatedJournal
+	// Invalid DOIs are kept as far as they could be normalized and it is up to the caller to filter them
+	simpPub.DOI, _ = NormalizeDOI(pub.Doi)
+	if simpPub.DOI != pub.Doi {
+		simpPub.OriginalDOI = pub.Doi
+	}
+	simpPub.FirstAuthor = firstAuthor(pub)
+	simpPub.Authors = publicationAuthors(pub.Author)
+	pages := ParsePages(pub.Page)
+	simpPub.FirstPage = pages.First
+	simpPub.LastPage = pages.Last
+	simpPub.PageCount = pages.Count
+	simpPub.IsArticleNumber = pages.ArticleNumber
+	simpPub.Journal = cleanTexts(pub.ContainerTitle)
+	simpPub.AbbreviatedJournal = cleanTexts(abbreviatedJournal)
 	simpPub.Volume = pub.Volume
 	simpPub.Issue = pub.Issue
-	simpPub.Year = pubYear(pub)
+	simpPub.Year = PubYear(pub)
+	simpPub.PublishedDate = NormalizeDate(publishedDateParts(pub))
+	simpPub.Dates = publicationDates(pub)
 	simpPub.Bibliographic = buildBibliographicField(pub)
+	simpPub.IsRetracted = isRetracted(pub)
+	simpPub.UpdatedBy = publicationUpdates(pub.UpdatedBy)
+	simpPub.Updates = publicationUpdates(pub.UpdateTo)
+	simpPub.IndexedAt = pub.Indexed.Timestamp
+	if opts.fold {
+		foldTexts(simpPub.Title)
+		foldTexts(simpPub.Journal)
+		foldTexts(simpPub.AbbreviatedJournal)
+		simpPub.Bibliographic = textnorm.Fold(simpPub.Bibliographic)
+	}
+	if opts.abstract {
+		simpPub.Abstract = cleanAbstract(stringFromPointer(pub.Abstract))
+	}
+	if opts.extended {
+		simpPub.ExtendedMetadata = toExtendedMetadata(pub)
+	}
 	return simpPub
 }
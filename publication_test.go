@@ -1,6 +1,7 @@
 package crossrefindexer
 
 import (
+	"encoding/json"
 	"testing"
 	"time"
 
@@ -38,11 +39,17 @@ var author3 = Author{
 	Sequence: &seq3,
 }
 
+var (
+	simplifiedAuthor1 = PublicationAuthor{Given: given1, Family: family1, Sequence: seq1}
+	simplifiedAuthor2 = PublicationAuthor{Given: given2, Family: family2, Sequence: seq2}
+	simplifiedAuthor3 = PublicationAuthor{Given: given3, Family: family3, Sequence: seq3}
+)
+
 func generateCrossref(modifiers ...func(*Crossref)) *Crossref {
 	ref := Crossref{
 		Title:               []string{"title 1", "title 2"},
 		Author:              []Author{author1, author2, author3},
-		Doi:                 "DOI",
+		Doi:                 "10.1000/ABC",
 		ContainerTitle:      []string{"Container Title 1", "Container Title 2"},
 		ShortContainerTitle: &shortContainerTitle,
 		Volume:              "Volume",
@@ -55,6 +62,11 @@ func generateCrossref(modifiers ...func(*Crossref)) *Crossref {
 			DateTime:  time.Date(2006, time.February, 27, 21, 28, 23, 0, time.UTC),
 			Timestamp: 1141075703000,
 		},
+		Indexed: Indexed{
+			DateParts: [][]int{{2022, 4, 1}},
+			DateTime:  time.Date(2022, time.April, 1, 12, 0, 0, 0, time.UTC),
+			Timestamp: 1648814400000,
+		},
 		Page: "200-300",
 	}
 
@@ -68,14 +80,25 @@ func generateCrossref(modifiers ...func(*Crossref)) *Crossref {
 func generateOutput(modifiers ...func(*SimplifiedPublication)) SimplifiedPublication {
 	pub := SimplifiedPublication{
 		Title:              []string{"title 1", "title 2"},
-		DOI:                "DOI",
+		DOI:                "10.1000/abc",
+		OriginalDOI:        "10.1000/ABC",
+		FirstAuthor:        "f1",
+		Authors:            []PublicationAuthor{simplifiedAuthor1, simplifiedAuthor2, simplifiedAuthor3},
 		FirstPage:          "200",
+		LastPage:           "300",
+		PageCount:          101,
 		Journal:            []string{"Container Title 1", "Container Title 2"},
 		AbbreviatedJournal: []string{"Short Container Title 1", "Short Container Title 2"},
 		Volume:             "Volume",
 		Issue:              "Issue",
 		Year:               2006,
-		Bibliographic:      "f1 f2 f3 title 1 Container Title 1 Container Title 2 Short Container Title 1 Short Container Title 2 Volume Issue 200 2006",
+		PublishedDate:      &PartialDate{Date: "2006-02-27", Precision: PrecisionDay},
+		Dates: &PublicationDates{
+			Issued:  &PartialDate{Date: "2006-02-27", Precision: PrecisionDay},
+			Created: &PartialDate{Date: "2006-02-27", Precision: PrecisionDay},
+		},
+		Bibliographic: "f1 f2 f3 title 1 Container Title 1 Container Title 2 Short Container Title 1 Short Container Title 2 Volume Issue 200 2006",
+		IndexedAt:     1648814400000,
 	}
 
 	for _, modifier := range modifiers {
@@ -89,6 +112,7 @@ func Test_ToSimplifiedPublication(t *testing.T) {
 	tests := []struct {
 		name    string
 		input   *Crossref
+		options []TransformOption
 		want    SimplifiedPublication
 		wantErr bool
 	}{
@@ -103,16 +127,169 @@ func Test_ToSimplifiedPublication(t *testing.T) {
 			input: generateCrossref(func(cr *Crossref) { cr.Issued = DateParts{} }),
 			want: generateOutput(func(sp *SimplifiedPublication) {
 				sp.Year = 0
+				sp.PublishedDate = nil
+				sp.Dates.Issued = nil
 				sp.Bibliographic = "f1 f2 f3 title 1 Container Title 1 Container Title 2 Short Container Title 1 Short Container Title 2 Volume Issue 200 0"
 			}),
 			wantErr: false,
 		},
+		{
+			name: "First author from sequence",
+			input: generateCrossref(func(cr *Crossref) {
+				cr.Author = []Author{author2, author1, author3}
+			}),
+			want: generateOutput(func(sp *SimplifiedPublication) {
+				sp.Authors = []PublicationAuthor{simplifiedAuthor2, simplifiedAuthor1, simplifiedAuthor3}
+				sp.Bibliographic = "f2 f1 f3 title 1 Container Title 1 Container Title 2 Short Container Title 1 Short Container Title 2 Volume Issue 200 2006"
+			}),
+			wantErr: false,
+		},
+		{
+			name: "Organization and ORCID",
+			input: generateCrossref(func(cr *Crossref) {
+				orcid, consortium := "http://orcid.org/0000-0002-1825-009x", "The Consortium"
+				first := author1
+				first.ORCID = &orcid
+				first.AuthenticatedORCID = true
+				first.Affiliation = &[]Affiliation{{
+					Name: "University",
+					ID:   []AffiliationID{{ID: "https://ror.org/02mhbdp94", IDType: "ROR", AssertedBy: "publisher"}},
+				}}
+				cr.Author = []Author{first, {Name: &consortium, Sequence: &seq2}}
+			}),
+			want: generateOutput(func(sp *SimplifiedPublication) {
+				first := simplifiedAuthor1
+				first.ORCID = "0000-0002-1825-009X"
+				first.AuthenticatedORCID = true
+				first.Affiliation = []PublicationAffiliation{{
+					Name: "University",
+					IDs:  []PublicationAffiliationID{{ID: "https://ror.org/02mhbdp94", Type: "ror"}},
+				}}
+				sp.Authors = []PublicationAuthor{first, {Name: "The Consortium", Sequence: seq2}}
+				sp.Bibliographic = "f1 The Consortium title 1 Container Title 1 Container Title 2 Short Container Title 1 Short Container Title 2 Volume Issue 200 2006"
+			}),
+		},
+		{
+			name: "Organization as first author",
+			input: generateCrossref(func(cr *Crossref) {
+				consortium := "The Consortium"
+				cr.Author = []Author{{Name: &consortium, Sequence: &seq1}, author2}
+			}),
+			want: generateOutput(func(sp *SimplifiedPublication) {
+				sp.FirstAuthor = "The Consortium"
+				sp.Authors = []PublicationAuthor{{Name: "The Consortium", Sequence: seq1}, simplifiedAuthor2}
+				sp.Bibliographic = "The Consortium f2 title 1 Container Title 1 Container Title 2 Short Container Title 1 Short Container Title 2 Volume Issue 200 2006"
+			}),
+		},
+		{
+			name: "Retracted",
+			input: generateCrossref(func(cr *Crossref) {
+				cr.UpdatedBy = []Update{
+					{DOI: "10.1000/Correction", Type: "correction"},
+					{DOI: "https://doi.org/10.1000/Retraction", Type: "retraction"},
+				}
+			}),
+			want: generateOutput(func(sp *SimplifiedPublication) {
+				sp.IsRetracted = true
+				sp.UpdatedBy = []PublicationUpdate{
+					{Type: "correction", DOI: "10.1000/correction"},
+					{Type: "retraction", DOI: "10.1000/retraction"},
+				}
+			}),
+		},
+		{
+			name: "Corrected is not retracted",
+			input: generateCrossref(func(cr *Crossref) {
+				cr.UpdatedBy = []Update{{DOI: "10.1000/correction", Type: "correction"}}
+			}),
+			want: generateOutput(func(sp *SimplifiedPublication) {
+				sp.UpdatedBy = []PublicationUpdate{{Type: "correction", DOI: "10.1000/correction"}}
+			}),
+		},
+		{
+			name: "Retraction notice",
+			input: generateCrossref(func(cr *Crossref) {
+				cr.UpdateTo = []Update{{DOI: "10.1000/retracted", Type: "retraction"}}
+			}),
+			want: generateOutput(func(sp *SimplifiedPublication) {
+				sp.Updates = []PublicationUpdate{{Type: "retraction", DOI: "10.1000/retracted"}}
+			}),
+		},
+		{
+			name: "Markup, entities and whitespace in titles and journals",
+			input: generateCrossref(func(cr *Crossref) {
+				cr.Title = []string{"title  <i>1</i>\n", "Zur Elektrodynamik bewegter Ko\u0308rper"}
+				cr.ContainerTitle = []string{"Container &amp; Title 1", "Container Title 2"}
+			}),
+			want: generateOutput(func(sp *SimplifiedPublication) {
+				sp.Title = []string{"title 1", "Zur Elektrodynamik bewegter Körper"}
+				sp.Journal = []string{"Container & Title 1", "Container Title 2"}
+				sp.Bibliographic = "f1 f2 f3 title 1 Container & Title 1 Container Title 2 Short Container Title 1 Short Container Title 2 Volume Issue 200 2006"
+			}),
+		},
+		{
+			name: "Folded diacritics",
+			input: generateCrossref(func(cr *Crossref) {
+				cr.Title = []string{"Zur Elektrodynamik bewegter Körper"}
+				cr.ContainerTitle = []string{"Annalen der Physik", "Straße"}
+			}),
+			options: []TransformOption{WithFolding()},
+			want: generateOutput(func(sp *SimplifiedPublication) {
+				sp.Title = []string{"Zur Elektrodynamik bewegter Korper"}
+				sp.Journal = []string{"Annalen der Physik", "Strasse"}
+				sp.Bibliographic = "f1 f2 f3 Zur Elektrodynamik bewegter Korper Annalen der Physik Strasse Short Container Title 1 Short Container Title 2 Volume Issue 200 2006"
+			}),
+		},
+		{
+			name: "Abstract left out by default",
+			input: generateCrossref(func(cr *Crossref) {
+				abstract := "<jats:p>Light is quantized.</jats:p>"
+				cr.Abstract = &abstract
+			}),
+			want: generateOutput(),
+		},
+		{
+			name: "Abstract as plain text",
+			input: generateCrossref(func(cr *Crossref) {
+				abstract := "<jats:title>Abstract</jats:title><jats:p>Light is <jats:italic>quantized</jats:italic> &amp; discrete.</jats:p>"
+				cr.Abstract = &abstract
+			}),
+			options: []TransformOption{WithAbstract()},
+			want: generateOutput(func(sp *SimplifiedPublication) {
+				sp.Abstract = "Light is quantized & discrete."
+			}),
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			is := is.New(t)
-			is.Equal(ToSimplifiedPublication(tt.input), tt.want)
+			is.Equal(ToSimplifiedPublication(tt.input, tt.options...), tt.want)
 		})
 	}
 }
+
+func Test_DecodeUpdates(t *testing.T) {
+	is := is.New(t)
+
+	data := []byte(`{
+		"DOI": "10.1000/retracted",
+		"updated-by": [
+			{
+				"updated": {"date-parts": [[2021, 3, 4]], "date-time": "2021-03-04T00:00:00Z", "timestamp": 1614816000000},
+				"DOI": "10.1000/notice",
+				"type": "retraction",
+				"label": "Retraction",
+				"source": "publisher"
+			}
+		]
+	}`)
+
+	var pub Crossref
+	is.NoErr(json.Unmarshal(data, &pub))
+	is.Equal(len(pub.UpdatedBy), 1)
+	is.Equal(pub.UpdatedBy[0].DOI, "10.1000/notice")
+	is.Equal(pub.UpdatedBy[0].Type, "retraction")
+	is.Equal(pub.UpdatedBy[0].Updated.Timestamp, int64(1614816000000))
+	is.True(ToSimplifiedPublication(&pub).IsRetracted)
+}
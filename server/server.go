@@ -0,0 +1,102 @@
+// Package server exposes lookups over HTTP with the same API as Biblio-Glutton's /service/lookup
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/karatekaneen/crossrefindexer/lookup"
+	"go.uber.org/zap"
+)
+
+// candidatesToFetch is how many candidates to consider before post-validation
+const candidatesToFetch = 5
+
+// Finder finds candidates for a query. Satisfied by *lookup.Lookup
+type Finder interface {
+	Find(ctx context.Context, q lookup.Query, size int) ([]lookup.Candidate, error)
+}
+
+type Server struct {
+	finder Finder
+	log    *zap.SugaredLogger
+}
+
+func New(finder Finder, log *zap.SugaredLogger) *Server {
+	return &Server{finder: finder, log: log}
+}
+
+// Handler returns the routes of the service.
+// The lookup is available both on /lookup and on Glutton's /service/lookup.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/lookup", s.handleLookup)
+	mux.HandleFunc("/service/lookup", s.handleLookup)
+	return mux
+}
+
+type errorResponse struct {
+	Message string `json:"message"`
+}
+
+// handleLookup responds with the stored publication of the best candidate.
+// Candidates failing post-validation are skipped unless postValidate=false is passed.
+func (s *Server) handleLookup(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.writeJSON(w, http.StatusMethodNotAllowed, errorResponse{Message: "only GET is supported"})
+		return
+	}
+
+	params := r.URL.Query()
+	query := lookup.Query{
+		DOI:         params.Get("doi"),
+		Biblio:      params.Get("biblio"),
+		Title:       params.Get("atitle"),
+		FirstAuthor: params.Get("firstAuthor"),
+		ORCID:       params.Get("orcid"),
+		Journal:     params.Get("jtitle"),
+		Volume:      params.Get("volume"),
+		FirstPage:   params.Get("firstPage"),
+	}
+
+	if year := params.Get("year"); year != "" {
+		parsed, err := strconv.Atoi(year)
+		if err != nil {
+			s.writeJSON(w, http.StatusBadRequest, errorResponse{Message: "year must be a number"})
+			return
+		}
+		query.Year = parsed
+	}
+
+	postValidate := params.Get("postValidate") != "false"
+
+	candidates, err := s.finder.Find(r.Context(), query, candidatesToFetch)
+	if errors.Is(err, lookup.ErrEmptyQuery) {
+		s.writeJSON(w, http.StatusBadRequest, errorResponse{Message: err.Error()})
+		return
+	} else if err != nil {
+		s.log.Errorw("Lookup failed", "err", err, "query", query)
+		s.writeJSON(w, http.StatusInternalServerError, errorResponse{Message: "lookup failed"})
+		return
+	}
+
+	for _, candidate := range candidates {
+		if candidate.Valid || !postValidate {
+			s.writeJSON(w, http.StatusOK, candidate.Publication)
+			return
+		}
+	}
+
+	s.writeJSON(w, http.StatusNotFound, errorResponse{Message: "no matching record found"})
+}
+
+func (s *Server) writeJSON(w http.ResponseWriter, status int, data any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(data); err != nil {
+		s.log.Debugw("Could not write response", "err", err)
+	}
+}
@@ -0,0 +1,126 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/karatekaneen/crossrefindexer"
+	"github.com/karatekaneen/crossrefindexer/elastic"
+	"github.com/karatekaneen/crossrefindexer/elastictest"
+	"github.com/karatekaneen/crossrefindexer/lookup"
+	"github.com/matryer/is"
+	"go.uber.org/zap"
+)
+
+func TestLookup(t *testing.T) {
+	tests := []struct {
+		name       string
+		path       string
+		params     url.Values
+		response   elastictest.TestCase
+		wantStatus int
+		wantDOI    string
+	}{
+		{
+			name:       "by DOI",
+			path:       "/lookup",
+			params:     url.Values{"doi": {"10.1002/andp.19053220607"}},
+			response:   elastictest.CaseSearchOk,
+			wantStatus: http.StatusOK,
+			wantDOI:    "10.1002/andp.19053220607",
+		},
+		{
+			name: "by title and first author skips invalid candidates",
+			path: "/service/lookup",
+			params: url.Values{
+				"atitle":      {"Über die von der molekularkinetischen Theorie der Wärme geforderte Bewegung von in ruhenden Flüssigkeiten suspendierten Teilchen"},
+				"firstAuthor": {"Einstein"},
+			},
+			response:   elastictest.CaseSearchOk,
+			wantStatus: http.StatusOK,
+			wantDOI:    "10.1002/andp.19053220806",
+		},
+		{
+			name:       "by citation string",
+			path:       "/lookup",
+			params:     url.Values{"biblio": {"A. Einstein, Ann. Phys. 322 (1905) 132"}},
+			response:   elastictest.CaseSearchOk,
+			wantStatus: http.StatusOK,
+			wantDOI:    "10.1002/andp.19053220607",
+		},
+		{
+			name:       "by journal, volume and first page",
+			path:       "/lookup",
+			params:     url.Values{"jtitle": {"Annalen der Physik"}, "volume": {"322"}, "firstPage": {"549"}},
+			response:   elastictest.CaseSearchOk,
+			wantStatus: http.StatusOK,
+			wantDOI:    "10.1002/andp.19053220806",
+		},
+		{
+			name:       "without post-validation",
+			path:       "/lookup",
+			params:     url.Values{"jtitle": {"Annalen der Physik"}, "firstPage": {"1"}, "postValidate": {"false"}},
+			response:   elastictest.CaseSearchOk,
+			wantStatus: http.StatusOK,
+			wantDOI:    "10.1002/andp.19053220607",
+		},
+		{
+			name:       "not found",
+			path:       "/lookup",
+			params:     url.Values{"doi": {"10.1000/missing"}},
+			response:   elastictest.CaseSearchEmpty,
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "no parameters",
+			path:       "/lookup",
+			params:     url.Values{},
+			response:   elastictest.CaseSearchEmpty,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "cluster error",
+			path:       "/lookup",
+			params:     url.Values{"doi": {"10.1000/missing"}},
+			response:   elastictest.CaseSearchIndexNotFound,
+			wantStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			is := is.New(t)
+
+			transport := elastictest.New(
+				elastictest.WithResponse(tt.response),
+				elastictest.WithValidation(func(r *http.Request) error {
+					if r.URL.Path != "/crossref/_search" {
+						t.Errorf("unexpected request to %s", r.URL)
+					}
+					return nil
+				}),
+			)
+			es, err := elastic.New(context.Background(), elastic.Config{}, zap.NewNop().Sugar(), elastic.WithTransport(transport))
+			is.NoErr(err)
+
+			srv := New(lookup.New(es, "crossref"), zap.NewNop().Sugar())
+
+			rec := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, tt.path+"?"+tt.params.Encode(), nil)
+			srv.Handler().ServeHTTP(rec, req)
+
+			is.Equal(rec.Code, tt.wantStatus)
+			is.Equal(rec.Header().Get("Content-Type"), "application/json")
+
+			if tt.wantStatus == http.StatusOK {
+				var pub crossrefindexer.SimplifiedPublication
+				is.NoErr(json.NewDecoder(rec.Body).Decode(&pub))
+				is.Equal(pub.DOI, tt.wantDOI)
+			}
+		})
+	}
+}
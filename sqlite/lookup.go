@@ -0,0 +1,130 @@
+package sqlite
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/karatekaneen/crossrefindexer"
+	"github.com/karatekaneen/crossrefindexer/lookup"
+)
+
+// Find returns at most `size` candidates matching the query, best match first.
+// It matches the same way as the lookup against Elasticsearch, with full text search on the title
+// or the citation string and exact matches on the other fields. It satisfies server.Finder.
+func (s *Store) Find(ctx context.Context, q lookup.Query, size int) ([]lookup.Candidate, error) {
+	query, args, err := searchQuery(q, size)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("lookup failed: %w", err)
+	}
+	defer rows.Close()
+
+	candidates := []lookup.Candidate{}
+	for rows.Next() {
+		var document string
+		var score float64
+		if err := rows.Scan(&document, &score); err != nil {
+			return nil, fmt.Errorf("could not read candidate: %w", err)
+		}
+
+		var pub crossrefindexer.SimplifiedPublication
+		if err := json.Unmarshal([]byte(document), &pub); err != nil {
+			return nil, fmt.Errorf("could not decode document: %w", err)
+		}
+
+		candidates = append(candidates, lookup.Candidate{
+			Score:       score,
+			Valid:       lookup.PostValidate(q, pub),
+			Publication: pub,
+		})
+	}
+
+	return candidates, rows.Err()
+}
+
+// searchQuery builds the SQL of the lookup. A DOI is an exact lookup and takes precedence.
+// The citation string is only searched when there are no structured fields, which are
+// needed for the post-validation anyway. A matching year ranks the candidate higher.
+func searchQuery(q lookup.Query, size int) (string, []any, error) {
+	if q.DOI != "" {
+		// Look up what could be normalized also for invalid DOIs, it might still be stored
+		doi, _ := crossrefindexer.NormalizeDOI(q.DOI)
+		return "SELECT document, 1 FROM publications WHERE doi = ? LIMIT ?", []any{doi, size}, nil
+	}
+
+	var match string
+	switch {
+	case !q.HasStructuredFields():
+		match = ftsMatch("bibliographic", q.Biblio)
+	case q.Title != "":
+		match = ftsMatch("title", q.Title)
+	}
+
+	where, args := []string{}, []any{}
+	if match != "" {
+		where = append(where, "publications_fts MATCH ?")
+		args = append(args, match)
+	}
+	if q.FirstAuthor != "" {
+		where = append(where, "p.first_author = ? COLLATE NOCASE")
+		args = append(args, q.FirstAuthor)
+	}
+	if q.ORCID != "" {
+		where = append(where, "EXISTS (SELECT 1 FROM json_each(p.document, '$.authors') WHERE json_extract(value, '$.orcid') = ?)")
+		args = append(args, crossrefindexer.NormalizeORCID(q.ORCID))
+	}
+	if q.Journal != "" {
+		where = append(where, "(p.journal = ? COLLATE NOCASE OR p.abbreviated_journal = ? COLLATE NOCASE)")
+		args = append(args, q.Journal, q.Journal)
+	}
+	if q.Volume != "" {
+		where = append(where, "p.volume = ?")
+		args = append(args, q.Volume)
+	}
+	if q.FirstPage != "" {
+		where = append(where, "p.first_page = ?")
+		args = append(args, q.FirstPage)
+	}
+
+	if len(where) == 0 {
+		return "", nil, lookup.ErrEmptyQuery
+	}
+
+	// bm25 is lower for better matches
+	score, from := "0", "publications p"
+	if match != "" {
+		score = "-bm25(publications_fts)"
+		from = "publications_fts JOIN publications p ON p.rowid = publications_fts.rowid"
+	}
+	if q.Year != 0 {
+		score += " + (p.year = ?)"
+		args = append([]any{q.Year}, args...)
+	}
+	args = append(args, size)
+
+	query := "SELECT p.document, " + score + " AS score FROM " + from +
+		" WHERE " + strings.Join(where, " AND ") +
+		" ORDER BY score DESC LIMIT ?"
+	return query, args, nil
+}
+
+// ftsMatch builds a full text query matching any of the words of the text in the column.
+// Every word is quoted so that nothing in the text is taken as query syntax.
+// It is empty if there are no words in the text.
+func ftsMatch(column, text string) string {
+	words := strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+	if len(words) == 0 {
+		return ""
+	}
+
+	return column + ` : ("` + strings.Join(words, `" OR "`) + `")`
+}
@@ -0,0 +1,290 @@
+// Package sqlite stores publications in a single SQLite file, for when running a cluster is too much.
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/karatekaneen/crossrefindexer"
+	"go.uber.org/zap"
+	_ "modernc.org/sqlite" // Registers the pure Go driver as "sqlite"
+)
+
+type Config struct {
+	Path      string `help:"Path to the SQLite database. Created if it does not exist" name:"path"       type:"path" optional:""`
+	BatchSize int    `help:"Number of publications to write in each transaction"       name:"batch-size" default:"10000"`
+}
+
+// schema creates the tables if they don't exist. The full text table has the publications table as its
+// external content, so the text is only stored once, and is kept up to date by the triggers.
+const schema = `
+CREATE TABLE IF NOT EXISTS publications (
+	doi                 TEXT PRIMARY KEY,
+	title               TEXT NOT NULL,
+	first_author        TEXT NOT NULL,
+	journal             TEXT NOT NULL,
+	abbreviated_journal TEXT NOT NULL,
+	volume              TEXT NOT NULL,
+	issue               TEXT NOT NULL,
+	first_page          TEXT NOT NULL,
+	year                INTEGER NOT NULL,
+	bibliographic       TEXT NOT NULL,
+	is_retracted        INTEGER NOT NULL,
+	indexed_at          INTEGER NOT NULL,
+	document            TEXT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS publications_year ON publications (year);
+CREATE INDEX IF NOT EXISTS publications_journal ON publications (journal COLLATE NOCASE);
+CREATE INDEX IF NOT EXISTS publications_abbreviated_journal ON publications (abbreviated_journal COLLATE NOCASE);
+CREATE INDEX IF NOT EXISTS publications_first_page ON publications (first_page);
+
+CREATE VIRTUAL TABLE IF NOT EXISTS publications_fts USING fts5 (
+	title,
+	bibliographic,
+	content = 'publications',
+	content_rowid = 'rowid'
+);
+
+CREATE TRIGGER IF NOT EXISTS publications_fts_insert AFTER INSERT ON publications BEGIN
+	INSERT INTO publications_fts (rowid, title, bibliographic) VALUES (new.rowid, new.title, new.bibliographic);
+END;
+
+CREATE TRIGGER IF NOT EXISTS publications_fts_delete AFTER DELETE ON publications BEGIN
+	INSERT INTO publications_fts (publications_fts, rowid, title, bibliographic)
+	VALUES ('delete', old.rowid, old.title, old.bibliographic);
+END;
+
+CREATE TRIGGER IF NOT EXISTS publications_fts_update AFTER UPDATE ON publications BEGIN
+	INSERT INTO publications_fts (publications_fts, rowid, title, bibliographic)
+	VALUES ('delete', old.rowid, old.title, old.bibliographic);
+	INSERT INTO publications_fts (rowid, title, bibliographic) VALUES (new.rowid, new.title, new.bibliographic);
+END;
+`
+
+// upsert writes a publication unless a newer version of it is already stored.
+// Equal versions overwrite so that writing the same data again works, the same as in Elasticsearch.
+const upsert = `
+INSERT INTO publications (
+	doi, title, first_author, journal, abbreviated_journal, volume, issue,
+	first_page, year, bibliographic, is_retracted, indexed_at, document
+) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+ON CONFLICT (doi) DO UPDATE SET
+	title = excluded.title,
+	first_author = excluded.first_author,
+	journal = excluded.journal,
+	abbreviated_journal = excluded.abbreviated_journal,
+	volume = excluded.volume,
+	issue = excluded.issue,
+	first_page = excluded.first_page,
+	year = excluded.year,
+	bibliographic = excluded.bibliographic,
+	is_retracted = excluded.is_retracted,
+	indexed_at = excluded.indexed_at,
+	document = excluded.document
+WHERE excluded.indexed_at >= publications.indexed_at
+`
+
+// Store is a SQLite database of publications keyed by normalized DOI
+type Store struct {
+	db     *sql.DB
+	config Config
+	log    *zap.SugaredLogger
+}
+
+// Open opens the database at the path in the config and creates the tables if needed
+func Open(cfg Config, log *zap.SugaredLogger) (*Store, error) {
+	if cfg.Path == "" {
+		return nil, errors.New("a path to the SQLite database is required")
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 1
+	}
+
+	// WAL lets lookups read while publications are written
+	dsn := cfg.Path + "?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_pragma=synchronous(NORMAL)"
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("could not open %s: %w", cfg.Path, err)
+	}
+
+	if _, err := db.Exec(schema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("could not create tables in %s: %w", cfg.Path, err)
+	}
+
+	return &Store{db: db, config: cfg, log: log}, nil
+}
+
+// Remove deletes the database at the path together with its write-ahead log
+func Remove(path string) error {
+	for _, file := range []string{path, path + "-wal", path + "-shm"} {
+		if err := os.Remove(file); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// IndexPublications writes all the publications sent on `data` in batches of one transaction each.
+// It returns when the channel is closed and everything is written.
+func (s *Store) IndexPublications(ctx context.Context, data chan crossrefindexer.SimplifiedPublication) error {
+	start := time.Now()
+	written, outdated := 0, 0
+
+	var tx *sql.Tx
+	var stmt *sql.Stmt
+	inBatch := 0
+
+	commit := func() error {
+		if tx == nil {
+			return nil
+		}
+		defer func() { tx, stmt, inBatch = nil, nil, 0 }()
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("could not commit publications: %w", err)
+		}
+		return nil
+	}
+
+	for pub := range data {
+		if tx == nil {
+			var err error
+			if tx, err = s.db.BeginTx(ctx, nil); err != nil {
+				return fmt.Errorf("could not begin transaction: %w", err)
+			}
+			if stmt, err = tx.PrepareContext(ctx, upsert); err != nil {
+				//nolint:errcheck
+				tx.Rollback()
+				return fmt.Errorf("could not prepare statement: %w", err)
+			}
+		}
+
+		args, err := publicationArgs(pub)
+		if err != nil {
+			//nolint:errcheck
+			tx.Rollback()
+			return err
+		}
+
+		result, err := stmt.ExecContext(ctx, args...)
+		if err != nil {
+			//nolint:errcheck
+			tx.Rollback()
+			return fmt.Errorf("could not write %s: %w", pub.DOI, err)
+		}
+		if affected, err := result.RowsAffected(); err == nil && affected == 0 {
+			outdated++
+		} else {
+			written++
+		}
+
+		inBatch++
+		if inBatch >= s.config.BatchSize {
+			if err := commit(); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := commit(); err != nil {
+		return err
+	}
+
+	s.log.Infof("Wrote %s publications to %s in %s",
+		humanize.Comma(int64(written)),
+		s.config.Path,
+		time.Since(start).Truncate(time.Millisecond),
+	)
+	if outdated > 0 {
+		s.log.Infof("Skipped %s publications that were older than the stored version", humanize.Comma(int64(outdated)))
+	}
+	return nil
+}
+
+// publicationArgs are the values of the upsert statement
+func publicationArgs(pub crossrefindexer.SimplifiedPublication) ([]any, error) {
+	document, err := json.Marshal(pub)
+	if err != nil {
+		return nil, fmt.Errorf("could not marshal %s to json: %w", pub.DOI, err)
+	}
+
+	return []any{
+		pub.DOI,
+		strings.Join(pub.Title, " "),
+		pub.FirstAuthor,
+		first(pub.Journal),
+		first(pub.AbbreviatedJournal),
+		pub.Volume,
+		pub.Issue,
+		pub.FirstPage,
+		pub.Year,
+		pub.Bibliographic,
+		pub.IsRetracted,
+		pub.IndexedAt,
+		string(document),
+	}, nil
+}
+
+func first(values []string) string {
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+// Refresh does nothing since committed publications are visible right away.
+// It is here so that the store can be verified the same way as an index.
+func (s *Store) Refresh(ctx context.Context, _ string) error {
+	return nil
+}
+
+// Count returns the number of stored publications. There is only one table so the index name is ignored.
+func (s *Store) Count(ctx context.Context, _ string) (int, error) {
+	var count int
+	if err := s.db.QueryRowContext(ctx, "SELECT count(*) FROM publications").Scan(&count); err != nil {
+		return 0, fmt.Errorf("could not count publications: %w", err)
+	}
+	return count, nil
+}
+
+// Documents fetches the stored documents with the DOIs. Documents that are not found are left out.
+func (s *Store) Documents(ctx context.Context, _ string, ids []string) (map[string]json.RawMessage, error) {
+	docs := make(map[string]json.RawMessage, len(ids))
+	if len(ids) == 0 {
+		return docs, nil
+	}
+
+	args := make([]any, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(ids)), ",")
+
+	rows, err := s.db.QueryContext(ctx, "SELECT doi, document FROM publications WHERE doi IN ("+placeholders+")", args...)
+	if err != nil {
+		return nil, fmt.Errorf("could not fetch documents: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var doi, document string
+		if err := rows.Scan(&doi, &document); err != nil {
+			return nil, fmt.Errorf("could not read document: %w", err)
+		}
+		docs[doi] = json.RawMessage(document)
+	}
+
+	return docs, rows.Err()
+}
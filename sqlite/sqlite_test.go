@@ -0,0 +1,185 @@
+package sqlite
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/karatekaneen/crossrefindexer"
+	"github.com/karatekaneen/crossrefindexer/lookup"
+	"github.com/matryer/is"
+	"go.uber.org/zap"
+)
+
+func publications() []crossrefindexer.SimplifiedPublication {
+	return []crossrefindexer.SimplifiedPublication{
+		{
+			DOI:                "10.1002/andp.19053221004",
+			Title:              []string{"Zur Elektrodynamik bewegter Körper"},
+			FirstAuthor:        "Einstein",
+			Authors:            []crossrefindexer.PublicationAuthor{{Given: "A.", Family: "Einstein", ORCID: "0000-0002-1825-0097"}},
+			FirstPage:          "891",
+			Journal:            []string{"Annalen der Physik"},
+			AbbreviatedJournal: []string{"Ann. Phys."},
+			Volume:             "322",
+			Issue:              "10",
+			Year:               1905,
+			Bibliographic:      "Zur Elektrodynamik bewegter Körper Einstein Annalen der Physik 322 10 891 1905",
+			IndexedAt:          2,
+		},
+		{
+			DOI:                "10.1002/andp.19053220607",
+			Title:              []string{"Über einen die Erzeugung und Verwandlung des Lichtes betreffenden heuristischen Gesichtspunkt"},
+			FirstAuthor:        "Einstein",
+			FirstPage:          "132",
+			Journal:            []string{"Annalen der Physik"},
+			AbbreviatedJournal: []string{"Ann. Phys."},
+			Volume:             "322",
+			Issue:              "6",
+			Year:               1905,
+			Bibliographic:      "Über einen die Erzeugung und Verwandlung des Lichtes betreffenden heuristischen Gesichtspunkt Einstein Annalen der Physik 322 6 132 1905",
+			IndexedAt:          1,
+		},
+		{
+			DOI:           "10.1103/physrev.47.777",
+			Title:         []string{"Can Quantum-Mechanical Description of Physical Reality Be Considered Complete?"},
+			FirstAuthor:   "Einstein",
+			FirstPage:     "777",
+			Journal:       []string{"Physical Review"},
+			Volume:        "47",
+			Year:          1935,
+			Bibliographic: "Can Quantum-Mechanical Description of Physical Reality Be Considered Complete? Einstein Physical Review 47 777 1935",
+			IndexedAt:     1,
+		},
+	}
+}
+
+// openStore opens a new store with the publications written to it
+func openStore(t *testing.T, pubs ...crossrefindexer.SimplifiedPublication) *Store {
+	is := is.New(t)
+
+	store, err := Open(Config{Path: filepath.Join(t.TempDir(), "crossref.db"), BatchSize: 2}, zap.NewNop().Sugar())
+	is.NoErr(err)
+	t.Cleanup(func() { store.Close() })
+
+	data := make(chan crossrefindexer.SimplifiedPublication, len(pubs))
+	for _, pub := range pubs {
+		data <- pub
+	}
+	close(data)
+	is.NoErr(store.IndexPublications(context.Background(), data))
+
+	return store
+}
+
+func TestIndexPublications(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+
+	outdated := publications()[0]
+	outdated.Volume = "1"
+	outdated.IndexedAt = 1
+	updated := publications()[2]
+	updated.Volume = "48"
+	updated.IndexedAt = 2
+
+	store := openStore(t, append(publications(), outdated, updated)...)
+
+	count, err := store.Count(ctx, "")
+	is.NoErr(err)
+	is.Equal(count, 3)
+
+	docs, err := store.Documents(ctx, "", []string{"10.1002/andp.19053221004", "10.1103/physrev.47.777", "10.1000/missing"})
+	is.NoErr(err)
+	is.Equal(len(docs), 2)
+
+	var pub crossrefindexer.SimplifiedPublication
+	is.NoErr(json.Unmarshal(docs["10.1002/andp.19053221004"], &pub))
+	is.Equal(pub.Volume, "322") // Older versions don't overwrite
+	is.NoErr(json.Unmarshal(docs["10.1103/physrev.47.777"], &pub))
+	is.Equal(pub.Volume, "48") // Newer versions do
+
+	// The full text search follows the updates
+	candidates, err := store.Find(ctx, lookup.Query{Title: "Quantum Mechanical Description", Volume: "48"}, 5)
+	is.NoErr(err)
+	is.Equal(len(candidates), 1)
+}
+
+func TestFind(t *testing.T) {
+	store := openStore(t, publications()...)
+
+	tests := []struct {
+		name    string
+		query   lookup.Query
+		wantDOI string // Of the best candidate
+		wantLen int
+		wantErr error
+	}{
+		{
+			name:    "by DOI",
+			query:   lookup.Query{DOI: "https://doi.org/10.1002/ANDP.19053221004"},
+			wantDOI: "10.1002/andp.19053221004",
+			wantLen: 1,
+		},
+		{
+			name:    "by title and first author",
+			query:   lookup.Query{Title: "Zur Elektrodynamik bewegter Korper", FirstAuthor: "einstein"},
+			wantDOI: "10.1002/andp.19053221004",
+			wantLen: 1,
+		},
+		{
+			name:    "by citation string",
+			query:   lookup.Query{Biblio: "A. Einstein, Can quantum-mechanical description of physical reality be considered complete? Phys. Rev. 47, 777 (1935)"},
+			wantDOI: "10.1103/physrev.47.777",
+			wantLen: 3,
+		},
+		{
+			name:    "by abbreviated journal, volume and first page",
+			query:   lookup.Query{Journal: "ann. phys.", Volume: "322", FirstPage: "132"},
+			wantDOI: "10.1002/andp.19053220607",
+			wantLen: 1,
+		},
+		{
+			name:    "by ORCID",
+			query:   lookup.Query{ORCID: "https://orcid.org/0000-0002-1825-0097"},
+			wantDOI: "10.1002/andp.19053221004",
+			wantLen: 1,
+		},
+		{
+			name:    "year ranks higher",
+			query:   lookup.Query{FirstAuthor: "Einstein", Year: 1935},
+			wantDOI: "10.1103/physrev.47.777",
+			wantLen: 3,
+		},
+		{
+			name:    "nothing found",
+			query:   lookup.Query{Title: "Relativity", Volume: "322"},
+			wantLen: 0,
+		},
+		{
+			name:    "empty query",
+			query:   lookup.Query{Biblio: "(),."},
+			wantErr: lookup.ErrEmptyQuery,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			is := is.New(t)
+
+			candidates, err := store.Find(context.Background(), tt.query, 5)
+			if tt.wantErr != nil {
+				is.True(errors.Is(err, tt.wantErr))
+				return
+			}
+			is.NoErr(err)
+			is.Equal(len(candidates), tt.wantLen)
+			if tt.wantDOI != "" {
+				is.Equal(candidates[0].Publication.DOI, tt.wantDOI)
+				is.True(candidates[0].Valid)
+			}
+		})
+	}
+}
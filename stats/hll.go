@@ -0,0 +1,60 @@
+package stats
+
+import (
+	"hash/maphash"
+	"math"
+	"math/bits"
+)
+
+// hllPrecision gives 2^14 registers which is 16kB of memory and roughly 1% standard error
+const hllPrecision = 14
+
+// HyperLogLog estimates the number of distinct keys with a fixed amount of memory.
+type HyperLogLog struct {
+	seed      maphash.Seed
+	registers []uint8
+}
+
+func NewHyperLogLog() *HyperLogLog {
+	return &HyperLogLog{
+		seed:      maphash.MakeSeed(),
+		registers: make([]uint8, 1<<hllPrecision),
+	}
+}
+
+// Add registers key as seen
+func (h *HyperLogLog) Add(key string) {
+	hash := maphash.String(h.seed, key)
+
+	index := hash >> (64 - hllPrecision)
+	// Count the leading zeros of the remaining bits. The sentinel bit makes sure we stop in time.
+	rank := uint8(bits.LeadingZeros64(hash<<hllPrecision|1<<(hllPrecision-1))) + 1
+
+	if rank > h.registers[index] {
+		h.registers[index] = rank
+	}
+}
+
+// Estimate returns the approximate number of distinct keys added
+func (h *HyperLogLog) Estimate() uint64 {
+	m := float64(len(h.registers))
+
+	sum := 0.0
+	zeros := 0
+	for _, r := range h.registers {
+		sum += 1.0 / float64(uint64(1)<<r)
+		if r == 0 {
+			zeros++
+		}
+	}
+
+	alpha := 0.7213 / (1 + 1.079/m)
+	estimate := alpha * m * m / sum
+
+	// Use linear counting for small cardinalities where HLL is biased
+	if estimate <= 2.5*m && zeros > 0 {
+		estimate = m * math.Log(m/float64(zeros))
+	}
+
+	return uint64(estimate + 0.5)
+}
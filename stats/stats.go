@@ -0,0 +1,188 @@
+// Package stats aggregates statistics about Crossref metadata without keeping the records in memory.
+package stats
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/dustin/go-humanize"
+	"github.com/karatekaneen/crossrefindexer"
+)
+
+// Collector counts records as they are added. Low cardinality fields such as type and year
+// are counted exactly while publishers and members use approximate counters.
+// It is not safe for concurrent use.
+type Collector struct {
+	total          uint64
+	types          map[string]uint64
+	years          map[int]uint64
+	publishers     *TopK
+	publishersSeen *HyperLogLog
+	members        *TopK
+	membersSeen    *HyperLogLog
+	missingTitle   uint64
+	missingPages   uint64
+	missingAuthors uint64
+}
+
+// New creates a collector that tracks at most `capacity` publishers and members.
+func New(capacity int) *Collector {
+	return &Collector{
+		types:          map[string]uint64{},
+		years:          map[int]uint64{},
+		publishers:     NewTopK(capacity),
+		publishersSeen: NewHyperLogLog(),
+		members:        NewTopK(capacity),
+		membersSeen:    NewHyperLogLog(),
+	}
+}
+
+// Add counts a single publication
+func (c *Collector) Add(pub *crossrefindexer.Crossref) {
+	c.total++
+	c.types[pub.Type]++
+	c.years[crossrefindexer.PubYear(pub)]++
+
+	c.publishers.Add(pub.Publisher)
+	c.publishersSeen.Add(pub.Publisher)
+	c.members.Add(pub.Member)
+	c.membersSeen.Add(pub.Member)
+
+	if !hasTitle(pub) {
+		c.missingTitle++
+	}
+	if strings.TrimSpace(pub.Page) == "" {
+		c.missingPages++
+	}
+	if len(pub.Author) == 0 {
+		c.missingAuthors++
+	}
+}
+
+func hasTitle(pub *crossrefindexer.Crossref) bool {
+	for _, title := range pub.Title {
+		if strings.TrimSpace(title) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+type Count struct {
+	Key   string `json:"key"`
+	Count uint64 `json:"count"`
+	Error uint64 `json:"error,omitempty"` // Max overestimation for approximate counts
+}
+
+type TopReport struct {
+	Distinct uint64  `json:"distinct_estimate"`
+	Top      []Count `json:"top"`
+}
+
+type Missing struct {
+	Title   uint64 `json:"title"`
+	Pages   uint64 `json:"pages"`
+	Authors uint64 `json:"authors"`
+}
+
+type Report struct {
+	Total      uint64    `json:"total"`
+	Types      []Count   `json:"types"`
+	Years      []Count   `json:"years"`
+	Publishers TopReport `json:"publishers"`
+	Members    TopReport `json:"members"`
+	Missing    Missing   `json:"missing"`
+}
+
+// Report summarizes what has been collected so far.
+// `top` limits the number of publishers and members included.
+func (c *Collector) Report(top int) Report {
+	types := make([]Count, 0, len(c.types))
+	for key, count := range c.types {
+		types = append(types, Count{Key: key, Count: count})
+	}
+	sort.Slice(types, func(i, j int) bool {
+		if types[i].Count == types[j].Count {
+			return types[i].Key < types[j].Key
+		}
+		return types[i].Count > types[j].Count
+	})
+
+	yearKeys := make([]int, 0, len(c.years))
+	for year := range c.years {
+		yearKeys = append(yearKeys, year)
+	}
+	sort.Ints(yearKeys)
+
+	years := make([]Count, 0, len(yearKeys))
+	for _, year := range yearKeys {
+		years = append(years, Count{Key: strconv.Itoa(year), Count: c.years[year]})
+	}
+
+	return Report{
+		Total: c.total,
+		Types: types,
+		Years: years,
+		Publishers: TopReport{
+			Distinct: c.publishersSeen.Estimate(),
+			Top:      c.publishers.Top(top),
+		},
+		Members: TopReport{
+			Distinct: c.membersSeen.Estimate(),
+			Top:      c.members.Top(top),
+		},
+		Missing: Missing{
+			Title:   c.missingTitle,
+			Pages:   c.missingPages,
+			Authors: c.missingAuthors,
+		},
+	}
+}
+
+// WriteJSON writes the report as indented JSON
+func (r Report) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// WriteTable writes the report as human readable tables
+func (r Report) WriteTable(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintf(tw, "Total records\t%s\t\n", humanize.Comma(int64(r.Total)))
+	fmt.Fprintf(tw, "Missing title\t%s\t\n", humanize.Comma(int64(r.Missing.Title)))
+	fmt.Fprintf(tw, "Missing pages\t%s\t\n", humanize.Comma(int64(r.Missing.Pages)))
+	fmt.Fprintf(tw, "Missing authors\t%s\t\n", humanize.Comma(int64(r.Missing.Authors)))
+
+	writeCounts(tw, "Type", r.Types)
+	writeCounts(tw, "Year", r.Years)
+
+	fmt.Fprintf(tw, "\nPublishers (~%s distinct)\t\t\n", humanize.Comma(int64(r.Publishers.Distinct)))
+	writeCounts(tw, "Publisher", r.Publishers.Top)
+	fmt.Fprintf(tw, "\nMembers (~%s distinct)\t\t\n", humanize.Comma(int64(r.Members.Distinct)))
+	writeCounts(tw, "Member", r.Members.Top)
+
+	return tw.Flush()
+}
+
+func writeCounts(w io.Writer, title string, counts []Count) {
+	fmt.Fprintf(w, "\n%s\tCount\t\n", title)
+	for _, c := range counts {
+		key := c.Key
+		if key == "" {
+			key = "<empty>"
+		}
+
+		count := humanize.Comma(int64(c.Count))
+		if c.Error > 0 {
+			count = fmt.Sprintf("%s (±%s)", count, humanize.Comma(int64(c.Error)))
+		}
+		fmt.Fprintf(w, "%s\t%s\t\n", key, count)
+	}
+}
@@ -0,0 +1,111 @@
+package stats
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/karatekaneen/crossrefindexer"
+	"github.com/matryer/is"
+)
+
+func Test_Collector(t *testing.T) {
+	is := is.New(t)
+
+	given := "given"
+	pubs := []crossrefindexer.Crossref{
+		{
+			Type:      "journal-article",
+			Publisher: "Elsevier",
+			Member:    "78",
+			Title:     []string{"A title"},
+			Page:      "1-2",
+			Author:    []crossrefindexer.Author{{Given: &given}},
+			Issued:    crossrefindexer.DateParts{DateParts: [][]int{{2020, 1}}},
+		},
+		{
+			Type:      "journal-article",
+			Publisher: "Elsevier",
+			Member:    "78",
+			Title:     []string{" "},
+			Issued:    crossrefindexer.DateParts{DateParts: [][]int{{2021}}},
+		},
+		{
+			Type:      "book",
+			Publisher: "Springer",
+			Member:    "297",
+			Issued:    crossrefindexer.DateParts{DateParts: [][]int{{2020}}},
+		},
+	}
+
+	c := New(10)
+	for i := range pubs {
+		c.Add(&pubs[i])
+	}
+
+	got := c.Report(1)
+	is.Equal(got.Total, uint64(3))
+	is.Equal(got.Types, []Count{{Key: "journal-article", Count: 2}, {Key: "book", Count: 1}})
+	is.Equal(got.Years, []Count{{Key: "2020", Count: 2}, {Key: "2021", Count: 1}})
+	is.Equal(got.Publishers.Top, []Count{{Key: "Elsevier", Count: 2}})
+	is.Equal(got.Publishers.Distinct, uint64(2))
+	is.Equal(got.Members.Top, []Count{{Key: "78", Count: 2}})
+	is.Equal(got.Missing, Missing{Title: 2, Pages: 2, Authors: 2})
+
+	var buf bytes.Buffer
+	is.NoErr(got.WriteJSON(&buf))
+	var decoded Report
+	is.NoErr(json.Unmarshal(buf.Bytes(), &decoded))
+	is.Equal(decoded.Total, got.Total)
+
+	buf.Reset()
+	is.NoErr(got.WriteTable(&buf))
+	is.True(bytes.Contains(buf.Bytes(), []byte("journal-article")))
+}
+
+func Test_TopK(t *testing.T) {
+	is := is.New(t)
+
+	topK := NewTopK(3)
+	// One heavy hitter among many distinct keys that will be evicted
+	for i := 0; i < 1000; i++ {
+		topK.Add("heavy")
+		topK.Add(fmt.Sprint("light", i))
+	}
+
+	top := topK.Top(1)
+	is.Equal(len(top), 1)
+	is.Equal(top[0].Key, "heavy")
+	is.True(top[0].Count >= 1000)              // Never underestimated
+	is.True(top[0].Count-top[0].Error <= 1000) // Error bounds the real count
+	is.Equal(len(topK.Top(-1)), 3)             // Memory is bounded by capacity
+}
+
+func Test_HyperLogLog(t *testing.T) {
+	tests := []struct {
+		name     string
+		distinct int
+	}{
+		{name: "empty", distinct: 0},
+		{name: "small", distinct: 100},
+		{name: "large", distinct: 200_000},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			is := is.New(t)
+
+			hll := NewHyperLogLog()
+			for i := 0; i < tt.distinct; i++ {
+				key := fmt.Sprint("key", i)
+				hll.Add(key)
+				hll.Add(key) // Duplicates should not be counted
+			}
+
+			got := float64(hll.Estimate())
+			want := float64(tt.distinct)
+			is.True(got >= want*0.95 && got <= want*1.05) // Within 5%
+		})
+	}
+}
@@ -0,0 +1,105 @@
+package stats
+
+import (
+	"container/heap"
+	"sort"
+)
+
+// TopK keeps approximate counts of the most frequent keys using the Space-Saving algorithm.
+// It never tracks more than `capacity` keys, so memory is bounded no matter how many
+// distinct keys are added. Counts may be overestimated by at most the reported error.
+type TopK struct {
+	capacity int
+	entries  map[string]*topKEntry
+	heap     topKHeap
+}
+
+type topKEntry struct {
+	key   string
+	count uint64
+	err   uint64 // Max overestimation of count
+	index int    // Position in the heap
+}
+
+func NewTopK(capacity int) *TopK {
+	if capacity < 1 {
+		capacity = 1
+	}
+
+	return &TopK{
+		capacity: capacity,
+		entries:  make(map[string]*topKEntry, capacity),
+		heap:     make(topKHeap, 0, capacity),
+	}
+}
+
+// Add increments the count of key by one
+func (t *TopK) Add(key string) {
+	if e, ok := t.entries[key]; ok {
+		e.count++
+		heap.Fix(&t.heap, e.index)
+		return
+	}
+
+	if len(t.heap) < t.capacity {
+		e := &topKEntry{key: key, count: 1}
+		t.entries[key] = e
+		heap.Push(&t.heap, e)
+		return
+	}
+
+	// Evict the smallest entry and let the new key inherit its count
+	e := t.heap[0]
+	delete(t.entries, e.key)
+	e.key = key
+	e.err = e.count
+	e.count++
+	t.entries[key] = e
+	heap.Fix(&t.heap, e.index)
+}
+
+// Top returns the n keys with the highest counts, highest first.
+func (t *TopK) Top(n int) []Count {
+	counts := make([]Count, 0, len(t.heap))
+	for _, e := range t.heap {
+		counts = append(counts, Count{Key: e.key, Count: e.count, Error: e.err})
+	}
+
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].Count == counts[j].Count {
+			return counts[i].Key < counts[j].Key
+		}
+		return counts[i].Count > counts[j].Count
+	})
+
+	if n >= 0 && n < len(counts) {
+		counts = counts[:n]
+	}
+	return counts
+}
+
+// topKHeap is a min-heap on count to quickly find the entry to evict
+type topKHeap []*topKEntry
+
+func (h topKHeap) Len() int           { return len(h) }
+func (h topKHeap) Less(i, j int) bool { return h[i].count < h[j].count }
+
+func (h topKHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *topKHeap) Push(x any) {
+	e := x.(*topKEntry)
+	e.index = len(*h)
+	*h = append(*h, e)
+}
+
+func (h *topKHeap) Pop() any {
+	old := *h
+	n := len(old)
+	e := old[n-1]
+	*h = old[:n-1]
+	return e
+}
@@ -0,0 +1,104 @@
+// Package textnorm cleans up the text in Crossref metadata, which can contain markup,
+// HTML entities, odd whitespace and the same characters encoded in different ways.
+package textnorm
+
+import (
+	"html"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+// tag matches what looks like an opening, closing or self-closing tag and captures the namespace and the local name.
+// Covers HTML like <i>, JATS like <jats:p> and MathML like <mml:mi>. Names start with a letter and attributes
+// must have quoted values, so comparisons in text like p<0.05 and q>1 are not taken for tags.
+var tag = regexp.MustCompile(
+	`</?(?:([A-Za-z][\w.-]*):)?([A-Za-z][\w-]*)(?:\s+[A-Za-z][\w:.-]*\s*=\s*(?:"[^"]*"|'[^']*'))*\s*/?>`,
+)
+
+// elements are the names of the HTML, JATS and MathML elements that are stripped without a namespace, next to blocks.
+// With a namespace, like jats: or mml:, any name is taken to be markup.
+var elements = map[string]bool{
+	"a": true, "b": true, "i": true, "u": true, "s": true, "em": true, "strong": true, "sub": true, "sup": true,
+	"small": true, "big": true, "tt": true, "span": true, "font": true, "code": true, "strike": true, "hr": true,
+	"ul": true, "ol": true, "li": true, "h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true,
+	"img": true, "thead": true, "tbody": true, "blockquote": true, "pre": true,
+	"italic": true, "bold": true, "sc": true, "underline": true, "overline": true, "monospace": true,
+	"roman": true, "sans-serif": true, "ext-link": true, "uri": true, "xref": true, "inline-formula": true,
+	"named-content": true, "styled-content": true, "fn": true,
+	"math": true, "mi": true, "mo": true, "mn": true, "ms": true, "mtext": true, "mrow": true, "msub": true,
+	"msup": true, "msubsup": true, "mfrac": true, "msqrt": true, "mroot": true, "mover": true, "munder": true,
+	"munderover": true, "mfenced": true, "mspace": true, "mstyle": true, "mtable": true, "mtr": true, "mtd": true,
+	"semantics": true, "annotation": true,
+}
+
+// blocks are the elements that separate words. Other elements, like italic or sub, are inline
+// and removing them must not split the word they are in.
+var blocks = map[string]bool{
+	"p":            true,
+	"br":           true,
+	"div":          true,
+	"sec":          true,
+	"title":        true,
+	"label":        true,
+	"list":         true,
+	"list-item":    true,
+	"caption":      true,
+	"disp-formula": true,
+	"disp-quote":   true,
+	"table":        true,
+	"tr":           true,
+	"td":           true,
+	"th":           true,
+	"break":        true,
+	"abstract":     true,
+}
+
+// foldedLetters are letters that are not a base letter with a diacritic, so they don't decompose, but are
+// written with plain letters when there is no way to type them.
+var foldedLetters = strings.NewReplacer(
+	"ß", "ss", "æ", "ae", "Æ", "AE", "œ", "oe", "Œ", "OE", "ø", "o", "Ø", "O",
+	"ł", "l", "Ł", "L", "đ", "d", "Đ", "D", "ð", "d", "Ð", "D", "þ", "th", "Þ", "TH", "ı", "i",
+)
+
+// StripTags removes markup. Block elements are replaced by a space and inline elements are removed.
+func StripTags(s string) string {
+	return tag.ReplaceAllStringFunc(s, func(t string) string {
+		match := tag.FindStringSubmatch(t)
+		name := strings.ToLower(match[2])
+		if match[1] == "" && !elements[name] && !blocks[name] {
+			return t // Not an element that is known, so probably text
+		}
+		if blocks[name] {
+			return " "
+		}
+		return ""
+	})
+}
+
+// Whitespace collapses all runs of whitespace, including non-breaking spaces, to a single space and trims the ends
+func Whitespace(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// Clean strips markup, decodes entities, composes characters to NFC and collapses whitespace
+func Clean(s string) string {
+	// Entities are decoded after the tags are gone so that encoded brackets are not taken for tags
+	s = html.UnescapeString(StripTags(s))
+	return Whitespace(norm.NFC.String(s))
+}
+
+// Fold removes diacritics, so Körper becomes Korper, and writes letters like ß and ø with plain letters
+func Fold(s string) string {
+	// A transformer keeps state so a new one is needed for every call to be safe for concurrent use
+	t := transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC)
+	folded, _, err := transform.String(t, s)
+	if err != nil {
+		return foldedLetters.Replace(s)
+	}
+	return foldedLetters.Replace(folded)
+}
@@ -0,0 +1,100 @@
+package textnorm
+
+import (
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+func TestClean(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{
+			name:  "runs of whitespace",
+			input: "  Zur   Elektrodynamik\n bewegter\tKörper ",
+			want:  "Zur Elektrodynamik bewegter Körper",
+		},
+		{
+			name:  "HTML tags",
+			input: "Growth of <i>E. coli</i> in H<sub>2</sub>O",
+			want:  "Growth of E. coli in H2O",
+		},
+		{
+			name:  "MathML",
+			input: "The <mml:math><mml:mi>x</mml:mi><mml:mo>+</mml:mo><mml:mn>1</mml:mn></mml:math> problem",
+			want:  "The x+1 problem",
+		},
+		{
+			name:  "JATS paragraphs",
+			input: "<jats:p>First.</jats:p><jats:p>Second.</jats:p>",
+			want:  "First. Second.",
+		},
+		{
+			name:  "entities",
+			input: "Smith &amp; Wesson&nbsp;&#8211; x &lt; y",
+			want:  "Smith & Wesson – x < y",
+		},
+		{
+			name:  "decomposed characters are composed",
+			input: "Körper",
+			want:  "Körper",
+		},
+		{
+			name:  "comparisons are not tags",
+			input: "Energies E<100 GeV and x>5",
+			want:  "Energies E<100 GeV and x>5",
+		},
+		{
+			name:  "comparisons with numbers are not tags",
+			input: "p<0.05 and q>1",
+			want:  "p<0.05 and q>1",
+		},
+		{
+			name:  "comparisons of letters are not tags",
+			input: "when a<b and c>d",
+			want:  "when a<b and c>d",
+		},
+		{
+			name:  "tags with attributes",
+			input: `<jats:ext-link xmlns:xlink="http://www.w3.org/1999/xlink" ext-link-type="uri">site</jats:ext-link> and <span class='x'>text</span>`,
+			want:  "site and text",
+		},
+		{
+			name:  "encoded tags are kept as text",
+			input: "The &lt;i&gt; tag",
+			want:  "The <i> tag",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			is := is.New(t)
+			is.Equal(Clean(tt.input), tt.want)
+		})
+	}
+}
+
+func TestFold(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{input: "Körper", want: "Korper"},
+		{input: "Körper", want: "Korper"},
+		{input: "Erdős–Rényi", want: "Erdos–Renyi"},
+		{input: "Straße", want: "Strasse"},
+		{input: "Łódź", want: "Lodz"},
+		{input: "Søren Kierkegaard", want: "Soren Kierkegaard"},
+		{input: "plain", want: "plain"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			is := is.New(t)
+			is.Equal(Fold(tt.input), tt.want)
+		})
+	}
+}
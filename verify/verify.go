@@ -0,0 +1,236 @@
+// Package verify checks that the publications sent for indexing ended up in the index as expected.
+package verify
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/maphash"
+	"math/rand"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/karatekaneen/crossrefindexer"
+)
+
+// batchSize is how many documents to fetch per request when checking the sample
+const batchSize = 1000
+
+// Store is where the publications were indexed. Satisfied by *elastic.Indexer
+type Store interface {
+	Refresh(ctx context.Context, indexName string) error
+	Count(ctx context.Context, indexName string) (int, error)
+	Documents(ctx context.Context, indexName string, ids []string) (map[string]json.RawMessage, error)
+}
+
+// Verifier keeps track of the publications sent for indexing. Only a hash of each DOI is kept
+// to count the unique ones exactly, together with a random sample of the publications to compare with the index.
+// The hashes take 8 bytes per publication, which is about 1.2GB for a full Crossref snapshot.
+// It is not safe for concurrent use.
+type Verifier struct {
+	seed       maphash.Seed
+	hashes     []uint64
+	sample     []crossrefindexer.SimplifiedPublication
+	sampleSize int
+	rand       *rand.Rand
+}
+
+// Mismatch is a sampled publication that was not stored as it was sent
+type Mismatch struct {
+	DOI    string `json:"doi"`
+	Reason string `json:"reason"`
+}
+
+type Result struct {
+	Processed  int        `json:"processed"`  // Publications sent for indexing
+	Unique     int        `json:"unique"`     // Unique DOIs among the processed
+	Indexed    int        `json:"indexed"`    // Documents in the index
+	Sampled    int        `json:"sampled"`    // Publications compared with the stored documents
+	Skipped    int        `json:"skipped"`    // Sampled publications with duplicate DOIs that were not compared
+	Mismatches []Mismatch `json:"mismatches"` // Sampled publications that differ from the stored documents
+}
+
+// New creates a verifier that compares `sampleSize` random publications with the index
+func New(sampleSize int) *Verifier {
+	return &Verifier{
+		seed:       maphash.MakeSeed(),
+		sampleSize: sampleSize,
+		//nolint:gosec // The sample doesn't need to be cryptographically random
+		rand: rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// Add records a publication that was sent for indexing
+func (v *Verifier) Add(pub crossrefindexer.SimplifiedPublication) {
+	v.hashes = append(v.hashes, maphash.String(v.seed, pub.DOI))
+
+	// Reservoir sampling so that every publication has the same chance to be picked
+	// without knowing the total beforehand
+	switch {
+	case len(v.sample) < v.sampleSize:
+		v.sample = append(v.sample, pub)
+	case v.sampleSize > 0:
+		if n := v.rand.Intn(len(v.hashes)); n < v.sampleSize {
+			v.sample[n] = pub
+		}
+	}
+}
+
+// Verify refreshes the index and compares it with the publications that were added.
+// If exact is set the index must contain exactly the unique DOIs, which is the case when it was
+// empty before indexing. Otherwise it must contain at least as many documents.
+// The result is returned also when verification fails so that it can be reported.
+func (v *Verifier) Verify(ctx context.Context, store Store, indexName string, exact bool) (Result, error) {
+	sort.Slice(v.hashes, func(a, b int) bool { return v.hashes[a] < v.hashes[b] })
+
+	result := Result{
+		Processed:  len(v.hashes),
+		Unique:     v.unique(),
+		Mismatches: []Mismatch{},
+	}
+
+	if err := store.Refresh(ctx, indexName); err != nil {
+		return result, fmt.Errorf("could not refresh index: %w", err)
+	}
+
+	count, err := store.Count(ctx, indexName)
+	if err != nil {
+		return result, fmt.Errorf("could not count documents: %w", err)
+	}
+	result.Indexed = count
+
+	if err := v.compareSample(ctx, store, indexName, &result); err != nil {
+		return result, err
+	}
+
+	switch {
+	case exact && result.Indexed != result.Unique:
+		return result, fmt.Errorf(
+			"index contains %d documents but %d unique DOIs were processed",
+			result.Indexed,
+			result.Unique,
+		)
+	case !exact && result.Indexed < result.Unique:
+		return result, fmt.Errorf(
+			"index contains %d documents which is fewer than the %d unique DOIs processed",
+			result.Indexed,
+			result.Unique,
+		)
+	case len(result.Mismatches) > 0:
+		return result, fmt.Errorf(
+			"%d of %d sampled documents do not match what was indexed, first is %s: %s",
+			len(result.Mismatches),
+			result.Sampled,
+			result.Mismatches[0].DOI,
+			result.Mismatches[0].Reason,
+		)
+	}
+
+	return result, nil
+}
+
+// unique counts the distinct hashes. They must be sorted.
+func (v *Verifier) unique() int {
+	unique := 0
+	for n := range v.hashes {
+		if n == 0 || v.hashes[n] != v.hashes[n-1] {
+			unique++
+		}
+	}
+	return unique
+}
+
+// duplicate tells if the DOI was processed more than once. The hashes must be sorted.
+func (v *Verifier) duplicate(doi string) bool {
+	h := maphash.String(v.seed, doi)
+	n := sort.Search(len(v.hashes), func(i int) bool { return v.hashes[i] >= h })
+	return n+1 < len(v.hashes) && v.hashes[n+1] == h
+}
+
+// compareSample fetches the sampled publications from the index and compares them with what was sent.
+// Publications with duplicate DOIs are skipped since it is not known which of them was stored last.
+func (v *Verifier) compareSample(ctx context.Context, store Store, indexName string, result *Result) error {
+	toCompare := []crossrefindexer.SimplifiedPublication{}
+	for _, pub := range v.sample {
+		if v.duplicate(pub.DOI) {
+			result.Skipped++
+			continue
+		}
+		toCompare = append(toCompare, pub)
+	}
+
+	for start := 0; start < len(toCompare); start += batchSize {
+		end := start + batchSize
+		if end > len(toCompare) {
+			end = len(toCompare)
+		}
+		batch := toCompare[start:end]
+
+		ids := make([]string, len(batch))
+		for n, pub := range batch {
+			ids[n] = pub.DOI
+		}
+
+		docs, err := store.Documents(ctx, indexName, ids)
+		if err != nil {
+			return fmt.Errorf("could not fetch sampled documents: %w", err)
+		}
+
+		for _, pub := range batch {
+			result.Sampled++
+
+			stored, found := docs[pub.DOI]
+			if !found {
+				result.Mismatches = append(result.Mismatches, Mismatch{DOI: pub.DOI, Reason: "not found in index"})
+				continue
+			}
+
+			reason, err := compare(pub, stored)
+			if err != nil {
+				return err
+			}
+			if reason != "" {
+				result.Mismatches = append(result.Mismatches, Mismatch{DOI: pub.DOI, Reason: reason})
+			}
+		}
+	}
+
+	return nil
+}
+
+// compare returns why the stored document differs from the publication, or an empty string if they match.
+// Both are compared as decoded JSON so that formatting and key order don't matter.
+func compare(pub crossrefindexer.SimplifiedPublication, stored json.RawMessage) (string, error) {
+	data, err := json.Marshal(pub)
+	if err != nil {
+		return "", fmt.Errorf("could not encode publication %s: %w", pub.DOI, err)
+	}
+
+	var want, got map[string]any
+	if err := json.Unmarshal(data, &want); err != nil {
+		return "", fmt.Errorf("could not decode publication %s: %w", pub.DOI, err)
+	}
+	if err := json.Unmarshal(stored, &got); err != nil {
+		return "", fmt.Errorf("could not decode stored document %s: %w", pub.DOI, err)
+	}
+
+	fields := []string{}
+	for key := range want {
+		if !reflect.DeepEqual(want[key], got[key]) {
+			fields = append(fields, key)
+		}
+	}
+	for key := range got {
+		if _, ok := want[key]; !ok {
+			fields = append(fields, key)
+		}
+	}
+	if len(fields) == 0 {
+		return "", nil
+	}
+
+	sort.Strings(fields)
+	return "fields differ: " + strings.Join(fields, ", "), nil
+}
@@ -0,0 +1,147 @@
+package verify
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/karatekaneen/crossrefindexer"
+	"github.com/matryer/is"
+)
+
+// fakeStore is an index holding the documents by id
+type fakeStore struct {
+	docs      map[string]json.RawMessage
+	refreshed bool
+}
+
+func (f *fakeStore) Refresh(context.Context, string) error {
+	f.refreshed = true
+	return nil
+}
+
+func (f *fakeStore) Count(context.Context, string) (int, error) {
+	return len(f.docs), nil
+}
+
+func (f *fakeStore) Documents(_ context.Context, _ string, ids []string) (map[string]json.RawMessage, error) {
+	docs := map[string]json.RawMessage{}
+	for _, id := range ids {
+		if doc, ok := f.docs[id]; ok {
+			docs[id] = doc
+		}
+	}
+	return docs, nil
+}
+
+func newStore(t *testing.T, pubs ...crossrefindexer.SimplifiedPublication) *fakeStore {
+	store := &fakeStore{docs: map[string]json.RawMessage{}}
+	for _, pub := range pubs {
+		data, err := json.Marshal(pub)
+		if err != nil {
+			t.Fatal(err)
+		}
+		store.docs[pub.DOI] = data
+	}
+	return store
+}
+
+var (
+	first  = crossrefindexer.SimplifiedPublication{DOI: "10.1002/andp.19053220607", Title: []string{"Lichtes"}, Year: 1905}
+	second = crossrefindexer.SimplifiedPublication{DOI: "10.1002/andp.19053220806", Title: []string{"Bewegung"}, Year: 1905}
+	third  = crossrefindexer.SimplifiedPublication{DOI: "10.1002/andp.19053221004", Title: []string{"Elektrodynamik"}, Year: 1905}
+)
+
+func TestVerify(t *testing.T) {
+	changed := second
+	changed.Year = 1906
+
+	tests := []struct {
+		name    string
+		added   []crossrefindexer.SimplifiedPublication
+		store   *fakeStore
+		exact   bool
+		want    Result
+		wantErr string
+	}{
+		{
+			name:  "everything indexed",
+			added: []crossrefindexer.SimplifiedPublication{first, second, third},
+			store: newStore(t, first, second, third),
+			exact: true,
+			want:  Result{Processed: 3, Unique: 3, Indexed: 3, Sampled: 3},
+		},
+		{
+			name:  "duplicates are counted once and not compared",
+			added: []crossrefindexer.SimplifiedPublication{first, second, changed},
+			store: newStore(t, first, changed),
+			exact: true,
+			want:  Result{Processed: 3, Unique: 2, Indexed: 2, Sampled: 1, Skipped: 2},
+		},
+		{
+			name:    "missing document",
+			added:   []crossrefindexer.SimplifiedPublication{first, second, third},
+			store:   newStore(t, first, third),
+			exact:   true,
+			wantErr: "index contains 2 documents but 3 unique DOIs were processed",
+		},
+		{
+			name:    "stored document differs",
+			added:   []crossrefindexer.SimplifiedPublication{first, second},
+			store:   newStore(t, first, changed),
+			exact:   true,
+			wantErr: "fields differ: year",
+		},
+		{
+			name:  "documents from before are allowed when not exact",
+			added: []crossrefindexer.SimplifiedPublication{first, second},
+			store: newStore(t, first, second, third),
+			want:  Result{Processed: 2, Unique: 2, Indexed: 3, Sampled: 2},
+		},
+		{
+			name:    "documents from before are not allowed when exact",
+			added:   []crossrefindexer.SimplifiedPublication{first, second},
+			store:   newStore(t, first, second, third),
+			exact:   true,
+			wantErr: "index contains 3 documents but 2 unique DOIs were processed",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			is := is.New(t)
+
+			v := New(10)
+			for _, pub := range tt.added {
+				v.Add(pub)
+			}
+
+			got, err := v.Verify(context.Background(), tt.store, "crossref", tt.exact)
+			is.True(tt.store.refreshed) // The index must be refreshed before counting
+			if tt.wantErr != "" {
+				is.True(err != nil)
+				is.True(strings.Contains(err.Error(), tt.wantErr)) // Error should explain the mismatch
+				return
+			}
+
+			is.NoErr(err)
+			tt.want.Mismatches = []Mismatch{}
+			is.Equal(got, tt.want)
+		})
+	}
+}
+
+func TestSampleSize(t *testing.T) {
+	is := is.New(t)
+
+	v := New(5)
+	for n := 0; n < 1000; n++ {
+		pub := first
+		pub.DOI = "10.1000/" + strings.Repeat("x", n%50) + string(rune('a'+n%26))
+		v.Add(pub)
+	}
+
+	is.Equal(len(v.sample), 5)    // The sample should never grow beyond its size
+	is.Equal(len(v.hashes), 1000) // Every publication should be counted
+}
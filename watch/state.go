@@ -0,0 +1,89 @@
+package watch
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// state is what is saved between runs
+type state struct {
+	Files map[string]fileState `json:"files"` // By file name
+}
+
+// fileState is a processed file, or a file that failed and will be retried.
+// The size and modification time tell if it is still the same file.
+type fileState struct {
+	Size        int64     `json:"size"`
+	ModTime     time.Time `json:"mod_time"`
+	ProcessedAt time.Time `json:"processed_at"`
+	Error       string    `json:"error,omitempty"`    // Why processing failed the last time, if it did
+	Attempts    int       `json:"attempts,omitempty"` // Number of times in a row processing has failed
+	RetryAt     time.Time `json:"retry_at,omitempty"` // When to try a failed file again
+}
+
+// loadState reads the state from the path, or returns an empty state if there is no file yet
+func loadState(path string) (*state, error) {
+	s := &state{Files: map[string]fileState{}}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("could not read state: %w", err)
+	}
+
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, fmt.Errorf("could not read state in %s: %w", path, err)
+	}
+	if s.Files == nil {
+		s.Files = map[string]fileState{}
+	}
+	return s, nil
+}
+
+// save writes the state to a temporary file that replaces the old one, so it is never left half written
+func (s *state) save(path string) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // Only left if the rename failed
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// processed tells if the file has been processed successfully and not changed since
+func (s *state) processed(name string, info os.FileInfo) bool {
+	done, ok := s.Files[name]
+	return ok && done.Error == "" && done.same(info)
+}
+
+// failed returns the last failure of the file, if it failed and has not changed since
+func (s *state) failed(name string, info os.FileInfo) (fileState, bool) {
+	done, ok := s.Files[name]
+	return done, ok && done.Error != "" && done.same(info)
+}
+
+func (f fileState) same(info os.FileInfo) bool {
+	return f.Size == info.Size() && f.ModTime.Equal(info.ModTime())
+}
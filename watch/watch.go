@@ -0,0 +1,304 @@
+// Package watch looks for new files in a directory, like the daily Crossref delta files dropped there by
+// another job, and processes every completed file once. Which files have been processed is kept in a state
+// file so that they are not processed again after a restart.
+package watch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/karatekaneen/crossrefindexer"
+	"go.uber.org/zap"
+)
+
+// notifyDelay is how long to wait after a notification before looking at the directory,
+// so that a burst of writes to a file only leads to a single scan
+const notifyDelay = time.Second
+
+// maxRetryDelay is the longest to wait before trying a failed file again, however many times it has failed
+const maxRetryDelay = 6 * time.Hour
+
+// DefaultStateFile is the name of the state file in the watched directory if no other is given
+const DefaultStateFile = ".crossrefindexer-state.json"
+
+type Config struct {
+	Interval     time.Duration `help:"How often to look for new files. Notifications make new files found sooner"     default:"1m"  name:"interval"`
+	Settle       time.Duration `help:"How long a file must be unchanged before it is considered complete"           default:"30s" name:"settle"`
+	State        string        `help:"File to keep track of the processed files in. Defaults to a file in the watched directory" name:"state"         type:"path" optional:""`
+	ProcessedDir string        `help:"Move processed files to this directory. Otherwise they are only marked in the state file"  name:"processed-dir" type:"path" optional:""`
+	Poll         bool          `help:"Only look for new files every interval, for file systems without notifications like NFS" name:"poll"          default:"false"`
+	Retry        time.Duration `help:"How long to wait before trying a failed file again. Doubled for every failure in a row" default:"5m"  name:"retry"`
+}
+
+// Watcher finds the completed files in a directory
+type Watcher struct {
+	dir     string
+	config  Config
+	state   *state
+	pending map[string]seen // Files that have not been unchanged for long enough yet
+	log     *zap.SugaredLogger
+	now     func() time.Time
+}
+
+// seen is how a file looked the last time the directory was scanned
+type seen struct {
+	size    int64
+	modTime time.Time
+	since   time.Time // When the file was first seen like this
+}
+
+// New creates a watcher of dir, with the state of an earlier run if there is one
+func New(dir string, cfg Config, log *zap.SugaredLogger) (*Watcher, error) {
+	if cfg.State == "" {
+		cfg.State = filepath.Join(dir, DefaultStateFile)
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = time.Minute
+	}
+	if cfg.Retry <= 0 {
+		cfg.Retry = 5 * time.Minute
+	}
+	if cfg.ProcessedDir != "" {
+		if err := os.MkdirAll(cfg.ProcessedDir, 0o755); err != nil {
+			return nil, fmt.Errorf("could not create %s: %w", cfg.ProcessedDir, err)
+		}
+	}
+
+	s, err := loadState(cfg.State)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Watcher{
+		dir:     dir,
+		config:  cfg,
+		state:   s,
+		pending: map[string]seen{},
+		log:     log,
+		now:     time.Now,
+	}, nil
+}
+
+// Run calls process once for every completed file in the directory, in the order of their names, until the
+// context is cancelled. Files that fail are tried again with a growing delay. Processing a file must
+// be safe to repeat, since a file is processed again if the process stops before its state is saved.
+func (w *Watcher) Run(ctx context.Context, process func(ctx context.Context, path string) error) error {
+	events, stop := w.notifications()
+	defer stop()
+
+	next := w.now()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-events:
+			// Look again soon, unless that will happen anyway
+			if soon := w.now().Add(notifyDelay); soon.Before(next) {
+				next = soon
+			}
+		case <-time.After(next.Sub(w.now())):
+			if err := w.Scan(ctx, process); err != nil {
+				return err
+			}
+			next = w.now().Add(w.wait())
+		}
+	}
+}
+
+// notifications returns a channel that gets a value when something changes in the directory.
+// The channel never gets anything when polling, including when notifications are not supported.
+func (w *Watcher) notifications() (<-chan fsnotify.Event, func()) {
+	if w.config.Poll {
+		w.log.Infof("Looking for new files in %s every %s", w.dir, w.config.Interval)
+		return nil, func() {}
+	}
+
+	notifier, err := fsnotify.NewWatcher()
+	if err == nil {
+		err = notifier.Add(w.dir)
+	}
+	if err != nil {
+		if notifier != nil {
+			notifier.Close()
+		}
+		w.log.Warnf("Could not get notifications for %s, looking for new files every %s instead: %v", w.dir, w.config.Interval, err)
+		return nil, func() {}
+	}
+
+	go func() {
+		for err := range notifier.Errors {
+			w.log.Warnw("Notification failed", "err", err)
+		}
+	}()
+	w.log.Infof("Watching %s for new files", w.dir)
+	return notifier.Events, func() { notifier.Close() }
+}
+
+// wait is how long to wait until the next scan, which is sooner than the interval if a file will have settled
+// or a failed file should be tried again before
+func (w *Watcher) wait() time.Duration {
+	wait := w.config.Interval
+	for _, file := range w.pending {
+		if settled := file.since.Add(w.config.Settle).Sub(w.now()); settled < wait {
+			wait = settled
+		}
+	}
+	for _, file := range w.state.Files {
+		if retry := file.RetryAt.Sub(w.now()); file.Error != "" && retry < wait {
+			wait = retry
+		}
+	}
+	if wait < 0 {
+		wait = 0
+	}
+	return wait
+}
+
+// Scan looks through the directory once and processes the files that are complete
+func (w *Watcher) Scan(ctx context.Context, process func(ctx context.Context, path string) error) error {
+	entries, err := os.ReadDir(w.dir)
+	if err != nil {
+		return fmt.Errorf("could not read %s: %w", w.dir, err)
+	}
+
+	present := map[string]bool{}
+	for _, entry := range entries {
+		name := entry.Name()
+		if !candidate(entry) {
+			continue
+		}
+		present[name] = true
+
+		info, err := entry.Info()
+		if errors.Is(err, os.ErrNotExist) {
+			continue // Removed since the directory was read
+		} else if err != nil {
+			return err
+		}
+
+		if w.state.processed(name, info) {
+			delete(w.pending, name)
+			continue
+		}
+		if failed, ok := w.state.failed(name, info); ok {
+			// Already complete when it failed, so it only has to wait for the retry
+			if w.now().Before(failed.RetryAt) {
+				continue
+			}
+		} else if !w.settled(name, info) {
+			continue
+		}
+
+		if err := w.processFile(ctx, name, info, process); err != nil {
+			return err
+		}
+		if ctx.Err() != nil {
+			return nil
+		}
+	}
+
+	// Forget about files that are gone before they were complete
+	for name := range w.pending {
+		if !present[name] {
+			delete(w.pending, name)
+		}
+	}
+	return nil
+}
+
+// candidate tells if the entry looks like a data file. Hidden and temporary files,
+// like the state file or a file that is being copied by rsync, are left out.
+func candidate(entry os.DirEntry) bool {
+	name := entry.Name()
+	return entry.Type().IsRegular() &&
+		!strings.HasPrefix(name, ".") &&
+		crossrefindexer.IsDataFile(name)
+}
+
+// settled tells if the file has been unchanged for long enough to be considered complete
+func (w *Watcher) settled(name string, info os.FileInfo) bool {
+	last, ok := w.pending[name]
+	if !ok || last.size != info.Size() || !last.modTime.Equal(info.ModTime()) {
+		last = seen{size: info.Size(), modTime: info.ModTime(), since: w.now()}
+		w.pending[name] = last
+	}
+	return w.now().Sub(last.since) >= w.config.Settle
+}
+
+// processFile processes the file and records that it is done, unless the context was cancelled while processing
+func (w *Watcher) processFile(
+	ctx context.Context,
+	name string,
+	info os.FileInfo,
+	process func(ctx context.Context, path string) error,
+) error {
+	delete(w.pending, name)
+	path := filepath.Join(w.dir, name)
+
+	log := w.log.With("path", path)
+	log.Infow("Processing new file", "size", info.Size())
+	start := w.now()
+
+	processErr := process(ctx, path)
+	if ctx.Err() != nil {
+		log.Infow("Stopped before the file was processed, it is processed again on the next start")
+		return nil
+	}
+
+	done := fileState{Size: info.Size(), ModTime: info.ModTime(), ProcessedAt: w.now()}
+	if processErr != nil {
+		done.Error = processErr.Error()
+		done.Attempts = 1
+		if failed, ok := w.state.failed(name, info); ok {
+			done.Attempts = failed.Attempts + 1
+		}
+		delay := w.retryDelay(done.Attempts)
+		done.RetryAt = w.now().Add(delay)
+		log.Errorw("Processing failed, the file is tried again later", "err", processErr, "attempts", done.Attempts, "retry_in", delay)
+	} else {
+		log.Infow("Processed file", "duration", w.now().Sub(start).Truncate(time.Millisecond))
+	}
+
+	w.state.Files[name] = done
+	if err := w.state.save(w.config.State); err != nil {
+		return fmt.Errorf("could not save state: %w", err)
+	}
+
+	if processErr == nil && w.config.ProcessedDir != "" {
+		if err := os.Rename(path, filepath.Join(w.config.ProcessedDir, name)); err != nil {
+			log.Errorw("Could not move processed file", "err", err)
+		}
+	}
+	return nil
+}
+
+// retryDelay is how long to wait before trying a file again after it has failed attempts times in a row
+func (w *Watcher) retryDelay(attempts int) time.Duration {
+	delay := w.config.Retry
+	for i := 1; i < attempts && delay < maxRetryDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxRetryDelay {
+		delay = maxRetryDelay
+	}
+	return delay
+}
+
+// Processed returns the names of the files that have been processed successfully
+func (w *Watcher) Processed() []string {
+	names := make([]string, 0, len(w.state.Files))
+	for name, file := range w.state.Files {
+		if file.Error == "" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
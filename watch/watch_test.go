@@ -0,0 +1,208 @@
+package watch
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+	"go.uber.org/zap"
+)
+
+// recorder keeps the names of the processed files
+type recorder struct {
+	mu    sync.Mutex
+	names []string
+	fail  map[string]bool
+}
+
+func (r *recorder) process(ctx context.Context, path string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	name := filepath.Base(path)
+	r.names = append(r.names, name)
+	if r.fail[name] {
+		return errors.New("broken file")
+	}
+	return nil
+}
+
+func (r *recorder) processed() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.names...)
+}
+
+func write(t *testing.T, path, content string) {
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// newWatcher creates a watcher with a clock that only moves when told to
+func newWatcher(t *testing.T, dir string, cfg Config) (*Watcher, *time.Time) {
+	is := is.New(t)
+
+	w, err := New(dir, cfg, zap.NewNop().Sugar())
+	is.NoErr(err)
+	now := time.Date(2023, 7, 1, 0, 0, 0, 0, time.UTC)
+	w.now = func() time.Time { return now }
+	return w, &now
+}
+
+func TestScan(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+	dir := t.TempDir()
+	cfg := Config{Settle: time.Minute}
+
+	write(t, filepath.Join(dir, "0.json.gz"), "first")
+	write(t, filepath.Join(dir, "1.json"), "broken")
+	write(t, filepath.Join(dir, ".hidden.json"), "")
+	write(t, filepath.Join(dir, "2.json.gz.part"), "still copying")
+	is.NoErr(os.Mkdir(filepath.Join(dir, "sub.json"), 0o755))
+
+	r := &recorder{fail: map[string]bool{"1.json": true}}
+	w, now := newWatcher(t, dir, cfg)
+
+	is.NoErr(w.Scan(ctx, r.process))
+	is.Equal(len(r.processed()), 0) // Not complete until unchanged for a while
+
+	*now = now.Add(time.Minute)
+	write(t, filepath.Join(dir, "0.json.gz"), "first, now longer") // Still being written
+	is.NoErr(w.Scan(ctx, r.process))
+	is.Equal(r.processed(), []string{"1.json"})
+
+	*now = now.Add(time.Minute)
+	is.NoErr(w.Scan(ctx, r.process))
+	is.Equal(r.processed(), []string{"1.json", "0.json.gz"})
+
+	// Processed files are not processed again, even after a restart
+	delete(r.fail, "1.json")
+	w, now = newWatcher(t, dir, cfg)
+	is.Equal(w.Processed(), []string{"0.json.gz"})
+	is.NoErr(w.Scan(ctx, r.process))
+	is.Equal(r.processed(), []string{"1.json", "0.json.gz"}) // Failed file not retried yet
+
+	// Unless they change, while failed files are tried again after a while
+	write(t, filepath.Join(dir, "0.json.gz"), "changed")
+	is.NoErr(w.Scan(ctx, r.process))
+	*now = now.Add(time.Hour)
+	is.NoErr(w.Scan(ctx, r.process))
+	is.Equal(r.processed(), []string{"1.json", "0.json.gz", "0.json.gz", "1.json"})
+	is.Equal(w.Processed(), []string{"0.json.gz", "1.json"})
+}
+
+func TestRetry(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+	dir := t.TempDir()
+	write(t, filepath.Join(dir, "0.json.gz"), "first")
+
+	r := &recorder{fail: map[string]bool{"0.json.gz": true}}
+	w, now := newWatcher(t, dir, Config{Interval: time.Hour, Retry: time.Minute})
+
+	// Like when the cluster is down
+	is.NoErr(w.Scan(ctx, r.process))
+	is.Equal(r.processed(), []string{"0.json.gz"})
+	is.Equal(len(w.Processed()), 0)
+	is.Equal(w.wait(), time.Minute)
+
+	// Not tried again before the delay, which doubles with every failure in a row
+	*now = now.Add(30 * time.Second)
+	is.NoErr(w.Scan(ctx, r.process))
+	is.Equal(len(r.processed()), 1)
+	*now = now.Add(30 * time.Second)
+	is.NoErr(w.Scan(ctx, r.process))
+	is.Equal(len(r.processed()), 2)
+	is.Equal(w.state.Files["0.json.gz"].Attempts, 2)
+	is.Equal(w.wait(), 2*time.Minute)
+
+	// Failures are remembered over a restart, and the file is processed once it works
+	delete(r.fail, "0.json.gz")
+	w, now = newWatcher(t, dir, Config{Interval: time.Hour, Retry: time.Minute})
+	*now = now.Add(3 * time.Minute)
+	is.NoErr(w.Scan(ctx, r.process))
+	is.Equal(r.processed(), []string{"0.json.gz", "0.json.gz", "0.json.gz"})
+	is.Equal(w.Processed(), []string{"0.json.gz"})
+	is.Equal(w.state.Files["0.json.gz"].Error, "")
+
+	*now = now.Add(time.Hour)
+	is.NoErr(w.Scan(ctx, r.process))
+	is.Equal(len(r.processed()), 3)
+}
+
+func TestProcessedDir(t *testing.T) {
+	is := is.New(t)
+	dir := t.TempDir()
+	processedDir := filepath.Join(dir, "done")
+
+	write(t, filepath.Join(dir, "0.json.gz"), "first")
+	write(t, filepath.Join(dir, "1.json.gz"), "second")
+
+	r := &recorder{fail: map[string]bool{"1.json.gz": true}}
+	w, _ := newWatcher(t, dir, Config{ProcessedDir: processedDir, State: filepath.Join(t.TempDir(), "state.json")})
+	is.NoErr(w.Scan(context.Background(), r.process))
+	is.Equal(r.processed(), []string{"0.json.gz", "1.json.gz"})
+
+	_, err := os.Stat(filepath.Join(processedDir, "0.json.gz"))
+	is.NoErr(err) // Moved when processed
+	_, err = os.Stat(filepath.Join(dir, "1.json.gz"))
+	is.NoErr(err) // Failed files are left
+}
+
+func TestCancelledWhileProcessing(t *testing.T) {
+	is := is.New(t)
+	dir := t.TempDir()
+	write(t, filepath.Join(dir, "0.json.gz"), "first")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	w, _ := newWatcher(t, dir, Config{})
+	is.NoErr(w.Scan(ctx, func(ctx context.Context, path string) error {
+		cancel()
+		return ctx.Err()
+	}))
+	is.Equal(len(w.Processed()), 0) // Processed again on the next start
+}
+
+func TestRun(t *testing.T) {
+	tests := []struct {
+		name     string
+		poll     bool
+		interval time.Duration
+	}{
+		{name: "notified of new files", interval: time.Hour},
+		{name: "polling for new files", poll: true, interval: 20 * time.Millisecond},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			is := is.New(t)
+			dir := t.TempDir()
+
+			ctx, cancel := context.WithCancel(context.Background())
+			r := &recorder{}
+			w, err := New(dir, Config{Interval: tt.interval, Poll: tt.poll}, zap.NewNop().Sugar())
+			is.NoErr(err)
+
+			done := make(chan error)
+			go func() { done <- w.Run(ctx, r.process) }()
+
+			time.Sleep(10 * time.Millisecond)
+			write(t, filepath.Join(dir, "0.json.gz"), "new")
+
+			deadline := time.Now().Add(5 * time.Second)
+			for len(r.processed()) == 0 && time.Now().Before(deadline) {
+				time.Sleep(5 * time.Millisecond)
+			}
+			cancel()
+			is.NoErr(<-done)
+			is.Equal(r.processed(), []string{"0.json.gz"})
+		})
+	}
+}